@@ -3,3 +3,7 @@ package main
 type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+// roomRoleContextKey holds the models.RoomRole authorizeWS found for the
+// client sending a websocket message, for its handler to use.
+const roomRoleContextKey = contextKey("roomRole")
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 
 	"charactersheet.iociveteres.net/internal/commands"
 	"charactersheet.iociveteres.net/internal/models"
+	"charactersheet.iociveteres.net/internal/sheetdiff"
 	"charactersheet.iociveteres.net/internal/validator"
 	"github.com/alehano/reverse"
 	"github.com/google/uuid"
@@ -702,16 +704,27 @@ func (app *application) prepareRoomViewData(w http.ResponseWriter, r *http.Reque
 		dicePresets = []models.DicePreset{}
 	}
 
-	messagePage, err := app.models.RoomMessages.GetMessagePage(r.Context(), roomID, 0, 50)
+	initiative, err := app.models.RoomInitiative.Get(r.Context(), roomID)
+	if err != nil {
+		initiative = &models.InitiativeTracker{RoomID: roomID, Entries: []models.InitiativeEntry{}}
+	}
+
+	messagePage, err := app.models.RoomMessages.GetMessagePage(r.Context(), roomID, userID, 0, 50)
 	if err != nil {
 		return nil, err
 	}
+	var role models.RoomRole
+	if current != nil {
+		role = current.Role
+	}
+	messagePage.RedactFor(userID, role)
 
 	data := app.newTemplateData(r)
 	data.PlayerViews = others
 	data.CurrentPlayerView = current
 	data.Room = room
 	data.DicePresets = dicePresets
+	data.Initiative = initiative
 	data.MessagePage = messagePage
 	data.AvailableCommands = commands.AvailableCommands()
 
@@ -770,7 +783,6 @@ func (app *application) roomView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.GetOrInitHub(roomID)
 	app.render(w, http.StatusOK, "view_room.html", "base", data)
 }
 
@@ -829,7 +841,6 @@ func (app *application) roomViewWithSheet(w http.ResponseWriter, r *http.Request
 	data.CharacterSheet = sheetView.CharacterSheet
 	data.CanEditSheet = sheetView.CanEdit
 
-	app.GetOrInitHub(roomID)
 	app.render(w, http.StatusOK, "view_room.html", "base", data)
 }
 
@@ -899,20 +910,119 @@ func (app *application) redeemInvite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.newPlayerHandler(app.hubMap[roomID], userID, user.Name, user.CreatedAt)
+	app.newPlayerHandler(app.hubs.Get(roomID), userID, user.Name, user.CreatedAt)
 
 	http.Redirect(w, r, reverse.Rev("RoomView", strconv.Itoa(roomID)), http.StatusSeeOther)
 }
 
-func (app *application) sheetExport(w http.ResponseWriter, r *http.Request) {
+type roomStatsForm struct {
+	From                string `form:"from"`
+	To                  string `form:"to"`
+	validator.Validator `form:"-"`
+}
+
+const statsDateLayout = "2006-01-02"
+
+// maxStatsDays bounds the date range one stats request may aggregate.
+const maxStatsDays = 366
+
+// roomStats shows roll statistics per player for a date range, the last
+// 30 days by default, at most maxStatsDays long. Both ends of the range are inclusive days in the
+// viewer's time zone.
+func (app *application) roomStats(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
-	sheetID, err := strconv.Atoi(params.ByName("id"))
+	roomID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || roomID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if err := app.authorizeRoom(r.Context(), roomID, userID); err != nil {
+		app.authorizationError(w, err)
+		return
+	}
+	role, err := app.models.RoomMembers.GetRole(r.Context(), roomID, userID)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	sheet, err := app.models.CharacterSheets.Get(r.Context(), sheetID)
+	room, err := app.models.Rooms.Get(r.Context(), roomID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Room = room
+
+	loc := data.TimeZone
+	if loc == nil {
+		loc = time.UTC
+	}
+	today := time.Now().In(loc)
+	form := roomStatsForm{
+		From: r.URL.Query().Get("from"),
+		To:   r.URL.Query().Get("to"),
+	}
+	if form.From == "" {
+		form.From = today.AddDate(0, 0, -29).Format(statsDateLayout)
+	}
+	if form.To == "" {
+		form.To = today.Format(statsDateLayout)
+	}
+
+	from, err := time.ParseInLocation(statsDateLayout, form.From, loc)
+	form.Check(err == nil, "from", "Enter a date as YYYY-MM-DD")
+	to, err := time.ParseInLocation(statsDateLayout, form.To, loc)
+	form.Check(err == nil, "to", "Enter a date as YYYY-MM-DD")
+	if form.Valid() {
+		form.Check(!to.Before(from), "to", "The end date must not be before the start date")
+		form.Check(!to.After(from.AddDate(0, 0, maxStatsDays-1)), "to",
+			fmt.Sprintf("The range can span at most %d days", maxStatsDays))
+	}
+
+	data.Form = form
+	if !form.Valid() {
+		app.render(w, http.StatusUnprocessableEntity, "room_stats.html", "base", data)
+		return
+	}
+
+	stats, err := app.models.RoomMessages.RollStats(r.Context(), roomID, userID, role, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.RollStats = stats
+	app.render(w, http.StatusOK, "room_stats.html", "base", data)
+}
+
+type rollVerification struct {
+	Message      models.Message         `json:"message"`
+	Seed         string                 `json:"seed"`
+	Verification *commands.Verification `json:"verification"`
+}
+
+// verifyRoll replays a stored roll from its recorded seed so a gamemaster can
+// audit a disputed result. The seed is stored with the message and never shown
+// before the roll, so this checks the server's records, not its honesty.
+func (app *application) verifyRoll(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	roomID, err := strconv.Atoi(params.ByName("roomid"))
+	if err != nil || roomID < 1 {
+		app.notFound(w)
+		return
+	}
+	messageID, err := strconv.Atoi(params.ByName("messageid"))
+	if err != nil || messageID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	audit, err := app.models.RoomMessages.GetRollAudit(r.Context(), userID, roomID, messageID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			app.notFound(w)
@@ -922,6 +1032,42 @@ func (app *application) sheetExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	verification, err := commands.VerifyRoll(r.Context(), audit.Message, audit.Audit, app.gamedata)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	js, err := json.MarshalIndent(&rollVerification{
+		Message:      audit.Message,
+		Seed:         hex.EncodeToString(audit.Audit.Seed),
+		Verification: verification,
+	}, "", "  ")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+func (app *application) sheetExport(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	sheetID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || sheetID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	sheetView, err := app.models.CharacterSheets.GetWithPermission(r.Context(), userID, sheetID)
+	if err != nil {
+		app.authorizationError(w, err)
+		return
+	}
+	sheet := sheetView.CharacterSheet
+
 	// Pretty-print JSON with indentation
 	var prettyJSON bytes.Buffer
 	if err := json.Indent(&prettyJSON, sheet.Content, "", "  "); err != nil {
@@ -951,6 +1097,10 @@ func (app *application) sheetImport(w http.ResponseWriter, r *http.Request) {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
+	if err := app.authorizeRoom(r.Context(), roomID, userID); err != nil {
+		app.authorizationError(w, err)
+		return
+	}
 
 	file, _, err := r.FormFile("sheet_file")
 	if err != nil {
@@ -985,6 +1135,509 @@ func (app *application) sheetImport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hub := app.GetOrInitHub(roomID)
+	hub := app.hubs.Get(roomID)
 	app.importedCharacterSheetHandler(r.Context(), hub, sheetID)
 }
+
+type sheetHistoryForm struct {
+	Section string `form:"section"`
+	UserID  int    `form:"user"`
+}
+
+// sheetHistory lists the changes made to a sheet, optionally only those in
+// one section or by one user, with restore actions for its owner and the
+// room's gamemaster.
+func (app *application) sheetHistory(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	sheetID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || sheetID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	sheetView, err := app.models.CharacterSheets.GetWithPermission(r.Context(), userID, sheetID)
+	if err != nil {
+		switch err {
+		case models.ErrNoRecord:
+			app.notFound(w)
+		case models.ErrPermissionDenied:
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	form := sheetHistoryForm{Section: r.URL.Query().Get("section")}
+	form.UserID, _ = strconv.Atoi(r.URL.Query().Get("user"))
+
+	history, err := app.models.CharacterSheets.History(r.Context(), userID, sheetID, models.SheetHistoryFilter{
+		Section: form.Section,
+		UserID:  form.UserID,
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	sheet := sheetView.CharacterSheet
+	data := app.newTemplateData(r)
+	data.CharacterSheet = sheet
+	data.SheetHistory = history
+	data.CanRestoreSheet = app.canRestoreSheet(r.Context(), sheet, userID)
+	data.Form = form
+	app.render(w, http.StatusOK, "sheet_history.html", "base", data)
+}
+
+// canRestoreSheet reports whether the user is the sheet's owner or a
+// gamemaster of its room, the only ones who may restore it.
+func (app *application) canRestoreSheet(ctx context.Context, sheet *models.CharacterSheet, userID int) bool {
+	if sheet.OwnerID == userID {
+		return true
+	}
+	role, err := app.models.RoomMembers.GetRole(ctx, sheet.RoomID, userID)
+	return err == nil && role == models.RoleGamemaster
+}
+
+type sheetRestoreForm struct {
+	Version int    `form:"version"`
+	Kind    string `form:"kind"` // "field", "item" or "sheet"
+	Path    string `form:"path"`
+}
+
+// sheetRestorePost puts a field, an item or the whole sheet back the way it
+// was as of a past version, then has everyone viewing the sheet reload it.
+func (app *application) sheetRestorePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	sheetID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || sheetID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	var form sheetRestoreForm
+	if err := app.decodePostForm(r, &form); err != nil || form.Version < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	path := parseJSONBPath(form.Path)
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	var version int
+	switch {
+	case form.Kind == "sheet":
+		version, err = app.models.CharacterSheets.RestoreSheet(r.Context(), userID, sheetID, form.Version)
+	case form.Kind == "item" && len(path) > 0:
+		version, err = app.models.CharacterSheets.RestoreItem(r.Context(), userID, sheetID, form.Version, path)
+	case form.Kind == "field" && len(path) > 0:
+		version, err = app.models.CharacterSheets.RestoreField(r.Context(), userID, sheetID, form.Version, path)
+	default:
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		switch err {
+		case models.ErrNoRecord:
+			app.notFound(w)
+		case models.ErrPermissionDenied:
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	sheet, err := app.models.CharacterSheets.Get(r.Context(), sheetID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sheetRestoredHandler(app.hubs.Get(sheet.RoomID), sheetID, version)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Restored as of version %d.", form.Version))
+	http.Redirect(w, r, reverse.Rev("SheetHistory", strconv.Itoa(sheetID)), http.StatusSeeOther)
+}
+
+type sheetSnapshotForm struct {
+	Label               string `form:"label"`
+	validator.Validator `form:"-"`
+}
+
+// sheetSnapshots lists a sheet's snapshots, with a form to take a new one
+// for those who can edit it.
+func (app *application) sheetSnapshots(w http.ResponseWriter, r *http.Request) {
+	app.renderSheetSnapshots(w, r, http.StatusOK, sheetSnapshotForm{})
+}
+
+// sheetSnapshotPost saves a copy of the sheet as it is now under a label.
+func (app *application) sheetSnapshotPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	sheetID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || sheetID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	var form sheetSnapshotForm
+	if err := app.decodePostForm(r, &form); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Check(validator.NotBlank(form.Label), "label", "This field cannot be blank")
+	form.Check(validator.MaxChars(form.Label, 100), "label", "This field cannot be more than 100 characters long")
+
+	if !form.Valid() {
+		app.renderSheetSnapshots(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	_, err = app.models.CharacterSheets.CreateSnapshot(r.Context(), userID, sheetID, strings.TrimSpace(form.Label))
+	if err != nil {
+		switch err {
+		case models.ErrPermissionDenied:
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snapshot saved.")
+	http.Redirect(w, r, reverse.Rev("SheetSnapshots", strconv.Itoa(sheetID)), http.StatusSeeOther)
+}
+
+func (app *application) renderSheetSnapshots(w http.ResponseWriter, r *http.Request, status int, form sheetSnapshotForm) {
+	params := httprouter.ParamsFromContext(r.Context())
+	sheetID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || sheetID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	sheetView, err := app.models.CharacterSheets.GetWithPermission(r.Context(), userID, sheetID)
+	if err != nil {
+		switch err {
+		case models.ErrNoRecord:
+			app.notFound(w)
+		case models.ErrPermissionDenied:
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	snapshots, err := app.models.CharacterSheets.ListSnapshots(r.Context(), userID, sheetID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.CharacterSheet = sheetView.CharacterSheet
+	data.SheetSnapshots = snapshots
+	data.CanEditSheet = sheetView.CanEdit
+	data.CanRestoreSheet = app.canRestoreSheet(r.Context(), sheetView.CharacterSheet, userID)
+	data.Form = form
+	app.render(w, status, "sheet_snapshots.html", "base", data)
+}
+
+// sheetSnapshotCompare shows what has changed on a sheet since a snapshot
+// of it was taken.
+func (app *application) sheetSnapshotCompare(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	sheetID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || sheetID < 1 {
+		app.notFound(w)
+		return
+	}
+	snapshotID, err := strconv.Atoi(params.ByName("snapshotid"))
+	if err != nil || snapshotID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	sheetView, err := app.models.CharacterSheets.GetWithPermission(r.Context(), userID, sheetID)
+	if err != nil {
+		switch err {
+		case models.ErrNoRecord:
+			app.notFound(w)
+		case models.ErrPermissionDenied:
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	snapshot, err := app.models.CharacterSheets.GetSnapshot(r.Context(), userID, sheetID, snapshotID)
+	if err != nil {
+		switch err {
+		case models.ErrNoRecord:
+			app.notFound(w)
+		case models.ErrPermissionDenied:
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+	diff, err := app.diffSheetVersions(r.Context(), userID, sheetID, sheetDiffForm{Snapshot: snapshot.ID})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.CharacterSheet = sheetView.CharacterSheet
+	data.SheetSnapshot = snapshot
+	data.SheetDiff = diff
+	data.CanRestoreSheet = app.canRestoreSheet(r.Context(), sheetView.CharacterSheet, userID)
+	app.render(w, http.StatusOK, "sheet_snapshot_compare.html", "base", data)
+}
+
+// sheetSnapshotRestorePost writes a snapshot over the sheet as a new
+// version, then has everyone viewing the sheet reload it.
+func (app *application) sheetSnapshotRestorePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	sheetID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || sheetID < 1 {
+		app.notFound(w)
+		return
+	}
+	snapshotID, err := strconv.Atoi(params.ByName("snapshotid"))
+	if err != nil || snapshotID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	version, err := app.models.CharacterSheets.RestoreSnapshot(r.Context(), userID, sheetID, snapshotID)
+	if err != nil {
+		switch err {
+		case models.ErrNoRecord:
+			app.notFound(w)
+		case models.ErrPermissionDenied:
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	sheet, err := app.models.CharacterSheets.Get(r.Context(), sheetID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sheetRestoredHandler(app.hubs.Get(sheet.RoomID), sheetID, version)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snapshot restored as version %d.", version))
+	http.Redirect(w, r, reverse.Rev("SheetSnapshots", strconv.Itoa(sheetID)), http.StatusSeeOther)
+}
+
+type sheetDiffForm struct {
+	From                int  `form:"from"`
+	To                  int  `form:"to"`
+	Snapshot            int  `form:"snapshot"`
+	Layout              bool `form:"layout"`
+	validator.Validator `form:"-"`
+}
+
+// sheetDiff shows what changed on a sheet from a past version or a snapshot
+// to another version, the latest by default. With format=json it answers
+// with the diff as JSON instead.
+func (app *application) sheetDiff(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	sheetID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || sheetID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	query := r.URL.Query()
+	form := sheetDiffForm{Layout: query.Get("layout") != ""}
+	form.From, _ = strconv.Atoi(query.Get("from"))
+	form.To, _ = strconv.Atoi(query.Get("to"))
+	form.Snapshot, _ = strconv.Atoi(query.Get("snapshot"))
+	asJSON := query.Get("format") == "json"
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	var diff *sheetdiff.Diff
+	if form.From > 0 || form.Snapshot > 0 {
+		diff, err = app.diffSheetVersions(r.Context(), userID, sheetID, form)
+		if err != nil {
+			switch err {
+			case models.ErrNoRecord:
+				app.notFound(w)
+			case models.ErrPermissionDenied:
+				app.clientError(w, http.StatusForbidden)
+			default:
+				app.serverError(w, err)
+			}
+			return
+		}
+	}
+
+	if asJSON {
+		if diff == nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		app.writeSheetDiff(w, diff)
+		return
+	}
+	app.renderSheetDiff(w, r, http.StatusOK, form, diff)
+}
+
+// sheetDiffPost shows what changed on a sheet since an exported copy of it
+// was saved, as a page or, with format=json, as JSON.
+func (app *application) sheetDiffPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	sheetID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || sheetID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	// Parse multipart form (10MB max)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := sheetDiffForm{Layout: r.FormValue("layout") != ""}
+	asJSON := r.FormValue("format") == "json"
+
+	var exported []byte
+	file, _, err := r.FormFile("sheet_file")
+	if err == nil {
+		defer file.Close()
+		exported, err = io.ReadAll(file)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	form.Check(len(exported) > 0, "sheet_file", "Choose an exported sheet to compare")
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	var diff *sheetdiff.Diff
+	if form.Valid() {
+		current, version, err := app.models.CharacterSheets.ContentAt(r.Context(), userID, sheetID, 0)
+		if err != nil {
+			switch err {
+			case models.ErrNoRecord:
+				app.notFound(w)
+			case models.ErrPermissionDenied:
+				app.clientError(w, http.StatusForbidden)
+			default:
+				app.serverError(w, err)
+			}
+			return
+		}
+		diff, err = sheetdiff.CompareJSON(exported, current, sheetdiff.Options{Layout: form.Layout})
+		if err != nil {
+			form.AddError("sheet_file", "This file is not an exported character sheet")
+		} else {
+			diff.From, diff.To = "uploaded file", fmt.Sprintf("version %d", version)
+		}
+	}
+
+	if !form.Valid() {
+		if asJSON {
+			app.clientError(w, http.StatusUnprocessableEntity)
+			return
+		}
+		app.renderSheetDiff(w, r, http.StatusUnprocessableEntity, form, nil)
+		return
+	}
+	if asJSON {
+		app.writeSheetDiff(w, diff)
+		return
+	}
+	app.renderSheetDiff(w, r, http.StatusOK, form, diff)
+}
+
+// diffSheetVersions compares the sheet as of form.From, or form.Snapshot
+// when set, with the sheet as of form.To.
+func (app *application) diffSheetVersions(ctx context.Context, userID, sheetID int, form sheetDiffForm) (*sheetdiff.Diff, error) {
+	var before json.RawMessage
+	var from string
+	if form.Snapshot > 0 {
+		snapshot, err := app.models.CharacterSheets.GetSnapshot(ctx, userID, sheetID, form.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		before, from = snapshot.Content, fmt.Sprintf("snapshot %q", snapshot.Label)
+	} else {
+		content, version, err := app.models.CharacterSheets.ContentAt(ctx, userID, sheetID, form.From)
+		if err != nil {
+			return nil, err
+		}
+		before, from = content, fmt.Sprintf("version %d", version)
+	}
+
+	after, version, err := app.models.CharacterSheets.ContentAt(ctx, userID, sheetID, form.To)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := sheetdiff.CompareJSON(before, after, sheetdiff.Options{Layout: form.Layout})
+	if err != nil {
+		return nil, err
+	}
+	diff.From, diff.To = from, fmt.Sprintf("version %d", version)
+	return diff, nil
+}
+
+func (app *application) writeSheetDiff(w http.ResponseWriter, diff *sheetdiff.Diff) {
+	js, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+func (app *application) renderSheetDiff(w http.ResponseWriter, r *http.Request, status int, form sheetDiffForm, diff *sheetdiff.Diff) {
+	params := httprouter.ParamsFromContext(r.Context())
+	sheetID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || sheetID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	sheetView, err := app.models.CharacterSheets.GetWithPermission(r.Context(), userID, sheetID)
+	if err != nil {
+		switch err {
+		case models.ErrNoRecord:
+			app.notFound(w)
+		case models.ErrPermissionDenied:
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	snapshots, err := app.models.CharacterSheets.ListSnapshots(r.Context(), userID, sheetID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.CharacterSheet = sheetView.CharacterSheet
+	data.SheetSnapshots = snapshots
+	data.SheetDiff = diff
+	data.Form = form
+	app.render(w, status, "sheet_diff.html", "base", data)
+}
@@ -231,3 +231,86 @@ func TestSheetCreate(t *testing.T) {
 		assert.StringContains(t, body, "<form action='/sheet/create' method='POST'>")
 	})
 }
+
+func TestRoomAuthorization(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Log in as alice, who is a member of room 1 but not of room 2.
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", csrfToken)
+	ts.postForm(t, "/user/login", form)
+
+	t.Run("Websocket", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			urlPath  string
+			wantCode int
+		}{
+			// A plain GET is not a websocket handshake, so the upgrader
+			// turns it away once authorization has passed.
+			{"Member", "/room/ws/1", http.StatusBadRequest},
+			{"Non-member", "/room/ws/2", http.StatusForbidden},
+			{"Non-existent room", "/room/ws/3", http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, _, _ := ts.get(t, tt.urlPath)
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			urlPath  string
+			wantCode int
+			wantBody string
+		}{
+			{"Own sheet", "/sheet/export/1", http.StatusOK, `"characterName": "Vex"`},
+			{"Sheet in another room", "/sheet/export/2", http.StatusForbidden, ""},
+			{"Non-existent sheet", "/sheet/export/3", http.StatusNotFound, ""},
+			{"Invalid ID", "/sheet/export/foo", http.StatusNotFound, ""},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, _, body := ts.get(t, tt.urlPath)
+				assert.Equal(t, code, tt.wantCode)
+				if tt.wantBody != "" {
+					assert.StringContains(t, body, tt.wantBody)
+				}
+			})
+		}
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			roomID   string
+			wantCode int
+		}{
+			// The member gets as far as validating the file, which is not
+			// a character sheet.
+			{"Member", "1", http.StatusBadRequest},
+			{"Non-member", "2", http.StatusForbidden},
+			{"Non-existent room", "3", http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				fields := url.Values{}
+				fields.Add("room_id", tt.roomID)
+				fields.Add("csrf_token", csrfToken)
+				code, _, _ := ts.postMultipart(t, "/sheet/import", fields, map[string][]byte{
+					"sheet_file": []byte(`{"not": "a sheet"}`),
+				})
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+	})
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
@@ -10,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
@@ -38,6 +40,36 @@ func (app *application) notFound(w http.ResponseWriter) {
 	app.clientError(w, http.StatusNotFound)
 }
 
+// authorizeRoom checks that the room exists and that the user is one of its
+// members, failing with models.ErrNoRecord or models.ErrPermissionDenied.
+func (app *application) authorizeRoom(ctx context.Context, roomID, userID int) error {
+	if _, err := app.models.Rooms.Get(ctx, roomID); err != nil {
+		return err
+	}
+	isInRoom, err := app.models.Rooms.HasUser(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if !isInRoom {
+		return models.ErrPermissionDenied
+	}
+	return nil
+}
+
+// authorizationError answers a failed authorization check: 404 for
+// models.ErrNoRecord, 403 for models.ErrPermissionDenied and 500 for
+// anything else.
+func (app *application) authorizationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrNoRecord):
+		app.notFound(w)
+	case errors.Is(err, models.ErrPermissionDenied):
+		app.clientError(w, http.StatusForbidden)
+	default:
+		app.serverError(w, err)
+	}
+}
+
 func (app *application) isAuthenticated(r *http.Request) bool {
 	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
 	if !ok {
@@ -199,6 +231,35 @@ func (app *application) wsClientError(eventID, code string, status int) json.Raw
 	return json.RawMessage(b)
 }
 
+// wsConflictMsg rejects a sheet edit that was based on an outdated version
+// of what it changes; Value and Version let the client catch up.
+type wsConflictMsg struct {
+	Type    string          `json:"type"` // "conflict"
+	EventID string          `json:"eventID"`
+	SheetID string          `json:"sheetID"`
+	Path    string          `json:"path"`
+	Version int             `json:"version"`
+	Value   json.RawMessage `json:"value"`
+}
+
+func (app *application) wsConflict(eventID string, conflict *models.ConflictError) json.RawMessage {
+	b, marshalErr := json.Marshal(&wsConflictMsg{
+		Type:    "conflict",
+		EventID: eventID,
+		SheetID: strconv.Itoa(conflict.SheetID),
+		Path:    conflict.Path,
+		Version: conflict.Version,
+		Value:   conflict.Value,
+	})
+	if marshalErr != nil {
+		app.errorLog.Output(2, fmt.Sprintf("json.Marshal failed in wsConflict: %v", marshalErr))
+		fallback := []byte(`{"type":"response","OK":false,"message":"internal server error"}`)
+		return json.RawMessage(fallback)
+	}
+
+	return json.RawMessage(b)
+}
+
 // wsOK builds a success ACK
 func (app *application) wsOK(eventID string, version int) json.RawMessage {
 	resp := WSResponse{
@@ -32,11 +32,12 @@ type application struct {
 	errorLog       *log.Logger
 	infoLog        *log.Logger
 	models         models.Models
-	hubMap         map[int]*Hub
+	hubs           *HubRegistry
 	templateCache  map[string]*template.Template
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
 	wsHandlers     map[string]wsHandler
+	wsWorkers      int
 	baseURL        string
 	gamedata       *gamedata.Catalog
 	mailer         mailer.Mailer
@@ -44,10 +45,11 @@ type application struct {
 }
 
 type config struct {
-	addr  string
-	debug bool
-	env   string
-	db    struct {
+	addr      string
+	debug     bool
+	env       string
+	wsWorkers int
+	db        struct {
 		dsn string
 	}
 	smtp struct {
@@ -83,6 +85,8 @@ func main() {
 
 	flag.BoolVar(&cfg.debug, "debug", false, "Enable debug mode")
 
+	flag.IntVar(&cfg.wsWorkers, "ws-workers", 4, "Websocket message workers per client (0 handles messages in order on the read loop)")
+
 	port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
 	if err != nil {
 		errorLog.Fatal(err)
@@ -130,15 +134,16 @@ func main() {
 		errorLog:       errorLog,
 		infoLog:        infoLog,
 		models:         models.NewModels(pool),
-		hubMap:         make(map[int]*Hub),
 		templateCache:  templateCache,
 		gamedata:       catalog,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
 		baseURL:        os.Getenv("BASE_URL"),
 		mailer:         mailer,
+		wsWorkers:      cfg.wsWorkers,
 	}
 	app.wsHandlers = app.buildWSHandlerMap()
+	app.hubs = NewHubRegistry(hubIdleTimeout, app.NewRoom)
 
 	err = app.serve(cfg)
 	if err != nil {
@@ -184,7 +189,15 @@ func (app *application) serve(cfg config) error {
 		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 		defer cancel()
 
-		shutdownError <- srv.Shutdown(ctx)
+		// Hijacked websocket connections outlive srv.Shutdown, so the hubs
+		// close them once no new ones can arrive.
+		if err := srv.Shutdown(ctx); err != nil {
+			shutdownError <- err
+			return
+		}
+
+		app.infoLog.Printf("closing room connections")
+		shutdownError <- app.hubs.Shutdown(ctx)
 	}()
 	app.infoLog.Printf("Starting server on %s", cfg.addr)
 
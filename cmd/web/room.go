@@ -2,6 +2,11 @@ package main
 
 import (
 	"log"
+	"sync"
+	"time"
+
+	"charactersheet.iociveteres.net/internal/commands"
+	"github.com/gorilla/websocket"
 )
 
 // Hub maintains the set of active clients and broadcasts messages to the
@@ -28,6 +33,15 @@ type Hub struct {
 	// external requests to remove all clients with user ID
 	kickUser chan int
 
+	// seeds for the dice rolled in this room
+	rng *commands.RoomRNG
+
+	// quit asks Run to close every client and return; done is closed once
+	// it has.
+	quit     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
 	infoLog  *log.Logger
 	errorLog *log.Logger
 }
@@ -58,25 +72,22 @@ func (app *application) NewRoom(roomID int) *Hub {
 		unregister:    make(chan *Client, 16),
 		kickUser:      make(chan int, 16),
 		clients:       make(map[*Client]bool),
+		rng:           commands.NewRoomRNG(),
+		quit:          make(chan struct{}),
+		done:          make(chan struct{}),
 		infoLog:       app.infoLog,
 		errorLog:      app.errorLog,
 	}
 }
 
-func (app *application) GetOrInitHub(roomID int) *Hub {
-	hub, ok := app.hubMap[roomID]
-	if !ok {
-		hub := app.NewRoom(roomID)
-		app.hubMap[roomID] = hub
-		go hub.Run()
-		return hub
-	}
-	return hub
-}
-
 func (h *Hub) Run() {
+	defer close(h.done)
 	for {
 		select {
+		case <-h.quit:
+			h.closeClients()
+			return
+
 		case client := <-h.register:
 			h.clients[client] = true
 
@@ -146,8 +157,58 @@ func (h *Hub) Run() {
 	}
 }
 
+// closeClients sends every client a going-away close frame and ends its
+// writePump, including clients still waiting to be registered.
+func (h *Hub) closeClients() {
+	for pending := true; pending; {
+		select {
+		case c := <-h.register:
+			h.clients[c] = true
+		default:
+			pending = false
+		}
+	}
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	deadline := time.Now().Add(writeWait)
+	for c := range h.clients {
+		// WriteControl may be called concurrently with writePump's writes.
+		_ = c.conn.WriteControl(websocket.CloseMessage, msg, deadline)
+		close(c.send)
+		delete(h.clients, c)
+	}
+}
+
+// Stop makes Run close every client and return. It is safe to call more
+// than once.
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() { close(h.quit) })
+}
+
+// Register adds a client, unless the hub has stopped. Clients go through
+// HubRegistry.Register, which also refuses a hub that is stopping.
+func (h *Hub) Register(c *Client) bool {
+	select {
+	case h.register <- c:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// Unregister removes a client; a stopped hub has already let go of it.
+func (h *Hub) Unregister(c *Client) {
+	select {
+	case h.unregister <- c:
+	case <-h.done:
+	}
+}
+
 func (h *Hub) KickUser(userID int) {
-	h.kickUser <- userID
+	select {
+	case h.kickUser <- userID:
+	case <-h.done:
+	}
 }
 
 func (h *Hub) ReplyToClient(target *Client, message []byte) {
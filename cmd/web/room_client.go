@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"charactersheet.iociveteres.net/internal/models"
 	"github.com/gorilla/websocket"
 )
 
@@ -22,6 +27,9 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 4096
+
+	// Time allowed to authorize and handle one message from the peer.
+	wsMessageTimeout = 10 * time.Second
 )
 
 var (
@@ -45,10 +53,72 @@ type Client struct {
 	infoLog  *log.Logger
 	userID   int
 	timeZone *time.Location
+	// ctx is cancelled when the client disconnects, ending its work in
+	// flight.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type wsHandler func(ctx context.Context, client *Client, hub *Hub, raw []byte)
 
+// wsPermission is what a client needs before a message of some type is
+// handled: at least Role in the room and, with SheetEdit, the right to edit
+// the sheet the message names, which must be a sheet of the room. Handlers
+// and models may check more, such as who owns a folder.
+type wsPermission struct {
+	Role      models.RoomRole
+	SheetEdit bool
+}
+
+var (
+	wsMember     = wsPermission{Role: models.RolePlayer}
+	wsSheetEdit  = wsPermission{Role: models.RolePlayer, SheetEdit: true}
+	wsGamemaster = wsPermission{Role: models.RoleGamemaster}
+)
+
+// wsPermissions holds the permission for every message type of
+// buildWSHandlerMap. readPump refuses any type that is missing here.
+var wsPermissions = map[string]wsPermission{
+	"newCharacter":          wsMember,
+	"deleteCharacter":       wsSheetEdit,
+	"changeSheetVisibility": wsSheetEdit,
+	"createFolder":          wsMember,
+	"updateFolder":          wsMember,
+	"deleteFolder":          wsMember,
+	"reorderFolders":        wsMember,
+	"moveSheetToFolder":     wsSheetEdit,
+	"newInviteLink":         wsGamemaster,
+	"kickPlayer":            wsGamemaster,
+	"changePlayerRole":      wsGamemaster,
+	"chatMessage":           wsMember,
+	"attackRoll":            wsSheetEdit,
+	"damageRoll":            wsSheetEdit,
+	"psychicTest":           wsSheetEdit,
+	"techPower":             wsSheetEdit,
+	"initiativeAdd":         wsGamemaster,
+	"initiativeRoll":        wsGamemaster,
+	"initiativeSort":        wsGamemaster,
+	"initiativeNext":        wsGamemaster,
+	"initiativeDelay":       wsGamemaster,
+	"initiativeAct":         wsGamemaster,
+	"initiativeRemove":      wsGamemaster,
+	"initiativeClear":       wsGamemaster,
+	"deleteMessage":         wsGamemaster,
+	"chatHistory":           wsMember,
+	"createItem":            wsSheetEdit,
+	"change":                wsSheetEdit,
+	"batch":                 wsSheetEdit,
+	"positionsChanged":      wsSheetEdit,
+	"deleteItem":            wsSheetEdit,
+	"moveItemBetweenGrids":  wsSheetEdit,
+	"undo":                  wsSheetEdit,
+	"redo":                  wsSheetEdit,
+	"dicePresetUpdated":     wsMember,
+	"autocomplete":          wsMember,
+	"autocompleteApply":     wsSheetEdit,
+	"ephemeral":             wsMember,
+}
+
 func (app *application) buildWSHandlerMap() map[string]wsHandler {
 	return map[string]wsHandler{
 		"newCharacter":          app.newCharacterSheetHandler,
@@ -63,6 +133,18 @@ func (app *application) buildWSHandlerMap() map[string]wsHandler {
 		"kickPlayer":            app.kickPlayerHandler,
 		"changePlayerRole":      app.changePlayerRoleHandler,
 		"chatMessage":           app.chatMessageHandler,
+		"attackRoll":            app.attackRollHandler,
+		"damageRoll":            app.damageRollHandler,
+		"psychicTest":           app.psychicTestHandler,
+		"techPower":             app.techPowerHandler,
+		"initiativeAdd":         app.initiativeAddHandler,
+		"initiativeRoll":        app.initiativeRollHandler,
+		"initiativeSort":        app.initiativeSortHandler,
+		"initiativeNext":        app.initiativeNextHandler,
+		"initiativeDelay":       app.initiativeDelayHandler,
+		"initiativeAct":         app.initiativeActHandler,
+		"initiativeRemove":      app.initiativeRemoveHandler,
+		"initiativeClear":       app.initiativeClearHandler,
 		"deleteMessage":         app.deleteMessageHandler,
 		"chatHistory":           app.chatHistoryHandler,
 		"createItem":            app.CreateItemHandler,
@@ -71,10 +153,104 @@ func (app *application) buildWSHandlerMap() map[string]wsHandler {
 		"positionsChanged":      app.positionsChangedHandler,
 		"deleteItem":            app.deleteItemHandler,
 		"moveItemBetweenGrids":  app.moveItemBetweenGridsHandler,
+		"undo":                  app.undoHandler,
+		"redo":                  app.redoHandler,
 		"dicePresetUpdated":     app.updateDicePresetHandler,
 		"autocomplete":          app.autocompleteQueryHandler,
 		"autocompleteApply":     app.autocompleteApplyHandler,
+		"ephemeral":             app.ephemeralHandler,
+	}
+}
+
+// authorizeWS checks the client against the permission for a message type
+// and returns the client's role in the room, failing with
+// models.ErrPermissionDenied when it falls short.
+func (app *application) authorizeWS(ctx context.Context, c *Client, msgType string, raw []byte) (models.RoomRole, error) {
+	perm, ok := wsPermissions[msgType]
+	if !ok {
+		return "", models.ErrPermissionDenied
+	}
+
+	role, err := app.models.RoomMembers.GetRole(ctx, c.hub.roomID, c.userID)
+	if errors.Is(err, models.ErrNoRecord) {
+		return "", models.ErrPermissionDenied
+	}
+	if err != nil {
+		return "", err
+	}
+	if !role.AtLeast(perm.Role) {
+		return "", models.ErrPermissionDenied
+	}
+	if !perm.SheetEdit {
+		return role, nil
+	}
+
+	sheetID, err := strconv.Atoi(messageSheetID(raw))
+	if err != nil {
+		return "", models.ErrPermissionDenied
+	}
+	sheet, err := app.models.CharacterSheets.GetWithPermission(ctx, c.userID, sheetID)
+	if err != nil {
+		return "", err
+	}
+	if !sheet.CanEdit || sheet.CharacterSheet.RoomID != c.hub.roomID {
+		return "", models.ErrPermissionDenied
 	}
+	return role, nil
+}
+
+// wsRole is the client's role in the room, as authorizeWS found it before
+// the message was handed to its handler.
+func wsRole(ctx context.Context) models.RoomRole {
+	role, _ := ctx.Value(roomRoleContextKey).(models.RoomRole)
+	return role
+}
+
+// messageSheetID is the sheet a message names, or "" if it names none.
+// Messages name their sheet as "sheetID" or "sheetId", as a string or a
+// number; field names match case-insensitively.
+func messageSheetID(raw []byte) string {
+	var ref struct {
+		SheetID json.RawMessage `json:"sheetID"`
+	}
+	if err := json.Unmarshal(raw, &ref); err != nil {
+		return ""
+	}
+	return strings.Trim(string(ref.SheetID), `"`)
+}
+
+// messageOrderKey is the key that keeps a message in order behind the
+// client's earlier ones: the sheet it writes to. A damage roll with apply
+// set writes the wounds to its target, so it is ordered by the target sheet
+// rather than by the attacker's.
+func messageOrderKey(job wsJob) string {
+	if job.Type == "damageRoll" {
+		var ref struct {
+			TargetSheetID json.RawMessage `json:"targetSheetID"`
+			Apply         bool            `json:"apply"`
+		}
+		if err := json.Unmarshal(job.Raw, &ref); err == nil && ref.Apply {
+			return strings.Trim(string(ref.TargetSheetID), `"`)
+		}
+	}
+	return messageSheetID(job.Raw)
+}
+
+// handleWS authorizes and handles one message under its own deadline,
+// which also ends when the client disconnects.
+func (app *application) handleWS(c *Client, h wsHandler, job wsJob) {
+	if c.ctx.Err() != nil {
+		// Left in a queue when the client went away.
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, wsMessageTimeout)
+	defer cancel()
+
+	role, err := app.authorizeWS(ctx, c, job.Type, job.Raw)
+	if app.wsModelError(c.hub, c, err, job.EventID, "authorize "+job.Type) {
+		return
+	}
+	h(context.WithValue(ctx, roomRoleContextKey, role), c, c.hub, job.Raw)
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -85,8 +261,16 @@ func (app *application) buildWSHandlerMap() map[string]wsHandler {
 func (c *Client) readPump(app *application) {
 	handlers := app.buildWSHandlerMap()
 
+	pool := newWSPool(app.wsWorkers, func(job wsJob) {
+		app.handleWS(c, handlers[job.Type], job)
+	})
+
 	defer func() {
-		c.hub.unregister <- c
+		// Cancel work in flight before waiting for the workers to finish.
+		c.cancel()
+		pool.Close()
+		c.hub.Unregister(c)
+		app.hubs.Release(c.hub)
 		c.conn.Close()
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
@@ -108,19 +292,23 @@ func (c *Client) readPump(app *application) {
 		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
 
 		var base struct {
-			Type string `json:"type"`
+			Type    string `json:"type"`
+			EventID string `json:"eventID"`
 		}
 		if err := json.Unmarshal(message, &base); err != nil {
 			c.infoLog.Printf("invalid json from client: %v", err)
 			continue
 		}
 
-		ctx := context.Background()
-
-		if h, ok := handlers[base.Type]; ok {
-			h(ctx, c, c.hub, message)
+		if _, ok := handlers[base.Type]; ok {
+			if !pool.Submit(wsJob{Type: base.Type, EventID: base.EventID, Raw: message}) {
+				c.infoLog.Printf("dropped %q from user=%d: queue full", base.Type, c.userID)
+				c.hub.ReplyToClient(c, app.wsClientError(base.EventID, "busy", http.StatusTooManyRequests))
+			}
 		} else {
-			c.hub.BroadcastAll(message)
+			// Nothing is relayed unchecked; presence goes through "ephemeral".
+			c.infoLog.Printf("unknown message type %q from user=%d", base.Type, c.userID)
+			c.hub.ReplyToClient(c, app.wsClientError(base.EventID, "unknown_type", http.StatusBadRequest))
 		}
 	}
 }
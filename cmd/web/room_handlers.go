@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -20,14 +23,24 @@ import (
 // SheetWs handles websocket requests from the peer.
 func (app *application) SheetWs(roomID int, w http.ResponseWriter, r *http.Request) {
 	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if err := app.authorizeRoom(r.Context(), roomID, userID); err != nil {
+		app.authorizationError(w, err)
+		return
+	}
+
+	hub, err := app.hubs.Acquire(roomID)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		app.hubs.Release(hub)
 		log.Println(err)
 		return
 	}
 
-	hub := app.GetOrInitHub(roomID)
-
 	client := &Client{
 		hub:      hub,
 		conn:     conn,
@@ -37,7 +50,15 @@ func (app *application) SheetWs(roomID int, w http.ResponseWriter, r *http.Reque
 		userID:   userID,
 		timeZone: getTimeLocation(r),
 	}
-	hub.register <- client
+	// The request's context ends when this handler returns, so the
+	// client's own outlives it.
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	if !app.hubs.Register(hub, client) {
+		client.cancel()
+		app.hubs.Release(hub)
+		conn.Close()
+		return
+	}
 
 	go client.writePump(app)
 	go client.readPump(app)
@@ -49,6 +70,11 @@ func (app *application) wsModelError(hub *Hub, client *Client, err error, eventI
 	if err == nil {
 		return false
 	}
+	var conflict *models.ConflictError
+	if errors.As(err, &conflict) {
+		hub.ReplyToClient(client, app.wsConflict(eventID, conflict))
+		return true
+	}
 	if err == models.ErrPermissionDenied || err == models.ErrNoRecord {
 		hub.ReplyToClient(client, app.wsClientError(eventID, "permission", http.StatusForbidden))
 		return true
@@ -57,6 +83,27 @@ func (app *application) wsModelError(hub *Hub, client *Client, err error, eventI
 	return true
 }
 
+type sheetRestoredMsg struct {
+	Type    string `json:"type"`
+	SheetID string `json:"sheetID"`
+	Version int    `json:"version"`
+}
+
+// sheetRestoredHandler tells the room that part of a sheet was put back to
+// an earlier version, so whoever has it open reloads it.
+func (app *application) sheetRestoredHandler(hub *Hub, sheetID, version int) {
+	b, err := json.Marshal(&sheetRestoredMsg{
+		Type:    "sheetRestored",
+		SheetID: strconv.Itoa(sheetID),
+		Version: version,
+	})
+	if err != nil {
+		app.errorLog.Printf("marshal sheet restored message: %v", err)
+		return
+	}
+	hub.BroadcastAll(b)
+}
+
 type newCharacterSheetMsg struct {
 	Type    string `json:"type"`
 	EventID string `json:"eventID"`
@@ -567,14 +614,18 @@ type newChatMessageMsg struct {
 }
 
 type newChatMessageSentMsg struct {
-	Type          string  `json:"type"`
-	EventID       string  `json:"eventID"`
-	MessageID     int     `json:"messageId"`
-	UserID        int     `json:"userId"`
-	UserName      string  `json:"userName"`
-	MessageBody   string  `json:"messageBody"`
-	CommandResult *string `json:"commandResult,omitempty"`
-	CreatedAt     string  `json:"created"`
+	Type          string                   `json:"type"`
+	EventID       string                   `json:"eventID"`
+	MessageID     int                      `json:"messageId"`
+	UserID        int                      `json:"userId"`
+	UserName      string                   `json:"userName"`
+	MessageBody   string                   `json:"messageBody"`
+	CommandResult *string                  `json:"commandResult,omitempty"`
+	CommandData   json.RawMessage          `json:"commandData,omitempty"`
+	Recipients    []int                    `json:"recipients,omitempty"`
+	Visibility    models.MessageVisibility `json:"visibility"`
+	Redacted      bool                     `json:"redacted,omitempty"`
+	CreatedAt     string                   `json:"created"`
 }
 
 func (app *application) chatMessageHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
@@ -584,38 +635,554 @@ func (app *application) chatMessageHandler(ctx context.Context, client *Client,
 		return
 	}
 
-	var commandResult *string
+	newMessage := models.NewMessage{MessageBody: msg.MessageBody}
 	if strings.HasPrefix(msg.MessageBody, "/") {
-		if r := commands.ParseAndExecuteCommand(msg.MessageBody); r.Success {
-			commandResult = &r.Result
+		env := &commands.Env{UserID: client.userID, RoomID: hub.roomID, Models: &app.models, Seeds: hub.rng}
+		r := commands.ParseAndExecuteCommand(ctx, env, msg.MessageBody)
+		if r.Private {
+			app.replyCommandResult(hub, client, msg.EventID, msg.MessageBody, r)
+			return
+		}
+		switch {
+		case len(r.Recipients) > 0:
+			// Whispers are stored as plain text addressed to their recipients
+			newMessage.MessageBody = r.Result
+			newMessage.Recipients = r.Recipients
+		case r.Success:
+			newMessage.CommandResult = &r.Result
+			newMessage.Visibility = r.Visibility
+			newMessage.Audit = r.Audit
+			if r.Roll != nil {
+				data, err := json.Marshal(r.Roll)
+				if err != nil {
+					hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("marshal roll result: %w", err), msg.EventID, "internal"))
+					return
+				}
+				newMessage.CommandData = data
+			}
 		}
 	}
 
-	message, err := app.models.RoomMessages.CreateWithUsername(ctx, client.userID, hub.roomID, msg.MessageBody, commandResult)
+	message, err := app.models.RoomMessages.CreateWithUsername(ctx, client.userID, hub.roomID, newMessage)
 	if app.wsModelError(hub, client, err, msg.EventID, "create chat message") {
 		return
 	}
 
-	chatMessageSent := &newChatMessageSentMsg{
+	chatMessageSentJSON, err := marshalChatMessageSent(msg.EventID, message)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "internal"))
+		return
+	}
+
+	switch {
+	case len(newMessage.Recipients) > 0:
+		// Whispers reach every open connection of the sender and the recipients only
+		delivered := map[int]bool{}
+		for _, userID := range append([]int{client.userID}, newMessage.Recipients...) {
+			if delivered[userID] {
+				continue
+			}
+			delivered[userID] = true
+			hub.BroadcastToUser(userID, chatMessageSentJSON)
+		}
+
+	case message.Message.Visibility != models.MessagePublic:
+		// Secret rolls: whoever may not see the result gets a placeholder
+		members, err := app.models.RoomMembers.ListWithNames(ctx, hub.roomID)
+		if app.wsModelError(hub, client, err, msg.EventID, "list room members") {
+			return
+		}
+		redactedJSON, err := marshalChatMessageSent(msg.EventID, message.Redacted())
+		if err != nil {
+			hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "internal"))
+			return
+		}
+		for _, m := range members {
+			if message.Message.VisibleTo(m.UserID, m.Role) {
+				hub.BroadcastToUser(m.UserID, chatMessageSentJSON)
+			} else {
+				hub.BroadcastToUser(m.UserID, redactedJSON)
+			}
+		}
+
+	default:
+		hub.BroadcastAll(chatMessageSentJSON)
+	}
+}
+
+func marshalChatMessageSent(eventID string, message models.MessageWithName) ([]byte, error) {
+	data, err := json.Marshal(&newChatMessageSentMsg{
 		Type:          "chatMessage",
-		EventID:       msg.EventID,
+		EventID:       eventID,
 		MessageID:     message.Message.ID,
 		UserID:        message.Message.UserID,
 		UserName:      message.Username,
-		MessageBody:   msg.MessageBody,
+		MessageBody:   message.Message.MessageBody,
 		CommandResult: message.Message.CommandResult,
+		CommandData:   message.Message.CommandData,
+		Recipients:    message.Message.Recipients,
+		Visibility:    message.Message.Visibility,
+		Redacted:      message.Message.Redacted,
 		CreatedAt:     message.Message.CreatedAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal chatMessageSent message: %w", err)
+	}
+	return data, nil
+}
+
+type attackRollMsg struct {
+	Type    string `json:"type"`
+	EventID string `json:"eventID"`
+	SheetID string `json:"sheetID"`
+	Path    string `json:"path"`
+}
+
+// attackRollHandler rolls an attack with the weapon at path, using the
+// weapon's roll dialog settings as stored on the sheet, and posts the result
+// to the room's chat.
+func (app *application) attackRollHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	var msg attackRollMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal attackRoll message: %w", err), "", "validation"))
+		return
+	}
+
+	sheetID, err := strconv.Atoi(msg.SheetID)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("invalid sheetID %q: %w", msg.SheetID, err), msg.EventID, "validation"))
+		return
+	}
+
+	sheet, err := app.models.CharacterSheets.GetWithPermission(ctx, client.userID, sheetID)
+	if app.wsModelError(hub, client, err, msg.EventID, "get sheet for attack roll") {
+		return
+	}
+	// Only whoever plays the character may attack with it
+	if !sheet.CanEdit || sheet.CharacterSheet.RoomID != hub.roomID {
+		hub.ReplyToClient(client, app.wsClientError(msg.EventID, "permission", http.StatusForbidden))
+		return
+	}
+
+	profile, err := commands.AttackProfileFor(sheet.CharacterSheet.Content, parseJSONBPath(msg.Path))
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "validation"))
+		return
+	}
+
+	r := commands.RollAttack(profile, hub.rng.NextSeed())
+	if !r.Success {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("roll attack: %s", r.Result), msg.EventID, "internal"))
+		return
+	}
+	// Damage can only be rolled with the weapon that made the attack
+	r.Roll.Attack.SheetID = sheetID
+	r.Roll.Attack.Path = msg.Path
+	data, err := json.Marshal(r.Roll)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("marshal roll result: %w", err), msg.EventID, "internal"))
+		return
+	}
+
+	message, err := app.models.RoomMessages.CreateWithUsername(ctx, client.userID, hub.roomID, models.NewMessage{
+		MessageBody:   profile.MessageBody(),
+		CommandResult: &r.Result,
+		CommandData:   data,
+		Audit:         r.Audit,
+	})
+	if app.wsModelError(hub, client, err, msg.EventID, "create attack roll message") {
+		return
+	}
+
+	chatMessageSentJSON, err := marshalChatMessageSent(msg.EventID, message)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "internal"))
+		return
+	}
+	hub.BroadcastAll(chatMessageSentJSON)
+}
+
+type psychicTestMsg struct {
+	Type    string `json:"type"`
+	EventID string `json:"eventID"`
+	SheetID string `json:"sheetID"`
+	Path    string `json:"path"`
+}
+
+// psychicTestHandler rolls the focus power test of the power at path, using
+// the power's roll dialog settings as stored on the sheet, along with any
+// psychic phenomena and perils it draws, and posts the result to the room's
+// chat.
+func (app *application) psychicTestHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	var msg psychicTestMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal psychicTest message: %w", err), "", "validation"))
+		return
+	}
+
+	sheetID, err := strconv.Atoi(msg.SheetID)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("invalid sheetID %q: %w", msg.SheetID, err), msg.EventID, "validation"))
+		return
+	}
+
+	sheet, err := app.models.CharacterSheets.GetWithPermission(ctx, client.userID, sheetID)
+	if app.wsModelError(hub, client, err, msg.EventID, "get sheet for psychic test") {
+		return
+	}
+	if !sheet.CanEdit || sheet.CharacterSheet.RoomID != hub.roomID {
+		hub.ReplyToClient(client, app.wsClientError(msg.EventID, "permission", http.StatusForbidden))
+		return
+	}
+
+	profile, err := commands.PsychicProfileFor(sheetID, sheet.CharacterSheet.Content, parseJSONBPath(msg.Path))
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "validation"))
+		return
 	}
 
-	chatMessageSentJSON, err := json.Marshal(chatMessageSent)
+	var tables *gamedata.PsychicTables
+	if app.gamedata != nil {
+		tables = app.gamedata.Psychic
+	}
+	r := commands.RollPsychicTest(profile, tables, hub.rng.NextSeed())
+	if !r.Success {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("roll psychic test: %s", r.Result), msg.EventID, "internal"))
+		return
+	}
+	data, err := json.Marshal(r.Roll)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("marshal roll result: %w", err), msg.EventID, "internal"))
+		return
+	}
+
+	message, err := app.models.RoomMessages.CreateWithUsername(ctx, client.userID, hub.roomID, models.NewMessage{
+		MessageBody:   profile.MessageBody(),
+		CommandResult: &r.Result,
+		CommandData:   data,
+		Audit:         r.Audit,
+	})
+	if app.wsModelError(hub, client, err, msg.EventID, "create psychic test message") {
+		return
+	}
+
+	chatMessageSentJSON, err := marshalChatMessageSent(msg.EventID, message)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "internal"))
+		return
+	}
+	hub.BroadcastAll(chatMessageSentJSON)
+}
+
+type techPowerMsg struct {
+	Type    string `json:"type"`
+	EventID string `json:"eventID"`
+	SheetID string `json:"sheetID"`
+	Path    string `json:"path"`
+}
+
+// Where a sheet keeps the points tech powers are paid with.
+const (
+	currentCognitionPath = "technoArcana.currentCognition"
+	currentEnergyPath    = "technoArcana.currentEnergy"
+)
+
+// techPowerHandler activates the tech power at path: its price is taken
+// from the sheet's cognition and energy, the new amounts are broadcast like
+// any other edit, and the power's test is rolled and posted to chat. A sheet
+// that cannot pay is told so privately and nothing is spent or rolled.
+func (app *application) techPowerHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	var msg techPowerMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal techPower message: %w", err), "", "validation"))
+		return
+	}
+
+	sheetID, err := strconv.Atoi(msg.SheetID)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("invalid sheetID %q: %w", msg.SheetID, err), msg.EventID, "validation"))
+		return
+	}
+
+	sheet, err := app.models.CharacterSheets.GetWithPermission(ctx, client.userID, sheetID)
+	if app.wsModelError(hub, client, err, msg.EventID, "get sheet for tech power") {
+		return
+	}
+	if !sheet.CanEdit || sheet.CharacterSheet.RoomID != hub.roomID {
+		hub.ReplyToClient(client, app.wsClientError(msg.EventID, "permission", http.StatusForbidden))
+		return
+	}
+
+	profile, err := commands.TechPowerProfileFor(sheetID, sheet.CharacterSheet.Content, parseJSONBPath(msg.Path))
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "validation"))
+		return
+	}
+
+	// Pay before rolling, so a power is never rolled without being paid for
+	left, version, err := app.models.CharacterSheets.SpendArcana(ctx, client.userID, sheetID, profile.Price)
+	if errors.Is(err, models.ErrInsufficientArcana) {
+		app.replyCommandResult(hub, client, msg.EventID, profile.MessageBody(), &commands.CommandResult{
+			Success: false,
+			Result: fmt.Sprintf("%s costs %d cognition, %d energy; %d cognition, %d energy left",
+				profile.Power, profile.Price.Cognition, profile.Price.Energy, left.Cognition, left.Energy),
+		})
+		return
+	}
+	if app.wsModelError(hub, client, err, msg.EventID, "spend techno-arcana") {
+		return
+	}
+
+	if !profile.Price.IsZero() {
+		for _, c := range []struct {
+			path  string
+			value int
+		}{
+			{currentCognitionPath, left.Cognition},
+			{currentEnergyPath, left.Energy},
+		} {
+			changeJSON, err := json.Marshal(&changeMsg{
+				Type:    "change",
+				EventID: msg.EventID,
+				SheetID: msg.SheetID,
+				Version: version,
+				Path:    c.path,
+				Change:  json.RawMessage(strconv.Itoa(c.value)),
+			})
+			if err != nil {
+				hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "internal"))
+				return
+			}
+			hub.BroadcastAll(changeJSON)
+		}
+	}
+
+	r := commands.RollTechPower(profile, hub.rng.NextSeed())
+	if !r.Success {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("roll tech power: %s", r.Result), msg.EventID, "internal"))
+		return
+	}
+	data, err := json.Marshal(r.Roll)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("marshal roll result: %w", err), msg.EventID, "internal"))
+		return
+	}
+
+	message, err := app.models.RoomMessages.CreateWithUsername(ctx, client.userID, hub.roomID, models.NewMessage{
+		MessageBody:   profile.MessageBody(),
+		CommandResult: &r.Result,
+		CommandData:   data,
+		Audit:         r.Audit,
+	})
+	if app.wsModelError(hub, client, err, msg.EventID, "create tech power message") {
+		return
+	}
+
+	chatMessageSentJSON, err := marshalChatMessageSent(msg.EventID, message)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "internal"))
+		return
+	}
+	hub.BroadcastAll(chatMessageSentJSON)
+}
+
+type damageRollMsg struct {
+	Type          string `json:"type"`
+	EventID       string `json:"eventID"`
+	SheetID       string `json:"sheetID"`
+	Path          string `json:"path"`
+	TargetSheetID string `json:"targetSheetID"`
+	MessageID     int    `json:"messageID"` // the attack roll that hit
+	Apply         bool   `json:"apply"`     // add the wounds to the target's sheet
+}
+
+// damageRollHandler rolls the damage of the weapon at path for every hit of
+// an attack roll posted earlier, takes the target's armour off each hit and
+// posts the result to the room's chat. With apply set the wounds are also
+// added to the target's sheet.
+func (app *application) damageRollHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	var msg damageRollMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal damageRoll message: %w", err), "", "validation"))
+		return
+	}
+
+	sheetID, err := strconv.Atoi(msg.SheetID)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("invalid sheetID %q: %w", msg.SheetID, err), msg.EventID, "validation"))
+		return
+	}
+	targetID, err := strconv.Atoi(msg.TargetSheetID)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("invalid targetSheetID %q: %w", msg.TargetSheetID, err), msg.EventID, "validation"))
+		return
+	}
+
+	sheet, err := app.models.CharacterSheets.GetWithPermission(ctx, client.userID, sheetID)
+	if app.wsModelError(hub, client, err, msg.EventID, "get sheet for damage roll") {
+		return
+	}
+	if !sheet.CanEdit || sheet.CharacterSheet.RoomID != hub.roomID {
+		hub.ReplyToClient(client, app.wsClientError(msg.EventID, "permission", http.StatusForbidden))
+		return
+	}
+	target, err := app.models.CharacterSheets.GetWithPermission(ctx, client.userID, targetID)
+	if app.wsModelError(hub, client, err, msg.EventID, "get target sheet for damage roll") {
+		return
+	}
+	if !target.CanView || target.CharacterSheet.RoomID != hub.roomID || msg.Apply && !target.CanEdit {
+		hub.ReplyToClient(client, app.wsClientError(msg.EventID, "permission", http.StatusForbidden))
+		return
+	}
+
+	// The hit locations come from the stored attack, so they cannot be picked
+	attackMessage, err := app.models.RoomMessages.Get(ctx, msg.MessageID)
+	if app.wsModelError(hub, client, err, msg.EventID, "get attack roll message") {
+		return
+	}
+	if attackMessage.RoomID != hub.roomID || attackMessage.UserID != client.userID {
+		hub.ReplyToClient(client, app.wsClientError(msg.EventID, "permission", http.StatusForbidden))
+		return
+	}
+	var attackRoll commands.RollResult
+	if attackMessage.CommandData != nil {
+		if err := json.Unmarshal(attackMessage.CommandData, &attackRoll); err != nil {
+			hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal attack roll: %w", err), msg.EventID, "internal"))
+			return
+		}
+	}
+	if attackRoll.Attack == nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("message %d is not an attack roll", msg.MessageID), msg.EventID, "validation"))
+		return
+	}
+	path := parseJSONBPath(msg.Path)
+	if !attackRoll.Attack.MadeWith(sheetID, path) {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("message %d was not an attack with %s on sheet %d", msg.MessageID, msg.Path, sheetID), msg.EventID, "validation"))
+		return
+	}
+	if attackRoll.Attack.Resolved {
+		hub.ReplyToClient(client, app.wsClientError(msg.EventID, "conflict", http.StatusConflict))
+		return
+	}
+
+	profile, err := commands.DamageProfileFor(sheet.CharacterSheet.Content, path,
+		target.CharacterSheet.Content, attackRoll.Attack.Locations)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "validation"))
+		return
+	}
+
+	env := &commands.Env{UserID: client.userID, RoomID: hub.roomID, Models: &app.models}
+	r := commands.RollDamage(ctx, env, profile, hub.rng.NextSeed())
+	if !r.Success {
+		// A damage cell that doesn't parse is the player's to fix: tell them why
+		app.replyCommandResult(hub, client, msg.EventID, profile.MessageBody(), &r)
+		return
+	}
+	data, err := json.Marshal(r.Roll)
 	if err != nil {
-		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("marshal chatMessageSent message: %w", err), msg.EventID, "internal"))
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("marshal roll result: %w", err), msg.EventID, "internal"))
+		return
+	}
+
+	// Claim the attack before anything is applied or shown, so a second
+	// damage roll for it, even a concurrent one, is turned away. A failure
+	// past this point leaves the attack resolved rather than rerollable.
+	err = app.models.RoomMessages.ResolveAttack(ctx, client.userID, hub.roomID, msg.MessageID)
+	if errors.Is(err, models.ErrAttackResolved) {
+		hub.ReplyToClient(client, app.wsClientError(msg.EventID, "conflict", http.StatusConflict))
+		return
+	}
+	if app.wsModelError(hub, client, err, msg.EventID, "resolve attack roll") {
+		return
+	}
+
+	if msg.Apply {
+		if !app.applyWounds(ctx, client, hub, msg.EventID, target.CharacterSheet, r.Roll.Damage.Wounds) {
+			return
+		}
+	}
+
+	message, err := app.models.RoomMessages.CreateWithUsername(ctx, client.userID, hub.roomID, models.NewMessage{
+		MessageBody:   profile.MessageBody(),
+		CommandResult: &r.Result,
+		CommandData:   data,
+		Audit:         r.Audit,
+	})
+	if app.wsModelError(hub, client, err, msg.EventID, "create damage roll message") {
 		return
 	}
 
+	chatMessageSentJSON, err := marshalChatMessageSent(msg.EventID, message)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "internal"))
+		return
+	}
 	hub.BroadcastAll(chatMessageSentJSON)
 }
 
+// woundsCurPath is where a sheet keeps the wounds its character has taken.
+const woundsCurPath = "armour.woundsCur"
+
+// applyWounds adds wounds to the wounds the target has taken and tells the
+// room about the change like any other edit. It reports whether it did; on
+// failure the client has already been answered.
+func (app *application) applyWounds(ctx context.Context, client *Client, hub *Hub, eventID string, target *models.CharacterSheet, wounds int) bool {
+	total, version, err := app.models.CharacterSheets.AddWounds(ctx, client.userID, target.ID, wounds)
+	if app.wsModelError(hub, client, err, eventID, "apply wounds") {
+		return false
+	}
+	change, err := json.Marshal(total)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, eventID, "internal"))
+		return false
+	}
+
+	changeJSON, err := json.Marshal(&changeMsg{
+		Type:    "change",
+		EventID: eventID,
+		SheetID: strconv.Itoa(target.ID),
+		Version: version,
+		Path:    woundsCurPath,
+		Change:  change,
+	})
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, eventID, "internal"))
+		return false
+	}
+	app.infoLog.Printf("Applied wounds sheet=%d wounds=%d", target.ID, wounds)
+	hub.BroadcastAll(changeJSON)
+	return true
+}
+
+type commandReplySentMsg struct {
+	Type          string `json:"type"`
+	EventID       string `json:"eventID"`
+	MessageBody   string `json:"messageBody"`
+	CommandResult string `json:"commandResult"`
+	Success       bool   `json:"success"`
+	CreatedAt     string `json:"created"`
+}
+
+// replyCommandResult sends a private command result back to the sender only.
+// It is neither stored nor broadcast.
+func (app *application) replyCommandResult(hub *Hub, client *Client, eventID, messageBody string, r *commands.CommandResult) {
+	commandReplyJSON, err := json.Marshal(&commandReplySentMsg{
+		Type:          "commandReply",
+		EventID:       eventID,
+		MessageBody:   messageBody,
+		CommandResult: r.Result,
+		Success:       r.Success,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("marshal commandReply message: %w", err), eventID, "internal"))
+		return
+	}
+
+	hub.ReplyToClient(client, commandReplyJSON)
+}
+
 type chatHistoryMsg struct {
 	Type    string `json:"type"`
 	EventID string `json:"eventID"`
@@ -641,10 +1208,11 @@ func (app *application) chatHistoryHandler(ctx context.Context, client *Client,
 		limit = 50
 	}
 
-	messagePage, err := app.models.RoomMessages.GetMessagePage(ctx, hub.roomID, msg.Offset, limit)
+	messagePage, err := app.models.RoomMessages.GetMessagePage(ctx, hub.roomID, client.userID, msg.Offset, limit)
 	if app.wsModelError(hub, client, err, msg.EventID, "get message page") {
 		return
 	}
+	messagePage.RedactFor(client.userID, wsRole(ctx))
 
 	chatHistorySentJSON, err := json.Marshal(&chatHistorySentMsg{
 		Type:        "chatHistory",
@@ -685,6 +1253,7 @@ type CreateItemMsg struct {
 	Type    string          `json:"type"`
 	EventID string          `json:"eventID"`
 	SheetID string          `json:"sheetID"`
+	Version int             `json:"version,omitempty"`
 	Path    string          `json:"path"`
 	ItemID  string          `json:"itemId"`
 	ItemPos models.Position `json:"itemPos"`
@@ -722,7 +1291,8 @@ func (app *application) CreateItemHandler(ctx context.Context, client *Client, h
 	}
 
 	app.infoLog.Printf("createItem persisted sheet=%d path=%s item=%s", sheetID, msg.Path, msg.ItemID)
-	hub.BroadcastFrom(client, raw)
+	msg.Version = version
+	app.broadcastEdit(client, hub, &msg)
 	hub.ReplyToClient(client, app.wsOK(msg.EventID, version))
 }
 
@@ -759,16 +1329,28 @@ func (app *application) changeHandler(ctx context.Context, client *Client, hub *
 		return
 	}
 
-	version, err := app.models.CharacterSheets.ChangeField(ctx, client.userID, sheetID, path, msg.Change)
+	version, err := app.models.CharacterSheets.ChangeField(ctx, client.userID, sheetID, msg.Version, path, msg.Change)
 	if app.wsModelError(hub, client, err, msg.EventID, "change field") {
 		return
 	}
 
 	app.infoLog.Printf("Changed value sheet=%d path=%s change=%s", sheetID, msg.Path, msg.Change)
-	hub.BroadcastFrom(client, raw)
+	msg.Version = version
+	app.broadcastEdit(client, hub, &msg)
 	hub.ReplyToClient(client, app.wsOK(msg.EventID, version))
 }
 
+// broadcastEdit passes an applied edit on to the rest of the room, carrying
+// the version it made so their next edits are based on it.
+func (app *application) broadcastEdit(client *Client, hub *Hub, msg any) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		app.errorLog.Printf("marshal edit broadcast: %v", err)
+		return
+	}
+	hub.BroadcastFrom(client, b)
+}
+
 type batchMsg struct {
 	Type    string          `json:"type"`
 	EventID string          `json:"eventID"`
@@ -802,13 +1384,14 @@ func (app *application) batchHandler(ctx context.Context, client *Client, hub *H
 		return
 	}
 
-	version, err := app.models.CharacterSheets.ApplyBatch(ctx, client.userID, sheetID, path, msg.Changes)
+	version, err := app.models.CharacterSheets.ApplyBatch(ctx, client.userID, sheetID, msg.Version, path, msg.Changes)
 	if app.wsModelError(hub, client, err, msg.EventID, "batch change") {
 		return
 	}
 
 	app.infoLog.Printf("Batch applied sheet=%d path=%s batch=%s", sheetID, msg.Path, string(msg.Changes))
-	hub.BroadcastFrom(client, raw)
+	msg.Version = version
+	app.broadcastEdit(client, hub, &msg)
 	hub.ReplyToClient(client, app.wsOK(msg.EventID, version))
 }
 
@@ -839,13 +1422,14 @@ func (app *application) positionsChangedHandler(ctx context.Context, client *Cli
 		return
 	}
 
-	version, err := app.models.CharacterSheets.ReplacePositions(ctx, client.userID, sheetID, parseJSONBPath(msg.Path), msg.Positions)
+	version, err := app.models.CharacterSheets.ReplacePositions(ctx, client.userID, sheetID, msg.Version, parseJSONBPath(msg.Path), msg.Positions)
 	if app.wsModelError(hub, client, err, msg.EventID, "replace positions") {
 		return
 	}
 
 	app.infoLog.Printf("positionsChanged applied: sheet=%d path=%s", sheetID, msg.Path)
-	hub.BroadcastFrom(client, raw)
+	msg.Version = version
+	app.broadcastEdit(client, hub, &msg)
 	hub.ReplyToClient(client, app.wsOK(msg.EventID, version))
 }
 
@@ -853,6 +1437,7 @@ type moveItemBetweenGridsMsg struct {
 	Type       string          `json:"type"`
 	EventID    string          `json:"eventID"`
 	SheetID    string          `json:"sheetID"`
+	Version    int             `json:"version,omitempty"`
 	FromPath   string          `json:"fromPath"`
 	ToPath     string          `json:"toPath"`
 	ItemID     string          `json:"itemId"`
@@ -896,7 +1481,8 @@ func (app *application) moveItemBetweenGridsHandler(ctx context.Context, client
 	}
 
 	app.infoLog.Printf("Item moved between grids: sheet=%d from=%s to=%s item=%s", sheetID, msg.FromPath, msg.ToPath, msg.ItemID)
-	hub.BroadcastFrom(client, raw)
+	msg.Version = version
+	app.broadcastEdit(client, hub, &msg)
 	hub.ReplyToClient(client, app.wsOK(msg.EventID, version))
 }
 
@@ -928,16 +1514,164 @@ func (app *application) deleteItemHandler(ctx context.Context, client *Client, h
 		return
 	}
 
-	version, err := app.models.CharacterSheets.DeleteItem(ctx, client.userID, sheetID, path)
+	version, err := app.models.CharacterSheets.DeleteItem(ctx, client.userID, sheetID, msg.Version, path)
 	if app.wsModelError(hub, client, err, msg.EventID, "deleteItem") {
 		return
 	}
 
 	app.infoLog.Printf("Item deleted: sheet=%d path=%s", sheetID, msg.Path)
-	hub.BroadcastFrom(client, raw)
+	msg.Version = version
+	app.broadcastEdit(client, hub, &msg)
 	hub.ReplyToClient(client, app.wsOK(msg.EventID, version))
 }
 
+type undoMsg struct {
+	Type    string `json:"type"` // "undo" or "redo"
+	EventID string `json:"eventID"`
+	SheetID string `json:"sheetID"`
+}
+
+func (app *application) undoHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	app.revertSheetEdit(ctx, client, hub, raw, app.models.CharacterSheets.Undo)
+}
+
+func (app *application) redoHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	app.revertSheetEdit(ctx, client, hub, raw, app.models.CharacterSheets.Redo)
+}
+
+// revertSheetEdit undoes or redoes the caller's latest edit to a sheet and
+// sends the result to everyone, the caller included, as ordinary edits.
+func (app *application) revertSheetEdit(ctx context.Context, client *Client, hub *Hub, raw []byte, revert func(ctx context.Context, userID, sheetID int) (*models.SheetEdit, error)) {
+	var msg undoMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal undo message: %w", err), "", "validation"))
+		return
+	}
+
+	sheetID, err := strconv.Atoi(msg.SheetID)
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("invalid sheetID %q: %w", msg.SheetID, err), msg.EventID, "validation"))
+		return
+	}
+
+	sheet, err := app.models.CharacterSheets.GetWithPermission(ctx, client.userID, sheetID)
+	if app.wsModelError(hub, client, err, msg.EventID, "get sheet for "+msg.Type) {
+		return
+	}
+	if !sheet.CanEdit || sheet.CharacterSheet.RoomID != hub.roomID {
+		hub.ReplyToClient(client, app.wsClientError(msg.EventID, "permission", http.StatusForbidden))
+		return
+	}
+
+	edit, err := revert(ctx, client.userID, sheetID)
+	if err == models.ErrNothingToUndo || err == models.ErrNothingToRedo {
+		hub.ReplyToClient(client, app.wsClientError(msg.EventID, "not_found", http.StatusNotFound))
+		return
+	}
+	if app.wsModelError(hub, client, err, msg.EventID, msg.Type) {
+		return
+	}
+
+	for _, m := range sheetEditMessages(msg.EventID, msg.SheetID, edit) {
+		b, err := json.Marshal(m)
+		if err != nil {
+			hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "internal"))
+			return
+		}
+		hub.BroadcastAll(b)
+	}
+	app.infoLog.Printf("%s applied sheet=%d version=%d", msg.Type, sheetID, edit.Version)
+	hub.ReplyToClient(client, app.wsOK(msg.EventID, edit.Version))
+}
+
+// sheetEditMessages turns paths set by an undo or redo into the edits
+// clients already apply: whole items are created or deleted, grid layouts
+// repositioned, objects merged and anything else changed in place.
+func sheetEditMessages(eventID, sheetID string, edit *models.SheetEdit) []any {
+	values := make(map[string]json.RawMessage, len(edit.Values))
+	for _, v := range edit.Values {
+		values[strings.Join(v.Path, ".")] = v.Value
+	}
+	isItem := func(path []string) bool {
+		return len(path) >= 2 && path[len(path)-2] == "items"
+	}
+	// The items path of a layout path, e.g. gear.items.abc for gear.layouts.abc
+	itemsPath := func(path []string, i int) []string {
+		p := slices.Clone(path)
+		p[i] = "items"
+		return p
+	}
+
+	var msgs []any
+	for _, v := range edit.Values {
+		path, key := v.Path, strings.Join(v.Path, ".")
+		n := len(path)
+		switch {
+		case isItem(path) && v.Value == nil:
+			msgs = append(msgs, &deleteItemMsg{Type: "deleteItem", EventID: eventID, SheetID: sheetID, Version: edit.Version, Path: key})
+
+		case isItem(path):
+			layout := slices.Clone(path)
+			layout[n-2] = "layouts"
+			var pos models.Position
+			if b := values[strings.Join(layout, ".")]; b != nil {
+				json.Unmarshal(b, &pos)
+			}
+			msgs = append(msgs, &CreateItemMsg{
+				Type:    "createItem",
+				EventID: eventID,
+				SheetID: sheetID,
+				Version: edit.Version,
+				Path:    strings.Join(path[:n-1], "."),
+				ItemID:  path[n-1],
+				ItemPos: pos,
+				Init:    v.Value,
+			})
+
+		case n >= 2 && path[n-2] == "layouts":
+			// Goes with its item, unless only the item's place changed
+			if _, ok := values[strings.Join(itemsPath(path, n-2), ".")]; ok || v.Value == nil {
+				continue
+			}
+			var pos models.Position
+			json.Unmarshal(v.Value, &pos)
+			msgs = append(msgs, &positionsChangedMsg{
+				Type:      "positionsChanged",
+				EventID:   eventID,
+				SheetID:   sheetID,
+				Version:   edit.Version,
+				Path:      strings.Join(itemsPath(path[:n-1], n-2), "."),
+				Positions: map[string]models.Position{path[n-1]: pos},
+			})
+
+		case n >= 1 && path[n-1] == "layouts":
+			positions := map[string]models.Position{}
+			if v.Value != nil {
+				json.Unmarshal(v.Value, &positions)
+			}
+			msgs = append(msgs, &positionsChangedMsg{
+				Type:      "positionsChanged",
+				EventID:   eventID,
+				SheetID:   sheetID,
+				Version:   edit.Version,
+				Path:      strings.Join(itemsPath(path, n-1), "."),
+				Positions: positions,
+			})
+
+		case bytes.HasPrefix(bytes.TrimSpace(v.Value), []byte("{")):
+			msgs = append(msgs, &batchMsg{Type: "batch", EventID: eventID, SheetID: sheetID, Version: edit.Version, Path: key, Changes: v.Value})
+
+		default:
+			change := v.Value
+			if change == nil {
+				change = json.RawMessage("null")
+			}
+			msgs = append(msgs, &changeMsg{Type: "change", EventID: eventID, SheetID: sheetID, Version: edit.Version, Path: key, Change: change})
+		}
+	}
+	return msgs
+}
+
 type autocompleteMsg struct {
 	Type       string `json:"type"`
 	EventID    string `json:"eventID"`
@@ -1041,7 +1775,7 @@ func (app *application) autocompleteApplyHandler(ctx context.Context, client *Cl
 		return
 	}
 
-	version, err := app.models.CharacterSheets.ApplyBatch(ctx, client.userID, sheetID, path, changesJSON)
+	version, err := app.models.CharacterSheets.ApplyBatch(ctx, client.userID, sheetID, 0, path, changesJSON)
 	if app.wsModelError(hub, client, err, msg.EventID, "autocompleteApply batch") {
 		return
 	}
@@ -1071,3 +1805,333 @@ func (app *application) autocompleteApplyHandler(ctx context.Context, client *Cl
 
 	hub.BroadcastAll(broadcast)
 }
+
+type initiativeUpdatedMsg struct {
+	Type    string                    `json:"type"`
+	EventID string                    `json:"eventID"`
+	Tracker *models.InitiativeTracker `json:"tracker"`
+}
+
+type initiativeAddMsg struct {
+	Type       string `json:"type"`
+	EventID    string `json:"eventID"`
+	SheetID    string `json:"sheetID,omitempty"` // a sheet of the room, or empty for an NPC
+	Name       string `json:"name,omitempty"`
+	Expression string `json:"expression,omitempty"`
+}
+
+type initiativeEntryMsg struct {
+	Type    string `json:"type"`
+	EventID string `json:"eventID"`
+	EntryID string `json:"entryID"`
+}
+
+type initiativeMsg struct {
+	Type    string `json:"type"`
+	EventID string `json:"eventID"`
+}
+
+// updateInitiative applies update to the room's initiative tracker and
+// broadcasts the new state. Only gamemasters can change the tracker.
+func (app *application) updateInitiative(ctx context.Context, client *Client, hub *Hub, eventID string, update func(*models.InitiativeTracker) error) bool {
+	tracker, err := app.models.RoomInitiative.Update(ctx, client.userID, hub.roomID, update)
+	switch {
+	case errors.Is(err, models.ErrInitiativeEmpty):
+		hub.ReplyToClient(client, app.wsClientError(eventID, "initiative empty", http.StatusConflict))
+		return false
+	case errors.Is(err, models.ErrInitiativeNotDelayed):
+		hub.ReplyToClient(client, app.wsClientError(eventID, "initiative not delayed", http.StatusConflict))
+		return false
+	case errors.Is(err, models.ErrNoRecord):
+		hub.ReplyToClient(client, app.wsClientError(eventID, "initiative entry", http.StatusNotFound))
+		return false
+	case app.wsModelError(hub, client, err, eventID, "update initiative"):
+		return false
+	}
+
+	updatedJSON, err := json.Marshal(&initiativeUpdatedMsg{
+		Type:    "initiativeUpdated",
+		EventID: eventID,
+		Tracker: tracker,
+	})
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, eventID, "internal"))
+		return false
+	}
+	hub.BroadcastAll(updatedJSON)
+	return true
+}
+
+// initiativeAddHandler adds a sheet of the room, or an NPC with a name and
+// an initiative expression, to the end of the turn order.
+func (app *application) initiativeAddHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	var msg initiativeAddMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal initiativeAdd message: %w", err), "", "validation"))
+		return
+	}
+
+	entry := models.InitiativeEntry{
+		ID:         uuid.NewString(),
+		Name:       strings.TrimSpace(msg.Name),
+		Expression: strings.TrimSpace(msg.Expression),
+	}
+	if msg.SheetID != "" {
+		sheetID, err := strconv.Atoi(msg.SheetID)
+		if err != nil {
+			hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("invalid sheetID %q: %w", msg.SheetID, err), msg.EventID, "validation"))
+			return
+		}
+		sheet, err := app.models.CharacterSheets.GetWithPermission(ctx, client.userID, sheetID)
+		if app.wsModelError(hub, client, err, msg.EventID, "get sheet for initiative") {
+			return
+		}
+		if sheet.CharacterSheet.RoomID != hub.roomID {
+			hub.ReplyToClient(client, app.wsClientError(msg.EventID, "permission", http.StatusForbidden))
+			return
+		}
+		entry.SheetID = sheetID
+		entry.Name = sheet.CharacterSheet.CharacterName
+	}
+	if entry.Name == "" {
+		hub.ReplyToClient(client, app.wsClientError(msg.EventID, "validation", http.StatusUnprocessableEntity))
+		return
+	}
+
+	app.updateInitiative(ctx, client, hub, msg.EventID, func(t *models.InitiativeTracker) error {
+		t.Entries = append(t.Entries, entry)
+		return nil
+	})
+}
+
+// initiativeRollHandler rolls initiative for one entry, or for everyone
+// when no entry is given, and sorts the turn order. Sheets roll the
+// initiative expression written on them, with @references read from the
+// sheet itself. Entries that cannot be rolled are reported to the sender
+// and keep their place.
+func (app *application) initiativeRollHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	var msg initiativeEntryMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal initiativeRoll message: %w", err), "", "validation"))
+		return
+	}
+
+	// Sheets are loaded up front so the tracker is not locked while they are
+	current, err := app.models.RoomInitiative.Get(ctx, hub.roomID)
+	if app.wsModelError(hub, client, err, msg.EventID, "get initiative") {
+		return
+	}
+	sheets := map[int]*models.CharacterSheetContent{}
+	for _, e := range current.Entries {
+		if e.SheetID == 0 || msg.EntryID != "" && e.ID != msg.EntryID {
+			continue
+		}
+		sheet, err := app.models.CharacterSheets.GetWithPermission(ctx, client.userID, e.SheetID)
+		if err != nil {
+			continue
+		}
+		content, err := sheet.CharacterSheet.UnmarshalContent()
+		if err != nil {
+			continue
+		}
+		sheets[e.SheetID] = content
+	}
+
+	var failures []string
+	ok := app.updateInitiative(ctx, client, hub, msg.EventID, func(t *models.InitiativeTracker) error {
+		failures = nil
+		if msg.EntryID != "" {
+			if _, err := t.Entry(msg.EntryID); err != nil {
+				return err
+			}
+		}
+		for i := range t.Entries {
+			e := &t.Entries[i]
+			if msg.EntryID != "" && e.ID != msg.EntryID {
+				continue
+			}
+
+			var sheet *models.CharacterSheetContent
+			if e.SheetID != 0 {
+				sheet = sheets[e.SheetID]
+				if sheet == nil {
+					failures = append(failures, e.Name+": the character sheet could not be loaded")
+					continue
+				}
+				e.Expression = sheet.Initiative
+			}
+
+			r := commands.RollInitiative(ctx, sheet, e.Expression, hub.rng.NextSeed())
+			if !r.Success {
+				failures = append(failures, e.Name+": "+r.Result)
+				continue
+			}
+			total := r.Roll.Total
+			e.Initiative = &total
+			e.Roll = r.Result
+		}
+		t.Sort()
+		return nil
+	})
+	if ok && len(failures) > 0 {
+		app.replyCommandResult(hub, client, msg.EventID, "Initiative", &commands.CommandResult{
+			Success: false,
+			Result:  "Could not roll initiative for\n" + strings.Join(failures, "\n"),
+		})
+	}
+}
+
+func (app *application) initiativeSortHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	var msg initiativeMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal initiativeSort message: %w", err), "", "validation"))
+		return
+	}
+	app.updateInitiative(ctx, client, hub, msg.EventID, func(t *models.InitiativeTracker) error {
+		t.Sort()
+		return nil
+	})
+}
+
+// initiativeNextHandler passes the turn on, starting the first round when
+// the encounter has not begun.
+func (app *application) initiativeNextHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	var msg initiativeMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal initiativeNext message: %w", err), "", "validation"))
+		return
+	}
+	app.updateInitiative(ctx, client, hub, msg.EventID, (*models.InitiativeTracker).Next)
+}
+
+func (app *application) initiativeDelayHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	var msg initiativeEntryMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal initiativeDelay message: %w", err), "", "validation"))
+		return
+	}
+	app.updateInitiative(ctx, client, hub, msg.EventID, func(t *models.InitiativeTracker) error {
+		return t.Delay(msg.EntryID)
+	})
+}
+
+// initiativeActHandler lets a delayed entry take its turn now.
+func (app *application) initiativeActHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	var msg initiativeEntryMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal initiativeAct message: %w", err), "", "validation"))
+		return
+	}
+	app.updateInitiative(ctx, client, hub, msg.EventID, func(t *models.InitiativeTracker) error {
+		return t.Act(msg.EntryID)
+	})
+}
+
+func (app *application) initiativeRemoveHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	var msg initiativeEntryMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal initiativeRemove message: %w", err), "", "validation"))
+		return
+	}
+	app.updateInitiative(ctx, client, hub, msg.EventID, func(t *models.InitiativeTracker) error {
+		return t.Remove(msg.EntryID)
+	})
+}
+
+// initiativeClearHandler ends the encounter.
+func (app *application) initiativeClearHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	var msg initiativeMsg
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		hub.ReplyToClient(client, app.wsServerError(fmt.Errorf("unmarshal initiativeClear message: %w", err), "", "validation"))
+		return
+	}
+	app.updateInitiative(ctx, client, hub, msg.EventID, func(t *models.InitiativeTracker) error {
+		t.Clear()
+		return nil
+	})
+}
+
+// maxEphemeralPath bounds the sheet path a cursor ping may point at.
+const maxEphemeralPath = 200
+
+// ephemeralMsg is presence a client shares with the rest of the room: where
+// on a sheet their cursor is, or whether they are typing in the chat. It is
+// relayed as is and never stored.
+type ephemeralMsg struct {
+	Type    string `json:"type"`
+	EventID string `json:"eventID"`
+	Kind    string `json:"kind"`              // "cursor" or "typing"
+	SheetID string `json:"sheetID,omitempty"` // cursor only
+	Path    string `json:"path,omitempty"`    // cursor only
+	Typing  bool   `json:"typing,omitempty"`  // typing only
+}
+
+type ephemeralBroadcastMsg struct {
+	Type    string `json:"type"`
+	Kind    string `json:"kind"`
+	UserID  int    `json:"userID"`
+	SheetID string `json:"sheetID,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Typing  bool   `json:"typing,omitempty"`
+}
+
+// parseEphemeral decodes an ephemeral message, refusing fields its kind
+// does not have so that nothing else can ride along to the room.
+func parseEphemeral(raw []byte) (*ephemeralMsg, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var msg ephemeralMsg
+	if err := dec.Decode(&msg); err != nil {
+		return nil, err
+	}
+
+	switch msg.Kind {
+	case "cursor":
+		if _, err := strconv.Atoi(msg.SheetID); err != nil {
+			return nil, fmt.Errorf("invalid sheetID %q", msg.SheetID)
+		}
+		if msg.Path == "" || len(msg.Path) > maxEphemeralPath {
+			return nil, fmt.Errorf("path must be between 1 and %d characters", maxEphemeralPath)
+		}
+		if msg.Typing {
+			return nil, errors.New("cursor has no typing")
+		}
+	case "typing":
+		if msg.SheetID != "" || msg.Path != "" {
+			return nil, errors.New("typing has no sheetID or path")
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind %q", msg.Kind)
+	}
+	return &msg, nil
+}
+
+// ephemeralHandler relays a cursor ping or typing indicator to everyone else
+// in the room, stamped with the sender's user id. It sends no reply when it
+// succeeds.
+func (app *application) ephemeralHandler(ctx context.Context, client *Client, hub *Hub, raw []byte) {
+	msg, err := parseEphemeral(raw)
+	if err != nil {
+		var base struct {
+			EventID string `json:"eventID"`
+		}
+		json.Unmarshal(raw, &base)
+		app.infoLog.Printf("invalid ephemeral message from user=%d: %v", client.userID, err)
+		hub.ReplyToClient(client, app.wsClientError(base.EventID, "validation", http.StatusBadRequest))
+		return
+	}
+
+	b, err := json.Marshal(ephemeralBroadcastMsg{
+		Type:    "ephemeral",
+		Kind:    msg.Kind,
+		UserID:  client.userID,
+		SheetID: msg.SheetID,
+		Path:    msg.Path,
+		Typing:  msg.Typing,
+	})
+	if err != nil {
+		hub.ReplyToClient(client, app.wsServerError(err, msg.EventID, "internal"))
+		return
+	}
+	hub.BroadcastFrom(client, b)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/assert"
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+func TestSheetEditMessages(t *testing.T) {
+	edit := &models.SheetEdit{
+		Version: 12,
+		Values: []models.PathValue{
+			{Path: []string{"characteristics", "WS", "value"}, Value: json.RawMessage(`40`)},
+			{Path: []string{"gear", "items", "a"}, Value: json.RawMessage(`{"name":"Knife"}`)},
+			{Path: []string{"gear", "layouts", "a"}, Value: json.RawMessage(`{"colIndex":1,"rowIndex":2}`)},
+			{Path: []string{"gear", "items", "b"}},
+			{Path: []string{"gear", "layouts", "b"}},
+			{Path: []string{"traits", "layouts"}, Value: json.RawMessage(`{"c":{"colIndex":0,"rowIndex":3}}`)},
+			{Path: []string{"armour", "head"}, Value: json.RawMessage(`{"value":4}`)},
+		},
+	}
+
+	msgs := sheetEditMessages("ev", "7", edit)
+	var types []string
+	for _, m := range msgs {
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var head struct {
+			Type    string `json:"type"`
+			Version int    `json:"version"`
+		}
+		json.Unmarshal(b, &head)
+		assert.Equal(t, head.Version, 12)
+		types = append(types, head.Type)
+	}
+	assert.Equal(t, len(types), 5)
+	assert.Equal(t, types[0], "change")
+	assert.Equal(t, types[1], "createItem")
+	assert.Equal(t, types[2], "deleteItem")
+	assert.Equal(t, types[3], "positionsChanged")
+	assert.Equal(t, types[4], "batch")
+
+	created := msgs[1].(*CreateItemMsg)
+	assert.Equal(t, created.Path, "gear.items")
+	assert.Equal(t, created.ItemID, "a")
+	assert.Equal(t, created.ItemPos, models.Position{ColIndex: 1, RowIndex: 2})
+
+	positions := msgs[3].(*positionsChangedMsg)
+	assert.Equal(t, positions.Path, "traits.items")
+	assert.Equal(t, positions.Positions["c"].RowIndex, 3)
+}
+
+func TestWSPermissions(t *testing.T) {
+	handlers := (&application{}).buildWSHandlerMap()
+	for msgType := range handlers {
+		if _, ok := wsPermissions[msgType]; !ok {
+			t.Errorf("message type %q has a handler but no permission", msgType)
+		}
+	}
+	for msgType := range wsPermissions {
+		if _, ok := handlers[msgType]; !ok {
+			t.Errorf("message type %q has a permission but no handler", msgType)
+		}
+	}
+
+	tests := []struct {
+		role     models.RoomRole
+		required models.RoomRole
+		want     bool
+	}{
+		{models.RolePlayer, models.RolePlayer, true},
+		{models.RolePlayer, models.RoleGamemaster, false},
+		{models.RoleModerator, models.RolePlayer, true},
+		{models.RoleModerator, models.RoleGamemaster, false},
+		{models.RoleGamemaster, models.RoleModerator, true},
+		{models.RoomRole("stranger"), models.RolePlayer, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.role.AtLeast(tt.required), tt.want)
+	}
+}
+
+func TestParseEphemeral(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		valid bool
+	}{
+		{"Cursor", `{"type":"ephemeral","kind":"cursor","sheetID":"3","path":"gear.items.a"}`, true},
+		{"Typing", `{"type":"ephemeral","eventID":"e1","kind":"typing","typing":true}`, true},
+		{"Stopped typing", `{"type":"ephemeral","kind":"typing"}`, true},
+		{"Unknown kind", `{"type":"ephemeral","kind":"kickPlayer"}`, false},
+		{"Unknown field", `{"type":"ephemeral","kind":"typing","userID":2}`, false},
+		{"Cursor without sheet", `{"type":"ephemeral","kind":"cursor","path":"notes"}`, false},
+		{"Cursor without path", `{"type":"ephemeral","kind":"cursor","sheetID":"3"}`, false},
+		{"Cursor path too long", `{"type":"ephemeral","kind":"cursor","sheetID":"3","path":"` + strings.Repeat("a", maxEphemeralPath+1) + `"}`, false},
+		{"Typing with path", `{"type":"ephemeral","kind":"typing","path":"notes"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseEphemeral([]byte(tt.raw))
+			assert.Equal(t, err == nil, tt.valid)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// hubIdleTimeout is how long a hub with no clients keeps running before it
+// is stopped.
+const hubIdleTimeout = 5 * time.Minute
+
+// errRegistryClosed is returned by Acquire once the registry is shut down.
+var errRegistryClosed = errors.New("hub registry is shut down")
+
+// HubRegistry owns the running hub of every room. Websocket clients hold a
+// reference to their room's hub; a hub that nobody references for
+// idleTimeout is stopped and forgotten.
+type HubRegistry struct {
+	mu          sync.Mutex
+	hubs        map[int]*hubEntry
+	closed      bool
+	idleTimeout time.Duration
+	newHub      func(roomID int) *Hub
+}
+
+type hubEntry struct {
+	hub  *Hub
+	refs int
+	idle *time.Timer // running while refs is zero
+}
+
+func NewHubRegistry(idleTimeout time.Duration, newHub func(roomID int) *Hub) *HubRegistry {
+	return &HubRegistry{
+		hubs:        make(map[int]*hubEntry),
+		idleTimeout: idleTimeout,
+		newHub:      newHub,
+	}
+}
+
+// entry returns the room's entry, starting its hub if it has none. The
+// caller holds r.mu.
+func (r *HubRegistry) entry(roomID int) *hubEntry {
+	e, ok := r.hubs[roomID]
+	if !ok {
+		e = &hubEntry{hub: r.newHub(roomID)}
+		r.hubs[roomID] = e
+		go e.hub.Run()
+		r.startIdle(roomID, e)
+	}
+	return e
+}
+
+// Get returns the room's running hub for broadcasting, without taking a
+// reference or starting one. A room nobody is connected to gets a stopped
+// hub, on which broadcasts are dropped, as does every room once the
+// registry is shut down.
+func (r *HubRegistry) Get(roomID int) *Hub {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.hubs[roomID]; ok {
+		return e.hub
+	}
+	hub := r.newHub(roomID)
+	close(hub.done)
+	return hub
+}
+
+// Acquire returns the room's hub with a reference taken for a client, which
+// must Release it when the client goes away.
+func (r *HubRegistry) Acquire(roomID int) (*Hub, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, errRegistryClosed
+	}
+	e := r.entry(roomID)
+	e.refs++
+	if e.idle != nil {
+		e.idle.Stop()
+		e.idle = nil
+	}
+	return e.hub, nil
+}
+
+// Register adds a client to a hub it acquired. It fails once the hub is
+// stopped or stopping, so a client is never left on a hub that will not
+// serve it: the check and the hand-off to the hub both happen under r.mu,
+// which Shutdown takes before stopping any hub.
+func (r *HubRegistry) Register(hub *Hub, c *Client) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.hubs[hub.roomID]; r.closed || !ok || e.hub != hub {
+		return false
+	}
+	return hub.Register(c)
+}
+
+// Release drops a reference taken by Acquire.
+func (r *HubRegistry) Release(hub *Hub) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.hubs[hub.roomID]
+	if !ok || e.hub != hub || e.refs == 0 {
+		return
+	}
+	e.refs--
+	if e.refs == 0 {
+		r.startIdle(hub.roomID, e)
+	}
+}
+
+// startIdle arms the timer that stops the hub unless it is acquired again
+// in time. The caller holds r.mu.
+func (r *HubRegistry) startIdle(roomID int, e *hubEntry) {
+	e.idle = time.AfterFunc(r.idleTimeout, func() {
+		r.mu.Lock()
+		if r.hubs[roomID] != e || e.refs > 0 {
+			r.mu.Unlock()
+			return
+		}
+		delete(r.hubs, roomID)
+		r.mu.Unlock()
+
+		e.hub.infoLog.Printf("stopping idle hub room=%d", roomID)
+		e.hub.Stop()
+	})
+}
+
+// Len is the number of running hubs.
+func (r *HubRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.hubs)
+}
+
+// Shutdown stops every hub, sending each client a close frame, and waits
+// for the hubs to finish or ctx to end. Afterwards Acquire fails.
+func (r *HubRegistry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	r.closed = true
+	hubs := make([]*Hub, 0, len(r.hubs))
+	for roomID, e := range r.hubs {
+		if e.idle != nil {
+			e.idle.Stop()
+		}
+		hubs = append(hubs, e.hub)
+		delete(r.hubs, roomID)
+	}
+	r.mu.Unlock()
+
+	for _, hub := range hubs {
+		hub.Stop()
+	}
+	for _, hub := range hubs {
+		select {
+		case <-hub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"charactersheet.iociveteres.net/internal/assert"
+)
+
+func newTestHubRegistry(idleTimeout time.Duration) *HubRegistry {
+	app := &application{
+		errorLog: log.New(io.Discard, "", 0),
+		infoLog:  log.New(io.Discard, "", 0),
+	}
+	return NewHubRegistry(idleTimeout, app.NewRoom)
+}
+
+func waitStopped(t *testing.T, hub *Hub) {
+	t.Helper()
+	select {
+	case <-hub.done:
+	case <-time.After(time.Second):
+		t.Fatal("hub did not stop")
+	}
+}
+
+func TestHubRegistry(t *testing.T) {
+	t.Run("Shared hub", func(t *testing.T) {
+		r := newTestHubRegistry(time.Hour)
+		a, err := r.Acquire(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := r.Acquire(1)
+		c, _ := r.Acquire(2)
+		assert.Equal(t, a, b)
+		assert.Equal(t, a == c, false)
+		assert.Equal(t, r.Get(1), a)
+		assert.Equal(t, r.Len(), 2)
+	})
+
+	t.Run("Idle hub stops", func(t *testing.T) {
+		r := newTestHubRegistry(10 * time.Millisecond)
+		hub, _ := r.Acquire(1)
+		r.Acquire(1)
+		r.Release(hub)
+		time.Sleep(30 * time.Millisecond)
+		assert.Equal(t, r.Len(), 1)
+
+		r.Release(hub)
+		waitStopped(t, hub)
+		assert.Equal(t, r.Len(), 0)
+
+		again, _ := r.Acquire(1)
+		assert.Equal(t, again == hub, false)
+	})
+
+	t.Run("Get starts no hub", func(t *testing.T) {
+		r := newTestHubRegistry(time.Hour)
+		hub := r.Get(1)
+		waitStopped(t, hub)
+		assert.Equal(t, r.Len(), 0)
+		hub.BroadcastAll([]byte(`{}`))
+	})
+
+	t.Run("Acquire cancels idle stop", func(t *testing.T) {
+		r := newTestHubRegistry(20 * time.Millisecond)
+		hub, _ := r.Acquire(1)
+		r.Release(hub)
+		r.Acquire(1)
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, r.Len(), 1)
+		select {
+		case <-hub.done:
+			t.Fatal("acquired hub stopped")
+		default:
+		}
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		r := newTestHubRegistry(time.Hour)
+		a, _ := r.Acquire(1)
+		b, _ := r.Acquire(2)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := r.Shutdown(ctx); err != nil {
+			t.Fatal(err)
+		}
+		waitStopped(t, a)
+		waitStopped(t, b)
+		assert.Equal(t, r.Len(), 0)
+
+		_, err := r.Acquire(1)
+		assert.Equal(t, errors.Is(err, errRegistryClosed), true)
+
+		// Broadcasts and kicks on a stopped hub must not block.
+		stopped := r.Get(1)
+		stopped.BroadcastAll([]byte(`{}`))
+		for range 20 {
+			stopped.KickUser(1)
+		}
+		r.Release(a)
+	})
+
+	t.Run("Register on a stopped hub", func(t *testing.T) {
+		r := newTestHubRegistry(10 * time.Millisecond)
+		idle, _ := r.Acquire(1)
+		r.Release(idle)
+		waitStopped(t, idle)
+		assert.Equal(t, r.Register(idle, &Client{send: make(chan []byte, 1)}), false)
+
+		hub, _ := r.Acquire(2)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := r.Shutdown(ctx); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, r.Register(hub, &Client{send: make(chan []byte, 1)}), false)
+	})
+}
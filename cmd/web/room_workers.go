@@ -0,0 +1,89 @@
+package main
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	// wsQueueSize is how many messages a worker holds before Submit waits.
+	wsQueueSize = 16
+	// wsSubmitWait is how long Submit waits for room in a full queue
+	// before giving up. It is well below pongWait, so a client flooding
+	// one sheet is turned away rather than disconnected for not answering
+	// pings while readPump sits blocked.
+	wsSubmitWait = 2 * time.Second
+)
+
+// wsJob is a message read from a client, waiting to be handled.
+type wsJob struct {
+	Type    string
+	EventID string
+	Raw     []byte
+}
+
+// wsPool runs a client's messages on a fixed number of workers. Messages
+// with the same ordering key always go to the same worker, so they are
+// handled in the order they arrived; messages with different keys may
+// overtake each other.
+type wsPool struct {
+	handle func(wsJob)
+	queues []chan wsJob
+	wg     sync.WaitGroup
+}
+
+// newWSPool starts workers goroutines calling handle. With fewer than one
+// worker there is no pool and Submit handles each message itself.
+func newWSPool(workers int, handle func(wsJob)) *wsPool {
+	p := &wsPool{handle: handle}
+	for range workers {
+		q := make(chan wsJob, wsQueueSize)
+		p.queues = append(p.queues, q)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range q {
+				handle(job)
+			}
+		}()
+	}
+	return p
+}
+
+// Submit queues the job behind earlier jobs with its ordering key, waiting
+// up to wsSubmitWait while that worker's queue is full. It reports whether
+// the job was queued; a job that was not is dropped.
+func (p *wsPool) Submit(job wsJob) bool {
+	if len(p.queues) == 0 {
+		p.handle(job)
+		return true
+	}
+	// Messages about no sheet in particular share the key "" and so stay in
+	// order among themselves.
+	h := fnv.New32a()
+	h.Write([]byte(messageOrderKey(job)))
+	q := p.queues[h.Sum32()%uint32(len(p.queues))]
+
+	select {
+	case q <- job:
+		return true
+	default:
+	}
+	timer := time.NewTimer(wsSubmitWait)
+	defer timer.Stop()
+	select {
+	case q <- job:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Close stops taking jobs and waits for the queued ones to be handled.
+func (p *wsPool) Close() {
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/assert"
+)
+
+func TestWSPool(t *testing.T) {
+	for _, workers := range []int{0, 1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			var mu sync.Mutex
+			handled := map[string][]int{}
+			pool := newWSPool(workers, func(job wsJob) {
+				var n int
+				fmt.Sscanf(job.EventID, "%d", &n)
+				mu.Lock()
+				defer mu.Unlock()
+				key := messageSheetID(job.Raw)
+				handled[key] = append(handled[key], n)
+			})
+
+			const perKey = 50
+			keys := []string{`"sheetID":"1"`, `"sheetId":2`, `"sheetID":"3"`, `"chat":"hi"`}
+			for i := range perKey {
+				for _, k := range keys {
+					pool.Submit(wsJob{Type: "change", EventID: fmt.Sprint(i), Raw: []byte("{" + k + "}")})
+				}
+			}
+			pool.Close()
+
+			assert.Equal(t, len(handled), len(keys))
+			for key, order := range handled {
+				assert.Equal(t, len(order), perKey)
+				for i, n := range order {
+					if n != i {
+						t.Fatalf("key %q: message %d handled in position %d", key, n, i)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMessageSheetID(t *testing.T) {
+	assert.Equal(t, messageSheetID([]byte(`{"sheetID":"12"}`)), "12")
+	assert.Equal(t, messageSheetID([]byte(`{"sheetId":7}`)), "7")
+	assert.Equal(t, messageSheetID([]byte(`{"type":"chatMessage"}`)), "")
+	assert.Equal(t, messageSheetID([]byte(`not json`)), "")
+}
+
+func TestWSPoolFullQueue(t *testing.T) {
+	release := make(chan struct{})
+	pool := newWSPool(1, func(wsJob) { <-release })
+
+	// One job held by the worker and a full queue behind it.
+	for i := range wsQueueSize + 1 {
+		assert.Equal(t, pool.Submit(wsJob{EventID: fmt.Sprint(i)}), true)
+	}
+	assert.Equal(t, pool.Submit(wsJob{EventID: "overflow"}), false)
+
+	close(release)
+	pool.Close()
+}
+
+func TestMessageOrderKey(t *testing.T) {
+	damage := `{"type":"damageRoll","sheetID":"1","targetSheetID":"2","apply":%v}`
+	assert.Equal(t, messageOrderKey(wsJob{Type: "damageRoll", Raw: []byte(fmt.Sprintf(damage, true))}), "2")
+	assert.Equal(t, messageOrderKey(wsJob{Type: "damageRoll", Raw: []byte(fmt.Sprintf(damage, false))}), "1")
+	assert.Equal(t, messageOrderKey(wsJob{Type: "change", Raw: []byte(`{"sheetID":"1","targetSheetID":"2","apply":true}`)}), "1")
+}
@@ -12,6 +12,11 @@ import (
 )
 
 func (app *application) routes() http.Handler {
+	// reverse keeps URL names in a package-level store and panics on a
+	// duplicate name, so start from an empty store to let the router be
+	// built more than once (the tests build one per application).
+	reverse.Clear()
+
 	router := httprouter.New()
 
 	// wrap httprouter notFound with app.notFound
@@ -77,10 +82,21 @@ func (app *application) routes() http.Handler {
 	// So abomination of /room/view/sheet/:roomid/:sheetid is here.
 	router.Handler(http.MethodGet, reverse.Add("ViewRoomWithSheet", "/room/sheet/view/:roomid/:sheetid", ":roomid", ":sheetid"), protected.ThenFunc(app.roomViewWithSheet))
 
+	router.Handler(http.MethodGet, reverse.Add("RoomStats", "/room/stats/:id", ":id"), protected.ThenFunc(app.roomStats))
+	router.Handler(http.MethodGet, reverse.Add("VerifyRoll", "/room/roll/verify/:roomid/:messageid", ":roomid", ":messageid"), protected.ThenFunc(app.verifyRoll))
+
 	router.Handler(http.MethodGet, reverse.Add("SheetView", "/sheet/view/:id"), protected.ThenFunc(app.sheetView))
 	router.Handler(http.MethodGet, reverse.Add("SheetShow", "/sheet/show"), protected.ThenFunc(app.sheetShow))
 	router.Handler(http.MethodGet, reverse.Add("exportSheet", "/sheet/export/:id", ":id"), protected.ThenFunc(app.sheetExport))
 	router.Handler(http.MethodPost, reverse.Add("importSheet", "/sheet/import"), protected.ThenFunc(app.sheetImport))
+	router.Handler(http.MethodGet, reverse.Add("SheetHistory", "/sheet/history/:id", ":id"), protected.ThenFunc(app.sheetHistory))
+	router.Handler(http.MethodPost, reverse.Add("SheetRestore", "/sheet/restore/:id", ":id"), protected.ThenFunc(app.sheetRestorePost))
+	router.Handler(http.MethodGet, reverse.Add("SheetSnapshots", "/sheet/snapshots/:id", ":id"), protected.ThenFunc(app.sheetSnapshots))
+	router.Handler(http.MethodPost, reverse.Get("SheetSnapshots"), protected.ThenFunc(app.sheetSnapshotPost))
+	router.Handler(http.MethodGet, reverse.Add("SheetSnapshotCompare", "/sheet/snapshots/:id/compare/:snapshotid", ":id", ":snapshotid"), protected.ThenFunc(app.sheetSnapshotCompare))
+	router.Handler(http.MethodPost, reverse.Add("SheetSnapshotRestore", "/sheet/snapshots/:id/restore/:snapshotid", ":id", ":snapshotid"), protected.ThenFunc(app.sheetSnapshotRestorePost))
+	router.Handler(http.MethodGet, reverse.Add("SheetDiff", "/sheet/diff/:id", ":id"), protected.ThenFunc(app.sheetDiff))
+	router.Handler(http.MethodPost, reverse.Get("SheetDiff"), protected.ThenFunc(app.sheetDiffPost))
 
 	router.Handler(http.MethodGet, reverse.Add("RedeemInvite", "/invite/token/:token", ":token"), protected.ThenFunc(app.redeemInvite))
 
@@ -9,11 +9,14 @@ import (
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"charactersheet.iociveteres.net/internal/commands"
 	"charactersheet.iociveteres.net/internal/mailer"
 	"charactersheet.iociveteres.net/internal/models"
+	"charactersheet.iociveteres.net/internal/sheetdiff"
 	"charactersheet.iociveteres.net/ui"
 	"github.com/alehano/reverse"
 )
@@ -25,16 +28,23 @@ type templateData struct {
 	CharacterSheetSummaries []*models.CharacterSheetSummary
 	CharacterSheetContent   *models.CharacterSheetContent
 	CanEditSheet            bool
+	CanRestoreSheet         bool
+	SheetHistory            *models.SheetHistory
+	SheetSnapshots          []*models.SheetSnapshot
+	SheetSnapshot           *models.SheetSnapshot
+	SheetDiff               *sheetdiff.Diff
 	Room                    *models.Room
 	RoomInvite              *models.RoomInvite
 	InviteLink              string
 	MessagePage             *models.MessagePage
-	AvailableCommands       []commands.Command
+	RollStats               *models.RoomRollStats
+	AvailableCommands       []commands.CommandInfo
 	Rooms                   []*models.Room
 	RoomsWithRole           []*models.RoomWithRole
 	PlayerViews             []*models.PlayerView
 	CurrentPlayerView       *models.PlayerView
 	DicePresets             []models.DicePreset
+	Initiative              *models.InitiativeTracker
 	Form                    any
 	Flash                   string
 	IsAuthenticated         bool
@@ -423,6 +433,21 @@ func str(v interface{}) string {
 	return fmt.Sprint(v)
 }
 
+// joinInts renders ids as "1,2,3" for data attributes.
+func joinInts(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// toJSON renders v as JSON for data attributes.
+func toJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
 var functions = template.FuncMap{
 	"humanDate":                    humanDate,
 	"layoutNotes":                  columnsFromLayoutNotes,
@@ -460,6 +485,8 @@ var functions = template.FuncMap{
 	"isGamemaster":                 isGamemaster,
 	"rfc3339":                      rfc3399,
 	"str":                          str,
+	"joinInts":                     joinInts,
+	"toJSON":                       toJSON,
 	"importMapJSON":                func() template.HTML { return template.HTML(ui.ImportMapJSON()) },
 }
 
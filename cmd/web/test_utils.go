@@ -5,6 +5,7 @@ import (
 	"html"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
@@ -38,10 +39,12 @@ func newTestApplication(t *testing.T) *application {
 	sessionManager.Cookie.Secure = true
 
 	models := models.Models{
-		Users: &mocks.UserModel{},
+		Users:           &mocks.UserModel{},
+		Rooms:           &mocks.RoomModel{},
+		CharacterSheets: &mocks.CharacterSheetModel{},
 	}
 
-	return &application{
+	app := &application{
 		errorLog:       log.New(io.Discard, "", 0),
 		infoLog:        log.New(io.Discard, "", 0),
 		models:         models,
@@ -49,6 +52,8 @@ func newTestApplication(t *testing.T) *application {
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
 	}
+	app.hubs = NewHubRegistry(hubIdleTimeout, app.NewRoom)
+	return app
 }
 
 // Define a custom testServer type which embeds a httptest.Server instance.
@@ -161,3 +166,40 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	// Return the response status, headers and body.
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// postMultipart sends a multipart POST request to the test server, with
+// fields as form values and files as file parts keyed by field name.
+func (ts *testServer) postMultipart(t *testing.T, urlPath string, fields url.Values, files map[string][]byte) (int, http.Header, string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for key, values := range fields {
+		for _, value := range values {
+			if err := mw.WriteField(key, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for key, content := range files {
+		fw, err := mw.CreateFormFile(key, key+".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := ts.Client().Post(ts.URL+urlPath, mw.FormDataContentType(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs.StatusCode, rs.Header, string(body)
+}
@@ -0,0 +1,167 @@
+package commands
+
+// Node is an element of a parsed roll expression.
+type Node interface {
+	// Column returns the 1-based column where the node starts in the source.
+	Column() int
+}
+
+// NumberNode is an integer constant.
+type NumberNode struct {
+	Value int
+	Col   int
+}
+
+// DiceNode rolls Count dice with Sides faces each. When Keep is non-zero only
+// the Keep highest dice count (or the lowest, if KeepLowest is set).
+//
+// The remaining modifiers are nil when absent. Explode adds another die
+// whenever a die matches it, Reroll replaces matching dice (only once if
+// RerollOnce is set), Success turns the pool into a count of matching dice,
+// and CritSuccess/CritFail override the default crit ranges.
+type DiceNode struct {
+	Count       int
+	Sides       int
+	Keep        int
+	KeepLowest  bool
+	Explode     *Compare
+	Reroll      *Compare
+	RerollOnce  bool
+	Success     *Compare
+	CritSuccess *Compare
+	CritFail    *Compare
+	Text        string // the dice term as typed, without whitespace
+	Col         int
+}
+
+// Compare is a compare point such as ">=8" used by dice modifiers.
+type Compare struct {
+	Op    string // one of = < <= > >=
+	Value int
+}
+
+// Match reports whether a die showing v satisfies the compare point.
+func (c *Compare) Match(v int) bool {
+	switch c.Op {
+	case "<":
+		return v < c.Value
+	case "<=":
+		return v <= c.Value
+	case ">":
+		return v > c.Value
+	case ">=":
+		return v >= c.Value
+	}
+	return v == c.Value
+}
+
+// matchesAll reports whether every face of a die with the given number of
+// sides satisfies c, which would make an explode or reroll loop forever.
+func (c *Compare) matchesAll(sides int) bool {
+	for v := 1; v <= sides; v++ {
+		if !c.Match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// UnaryNode negates its operand.
+type UnaryNode struct {
+	X   Node
+	Col int
+}
+
+// BinaryNode applies one of + - * / to two operands. Implicit marks the
+// multiplication written as "3(d6+2)" so it renders back the same way.
+type BinaryNode struct {
+	Op       byte
+	Left     Node
+	Right    Node
+	Implicit bool
+	Col      int
+}
+
+// ParenNode is a parenthesised sub-expression.
+type ParenNode struct {
+	X   Node
+	Col int
+}
+
+// CallNode is a call to one of the built-in functions, e.g. max(d10, d10).
+type CallNode struct {
+	Name string
+	Args []Node
+	Col  int
+}
+
+// RefNode is a value read from a character sheet, e.g. @WS, @Awareness or
+// @{Name}.SB. Value is filled in by resolveRefs before the roll is evaluated.
+type RefNode struct {
+	Sheet    string // the named sheet, empty for the sender's own
+	Name     string // characteristic, characteristic bonus or skill
+	Text     string // the reference as typed
+	Value    int
+	Resolved bool
+	Col      int
+}
+
+func (n *NumberNode) Column() int { return n.Col }
+func (n *DiceNode) Column() int   { return n.Col }
+func (n *UnaryNode) Column() int  { return n.Col }
+func (n *BinaryNode) Column() int { return n.Col }
+func (n *ParenNode) Column() int  { return n.Col }
+func (n *CallNode) Column() int   { return n.Col }
+func (n *RefNode) Column() int    { return n.Col }
+
+// Roll is a fully parsed /roll argument.
+type Roll struct {
+	Expr     Node
+	ExprText string // Expr as typed, without whitespace
+	Target   Node   // difficulty after "vs", nil for plain rolls
+	Bonus    int    // extra successes from "[+N]"
+	Repeat   int    // N for "Nx(...)", 0 when the roll is not repeated
+}
+
+// walk calls fn for n and every node below it, in source order.
+func walk(n Node, fn func(Node)) {
+	fn(n)
+	switch n := n.(type) {
+	case *UnaryNode:
+		walk(n.X, fn)
+	case *BinaryNode:
+		walk(n.Left, fn)
+		walk(n.Right, fn)
+	case *ParenNode:
+		walk(n.X, fn)
+	case *CallNode:
+		for _, arg := range n.Args {
+			walk(arg, fn)
+		}
+	}
+}
+
+// firstDice returns the first dice group of the expression, or nil.
+func firstDice(n Node) *DiceNode {
+	var first *DiceNode
+	walk(n, func(n Node) {
+		if d, ok := n.(*DiceNode); ok && first == nil {
+			first = d
+		}
+	})
+	return first
+}
+
+// maxDieSides returns the number of sides of the first die in the
+// expression, which is what crit ranges are scaled against. Expressions
+// without dice are treated as d100.
+func maxDieSides(n Node) int {
+	if d := firstDice(n); d != nil {
+		return d.Sides
+	}
+	return 100
+}
+
+func containsDice(n Node) bool {
+	return firstDice(n) != nil
+}
@@ -0,0 +1,409 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+// AttackProfile is everything about an attack that is settled before the
+// dice are rolled. It is stored with the result so the roll can be replayed.
+type AttackProfile struct {
+	Label   string `json:"label"` // weapon name and the options picked in the roll dialog
+	Melee   bool   `json:"melee,omitempty"`
+	Target  int    `json:"target"`
+	Bonus   int    `json:"bonus,omitempty"` // extra degrees from an unnatural characteristic
+	Mode    string `json:"mode"`            // the selected rate of fire, e.g. "short"
+	MaxHits int    `json:"maxHits"`
+	Called  string `json:"called,omitempty"` // the called shot, e.g. "head"
+}
+
+// AttackResult is the outcome of an attack roll: how many hits landed and
+// where, as keys of models.Armour such as "rightArm". SheetID and Path name
+// the weapon that made the attack; Resolved is set once its damage is rolled.
+type AttackResult struct {
+	AttackProfile
+	Hits      int      `json:"hits"`
+	Locations []string `json:"locations,omitempty"`
+	SheetID   int      `json:"sheetId,omitempty"`
+	Path      string   `json:"path,omitempty"`
+	Resolved  bool     `json:"resolved,omitempty"`
+}
+
+// MadeWith reports whether the attack was made with the weapon at path on
+// sheetID. The path may go on past the weapon, to one of its profiles.
+func (a *AttackResult) MadeWith(sheetID int, path []string) bool {
+	weapon := strings.Split(a.Path, ".")
+	return a.SheetID == sheetID && len(path) >= len(weapon) && slices.Equal(path[:len(weapon)], weapon)
+}
+
+// The sheet sections that hold weapons.
+const (
+	rangedAttacksSection = "rangedAttacks"
+	meleeAttacksSection  = "meleeAttacks"
+)
+
+// AttackProfileFor builds the attack of the weapon at path, e.g.
+// rangedAttacks.list.items.<id>, from the sheet content and the weapon's
+// roll dialog settings.
+func AttackProfileFor(content json.RawMessage, path []string) (AttackProfile, error) {
+	if len(path) != 4 {
+		return AttackProfile{}, fmt.Errorf("path %q is not a weapon", strings.Join(path, "."))
+	}
+	raw, err := weaponItem(content, path)
+	if err != nil {
+		return AttackProfile{}, err
+	}
+
+	var sheet models.CharacterSheetContent
+	if err := json.Unmarshal(content, &sheet); err != nil {
+		return AttackProfile{}, fmt.Errorf("unmarshal sheet: %w", err)
+	}
+
+	// The weapon is decoded over the default roll dialog so that settings
+	// missing from a stored dialog keep their defaults
+	if path[0] == rangedAttacksSection {
+		weapon := models.RangedAttack{Roll: models.NewDefaultRangedAttackRoll()}
+		if err := json.Unmarshal(raw, &weapon); err != nil {
+			return AttackProfile{}, fmt.Errorf("unmarshal ranged attack: %w", err)
+		}
+		return rangedAttackProfile(&sheet, &weapon), nil
+	}
+	weapon := models.MeleeAttack{Roll: models.NewDefaultMeleeAttackRoll()}
+	if err := json.Unmarshal(raw, &weapon); err != nil {
+		return AttackProfile{}, fmt.Errorf("unmarshal melee attack: %w", err)
+	}
+	return meleeAttackProfile(&sheet, &weapon), nil
+}
+
+// weaponItem returns the stored weapon that path starts with, e.g.
+// meleeAttacks.list.items.<id>.
+func weaponItem(content json.RawMessage, path []string) (json.RawMessage, error) {
+	if len(path) < 4 || path[1] != "list" || path[2] != "items" ||
+		(path[0] != rangedAttacksSection && path[0] != meleeAttacksSection) {
+		return nil, fmt.Errorf("path %q is not a weapon", strings.Join(path, "."))
+	}
+
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(content, &sections); err != nil {
+		return nil, fmt.Errorf("unmarshal sheet: %w", err)
+	}
+	var section struct {
+		List struct {
+			Items map[string]json.RawMessage `json:"items"`
+		} `json:"list"`
+	}
+	if raw, ok := sections[path[0]]; ok {
+		if err := json.Unmarshal(raw, &section); err != nil {
+			return nil, fmt.Errorf("unmarshal %s: %w", path[0], err)
+		}
+	}
+	raw, ok := section.List.Items[path[3]]
+	if !ok {
+		return nil, errors.New("weapon not found")
+	}
+	return raw, nil
+}
+
+// rangedAttackProfile applies the fire modes: a single shot hits once, a
+// semi-auto burst adds a hit per two degrees of success beyond the first and
+// full auto or suppressing fire a hit per degree, up to the weapon's rate of
+// fire for the mode.
+func rangedAttackProfile(sheet *models.CharacterSheetContent, w *models.RangedAttack) AttackProfile {
+	r := w.Roll
+	p := AttackProfile{
+		Label: attackLabel(w.Name, []dialogOption{
+			{"aim", r.Aim.Selected, "no"},
+			{"target", r.Target.Selected, "no"},
+			{"range", r.Range.Selected, "combat"},
+			{"rof", r.RoF.Selected, "single"},
+		}, r.Extra1, r.Extra2),
+		Target:  sheet.RollValue(r.BaseSelect) + r.Modifier(),
+		Bonus:   sheet.RollBonusSuccesses(r.BaseSelect),
+		Mode:    r.RoF.Selected,
+		MaxHits: 1,
+		Called:  calledShot(r.Target.Selected),
+	}
+	switch r.RoF.Selected {
+	case "short":
+		p.MaxHits = rateOfFire(w.RoFShort)
+	case "long", "suppression":
+		p.MaxHits = rateOfFire(w.RoFLong)
+	default:
+		p.Mode = "single"
+	}
+	return p
+}
+
+// meleeAttackProfile applies the melee rates of attack: a quick attack adds
+// a hit per two degrees of success beyond the first and a lightning attack a
+// hit per degree, up to the attacker's Weapon Skill bonus.
+func meleeAttackProfile(sheet *models.CharacterSheetContent, w *models.MeleeAttack) AttackProfile {
+	r := w.Roll
+	p := AttackProfile{
+		Label: attackLabel(w.Name, []dialogOption{
+			{"aim", r.Aim.Selected, "no"},
+			{"target", r.Target.Selected, "no"},
+			{"base", r.Base.Selected, "standard"},
+			{"stance", r.Stance.Selected, "standard"},
+			{"mrof", r.RoF.Selected, "single"},
+		}, r.Extra1, r.Extra2),
+		Melee:   true,
+		Target:  sheet.RollValue(r.BaseSelect) + r.Modifier(),
+		Bonus:   sheet.RollBonusSuccesses(r.BaseSelect),
+		Mode:    r.RoF.Selected,
+		MaxHits: 1,
+		Called:  calledShot(r.Target.Selected),
+	}
+	switch r.RoF.Selected {
+	case "quick", "lightning":
+		wsb, _ := sheet.CharacteristicBonus("WS")
+		p.MaxHits = max(1, wsb)
+	default:
+		p.Mode = "single"
+	}
+	return p
+}
+
+// rateOfFire reads the number of shots in a RoF cell such as "3" or "4/–".
+// A cell without one allows a single hit.
+func rateOfFire(cell string) int {
+	n, ok := leadingNumber(cell)
+	if !ok || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// leadingNumber reads the number a weapon cell starts with, e.g. 4 in
+// "4/–" or "4 (Razor Sharp)".
+func leadingNumber(cell string) (int, bool) {
+	cell = strings.TrimSpace(cell)
+	end := strings.IndexFunc(cell, func(r rune) bool { return !unicode.IsDigit(r) })
+	if end < 0 {
+		end = len(cell)
+	}
+	n, err := strconv.Atoi(cell[:end])
+	return n, err == nil
+}
+
+// calledShot maps the called shot column to the hit location it forces.
+// Joints could be anywhere, so they keep the rolled location.
+func calledShot(selected string) string {
+	switch selected {
+	case "torso":
+		return "body"
+	case "head", "eyes":
+		return "head"
+	case "arm", "leg":
+		return selected
+	}
+	return ""
+}
+
+// optionNames are the roll dialog options as they appear in the chat label,
+// by column. Options not listed appear as they are stored.
+var optionNames = map[string]map[string]string{
+	"aim":    {"half": "half aim", "full": "full aim"},
+	"range":  {"pointBlank": "point-blank"},
+	"rof":    {"short": "short burst", "long": "long burst"},
+	"base":   {"full": "full attack"},
+	"mrof":   {"quick": "quick attack", "lightning": "lightning attack"},
+	"target": {},
+	"stance": {},
+}
+
+// dialogOption is one column of a roll dialog: its name in optionNames, the
+// selected option and the default, which is left out of labels.
+type dialogOption struct {
+	column, selected, def string
+}
+
+// attackLabel names the weapon followed by the options that differ from the
+// defaults and the enabled extras, e.g. "Bolter, half aim, short burst".
+func attackLabel(weapon string, options []dialogOption, extras ...models.RollExtra) string {
+	if strings.TrimSpace(weapon) == "" {
+		weapon = "Unknown"
+	}
+	parts := []string{weapon}
+	for _, o := range options {
+		if o.selected == "" || o.selected == o.def {
+			continue
+		}
+		name, ok := optionNames[o.column][o.selected]
+		if !ok {
+			name = o.selected
+		}
+		parts = append(parts, name)
+	}
+	for _, e := range extras {
+		if e.Enabled && e.Name != "" {
+			parts = append(parts, e.Name)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// RollAttack rolls d100 against the attack's target with dice drawn from
+// seed and works out the hits and where they land.
+func RollAttack(profile AttackProfile, seed Seed) CommandResult {
+	result := executeSeededRoll(context.Background(), nil, profile.expression(), seed)
+	if !result.Success {
+		return result
+	}
+
+	line := result.Roll.Lines[0]
+	attack := &AttackResult{AttackProfile: profile}
+	if *line.Success {
+		attack.Hits = attackHits(profile.Mode, line.Degrees, profile.MaxHits)
+		attack.Locations = hitLocations(firstHitLocation(line.Total, profile.Called), attack.Hits)
+	}
+	result.Roll.Attack = attack
+	result.Result = result.Roll.Text()
+	return result
+}
+
+// attackHits is the number of hits a successful attack with the given
+// degrees of success lands.
+func attackHits(mode string, degrees, maxHits int) int {
+	extra := 0
+	switch mode {
+	case "short", "quick":
+		extra = (degrees - 1) / 2
+	case "long", "suppression", "lightning":
+		extra = degrees - 1
+	}
+	return min(1+extra, max(1, maxHits))
+}
+
+// HitLocation reads the hit location off an attack roll by reversing its
+// digits: 47 hits location 74, a 100 counts as 00 and reverses to 100.
+func HitLocation(roll int) string {
+	reversed := (roll%10)*10 + (roll%100)/10
+	if reversed == 0 {
+		reversed = 100
+	}
+	switch {
+	case reversed <= 10:
+		return "head"
+	case reversed <= 20:
+		return "rightArm"
+	case reversed <= 30:
+		return "leftArm"
+	case reversed <= 70:
+		return "body"
+	case reversed <= 85:
+		return "rightLeg"
+	default:
+		return "leftLeg"
+	}
+}
+
+// firstHitLocation is the location of the first hit: the called one, on
+// the rolled side for a called arm or leg, or the rolled one.
+func firstHitLocation(roll int, called string) string {
+	rolled := HitLocation(roll)
+	switch called {
+	case "":
+		return rolled
+	case "arm":
+		if rolled == "leftArm" || rolled == "leftLeg" {
+			return "leftArm"
+		}
+		return "rightArm"
+	case "leg":
+		if rolled == "leftArm" || rolled == "leftLeg" {
+			return "leftLeg"
+		}
+		return "rightLeg"
+	}
+	return called
+}
+
+// followUpHits is the multiple hits table: where the second to fifth hits
+// land depending on the first. Hits beyond the fifth land where the fifth
+// did. "arm" and "leg" are on the side of the first hit, the right one when
+// the first hit the head or body.
+var followUpHits = map[string][]string{
+	"head": {"arm", "body", "arm", "body"},
+	"arm":  {"body", "head", "body", "arm"},
+	"body": {"arm", "head", "arm", "body"},
+	"leg":  {"body", "arm", "head", "body"},
+}
+
+func hitLocations(first string, hits int) []string {
+	if hits == 0 {
+		return nil
+	}
+
+	kind, side := first, "right"
+	for _, s := range []string{"left", "right"} {
+		if rest, ok := strings.CutPrefix(first, s); ok {
+			kind, side = strings.ToLower(rest), s
+		}
+	}
+
+	locations := []string{first}
+	table := followUpHits[kind]
+	for i := 1; i < hits; i++ {
+		loc := table[min(i, len(table))-1]
+		if loc == "arm" || loc == "leg" {
+			loc = side + strings.ToUpper(loc[:1]) + loc[1:]
+		}
+		locations = append(locations, loc)
+	}
+	return locations
+}
+
+// locationNames are the hit locations as shown in chat.
+var locationNames = map[string]string{
+	"head":     "Head",
+	"rightArm": "Right Arm",
+	"leftArm":  "Left Arm",
+	"body":     "Body",
+	"rightLeg": "Right Leg",
+	"leftLeg":  "Left Leg",
+}
+
+// Text renders the hits line of an attack, e.g. "2 hits: Body, Right Arm".
+func (a *AttackResult) Text() string {
+	if a.Hits == 0 {
+		return "Miss"
+	}
+	names := make([]string, len(a.Locations))
+	for i, loc := range a.Locations {
+		names[i] = locationNames[loc]
+	}
+	noun := "hits"
+	if a.Hits == 1 {
+		noun = "hit"
+	}
+	return fmt.Sprintf("%d %s: %s", a.Hits, noun, strings.Join(names, ", "))
+}
+
+// MessageBody is the chat message an attack is posted as: the versus roll
+// it amounts to, labelled like a roll from the sheet.
+func (p AttackProfile) MessageBody() string {
+	return "/r " + p.expression() + "\n>> " + p.Label
+}
+
+func (p AttackProfile) expression() string {
+	return versusExpression(p.Target, p.Bonus)
+}
+
+// versusExpression is a d100 test against target, with bonus extra degrees
+// of success.
+func versusExpression(target, bonus int) string {
+	expr := fmt.Sprintf("d100 vs %d", target)
+	if bonus > 0 {
+		expr += fmt.Sprintf(" [+%d]", bonus)
+	}
+	return expr
+}
@@ -0,0 +1,200 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+const attackTestSheet = `{
+	"characteristics": {
+		"WS": {"value": "47"},
+		"BS": {"value": "41", "unnatural": "2"}
+	},
+	"rangedAttacks": {"list": {"items": {
+		"bolter": {
+			"name": "Boltgun", "rofShort": "3", "rofLong": "–",
+			"roll": {
+				"aim": {"selected": "half"},
+				"rof": {"selected": "short"},
+				"extra1": {"enabled": true, "name": "cover", "value": -5}
+			}
+		},
+		"plain": {"name": "Laspistol"}
+	}}},
+	"meleeAttacks": {"list": {"items": {
+		"sword": {
+			"name": "Chainsword",
+			"roll": {"rof": {"selected": "lightning"}, "target": {"selected": "head"}}
+		}
+	}}}
+}`
+
+func TestAttackProfileFor(t *testing.T) {
+	tests := []struct {
+		path string
+		want AttackProfile
+	}{
+		{"rangedAttacks.list.items.bolter", AttackProfile{
+			Label:   "Boltgun, half aim, short burst, cover",
+			Target:  41 + 10 + 0 - 5,
+			Bonus:   1,
+			Mode:    "short",
+			MaxHits: 3,
+		}},
+		{"rangedAttacks.list.items.plain", AttackProfile{
+			Label:   "Laspistol",
+			Target:  41 + 10,
+			Bonus:   1,
+			Mode:    "single",
+			MaxHits: 1,
+		}},
+		{"meleeAttacks.list.items.sword", AttackProfile{
+			Label:   "Chainsword, head, lightning attack",
+			Melee:   true,
+			Target:  47 - 20 + 10 - 20,
+			Mode:    "lightning",
+			MaxHits: 4,
+			Called:  "head",
+		}},
+	}
+	for _, tt := range tests {
+		got, err := AttackProfileFor(json.RawMessage(attackTestSheet), strings.Split(tt.path, "."))
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+
+	for _, path := range []string{"rangedAttacks.list.items.missing", "characteristics.WS", "gear.list.items.bolter"} {
+		if _, err := AttackProfileFor(json.RawMessage(attackTestSheet), strings.Split(path, ".")); err == nil {
+			t.Errorf("%s is not a weapon but got a profile", path)
+		}
+	}
+}
+
+func TestHitLocation(t *testing.T) {
+	tests := []struct {
+		roll int
+		want string
+	}{
+		{1, "head"},     // 10
+		{2, "rightArm"}, // 20
+		{61, "rightArm"},
+		{3, "leftArm"},
+		{5, "body"}, // 50
+		{47, "rightLeg"},
+		{9, "leftLeg"},
+		{100, "leftLeg"},
+	}
+	for _, tt := range tests {
+		if got := HitLocation(tt.roll); got != tt.want {
+			t.Errorf("HitLocation(%d) = %s, want %s", tt.roll, got, tt.want)
+		}
+	}
+}
+
+func TestAttackHits(t *testing.T) {
+	tests := []struct {
+		mode             string
+		degrees, maxHits int
+		want             int
+	}{
+		{"single", 5, 1, 1},
+		{"short", 1, 3, 1},
+		{"short", 3, 3, 2},
+		{"short", 9, 3, 3},
+		{"long", 4, 10, 4},
+		{"suppression", 4, 3, 3},
+		{"lightning", 3, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := attackHits(tt.mode, tt.degrees, tt.maxHits); got != tt.want {
+			t.Errorf("attackHits(%s, %d, %d) = %d, want %d", tt.mode, tt.degrees, tt.maxHits, got, tt.want)
+		}
+	}
+}
+
+func TestHitLocations(t *testing.T) {
+	tests := []struct {
+		first string
+		hits  int
+		want  []string
+	}{
+		{"body", 0, nil},
+		{"body", 1, []string{"body"}},
+		{"leftArm", 3, []string{"leftArm", "body", "head"}},
+		{"head", 6, []string{"head", "rightArm", "body", "rightArm", "body", "body"}},
+		{"leftLeg", 5, []string{"leftLeg", "body", "leftArm", "head", "body"}},
+	}
+	for _, tt := range tests {
+		if got := hitLocations(tt.first, tt.hits); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("hitLocations(%s, %d) = %v, want %v", tt.first, tt.hits, got, tt.want)
+		}
+	}
+
+	if got := firstHitLocation(3, "arm"); got != "leftArm" {
+		t.Errorf("arm called on a left side roll = %s, want leftArm", got)
+	}
+	if got := firstHitLocation(5, "head"); got != "head" {
+		t.Errorf("called head = %s, want head", got)
+	}
+}
+
+func TestRollAttackVerifies(t *testing.T) {
+	profile := AttackProfile{Label: "Boltgun, short burst", Target: 90, Mode: "short", MaxHits: 3}
+	res := RollAttack(profile, NewRoomRNG().NextSeed())
+	if !res.Success || res.Roll.Attack == nil || res.Audit == nil {
+		t.Fatalf("attack failed: %+v", res)
+	}
+	attack := res.Roll.Attack
+	if len(attack.Locations) != attack.Hits {
+		t.Errorf("%d hits but %d locations", attack.Hits, len(attack.Locations))
+	}
+	if !strings.HasSuffix(res.Result, attack.Text()) {
+		t.Errorf("result %q does not end with the hits %q", res.Result, attack.Text())
+	}
+
+	data, err := json.Marshal(res.Roll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := models.Message{MessageBody: profile.MessageBody(), CommandResult: &res.Result, CommandData: data}
+	v, err := VerifyRoll(context.Background(), msg, *res.Audit, nil)
+	if err != nil || !v.Verified {
+		t.Fatalf("attack did not verify: %+v, %v", v, err)
+	}
+}
+
+func TestAttackResultMadeWith(t *testing.T) {
+	attack := &AttackResult{SheetID: 7, Path: "meleeAttacks.list.items.sword"}
+
+	tests := []struct {
+		sheetID int
+		path    string
+		want    bool
+	}{
+		{7, "meleeAttacks.list.items.sword", true},
+		{7, "meleeAttacks.list.items.sword.tabs.items.t2", true},
+		{8, "meleeAttacks.list.items.sword", false},
+		{7, "meleeAttacks.list.items.hammer", false},
+		{7, "meleeAttacks.list.items", false},
+		{7, "rangedAttacks.list.items.sword", false},
+	}
+	for _, tt := range tests {
+		if got := attack.MadeWith(tt.sheetID, strings.Split(tt.path, ".")); got != tt.want {
+			t.Errorf("MadeWith(%d, %q) = %v, want %v", tt.sheetID, tt.path, got, tt.want)
+		}
+	}
+
+	if (&AttackResult{}).MadeWith(0, []string{"rangedAttacks", "list", "items", "bolter"}) {
+		t.Error("an attack without a recorded weapon matched a weapon")
+	}
+}
@@ -1,73 +1,64 @@
 package commands
 
 import (
-	"strings"
+	"context"
+
+	"charactersheet.iociveteres.net/internal/models"
 )
 
 type CommandResult struct {
 	Success bool
 	Result  string
+	// Roll is the structured result of a /roll command, nil for other commands
+	Roll *RollResult
+	// Private results are shown only to the sender and never stored
+	Private bool
+	// Recipients makes the result a whisper: Result is stored as the message
+	// and delivered only to the sender and these users
+	Recipients []int
+	// Visibility of the stored result, empty for public messages
+	Visibility models.MessageVisibility
+	// Audit records the seed and dice of a roll so it can be verified later
+	Audit *models.RollAudit
 }
 
-type Command struct {
+// CommandInfo describes a command for templating.
+type CommandInfo struct {
 	Command             string
 	Description         string
 	DetailedDescription string
 }
 
-var commandsMap = map[string]Command{
-	"/r": {
-		Command:     "/r",
-		Description: "roll a die",
-		DetailedDescription: `d6 — roll 1d6
-1d3 — roll 1d3
-d100 + 32 — roll 1d100, add 32
-2d100 — roll 2d100, sum results
-4d6k3 — roll 4d6, keep the 3 highest, sum them
-2d6-1+d10 — roll 2d6 and 1d10, subtract 1, sum all
-3(d6+2) — roll 1d6, add 2, multiply total by 3
-13x(2d10+25) — repeat 13 times: roll 2d10, add 25; print each result on a new line in ascending order
-
-Versus rolls (roll vs difficulty):
-d100 vs 70 — roll 1d100, compare to 70, count success/fail levels
-2d50+3 vs 77 — roll 2d50+3, compare to 77
-d100 vs 77 [+1] — roll d100, compare to 77, if succesfull add +1 extra success
-5x(d100 vs 50) — repeat 5 times, aggregate success/fail levels
+// registry holds every command available in chat.
+var registry = newDefaultRegistry()
 
-Success/fail levels: Every 10 points above/below target adds 1 level
-Critical results: Values 1-5 are critical success, 96-100 are critical failure (scaled for other dice)`,
-	},
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(rollCommand{})
+	r.Register(secretRollCommand{name: "gr", aliases: []string{"gmroll"}, visibility: models.MessageGMOnly})
+	r.Register(secretRollCommand{name: "br", aliases: []string{"blindroll"}, visibility: models.MessageBlind})
+	r.Register(secretRollCommand{name: "sr", aliases: []string{"selfroll"}, visibility: models.MessageSelf})
+	r.Register(whisperCommand{})
+	r.Register(gmCommand{})
+	r.Register(helpCommand{registry: r})
+	return r
 }
 
 // AvailableCommands returns a slice suitable for templating: {{range .AvailableCommands}}...
-func AvailableCommands() []Command {
-	out := make([]Command, 0, len(commandsMap))
-	for _, c := range commandsMap {
-		out = append(out, c)
+func AvailableCommands() []CommandInfo {
+	cmds := registry.Commands()
+	out := make([]CommandInfo, 0, len(cmds))
+	for _, c := range cmds {
+		help := c.Help()
+		out = append(out, CommandInfo{
+			Command:             "/" + c.Name(),
+			Description:         help.Description,
+			DetailedDescription: help.DetailedDescription,
+		})
 	}
 	return out
 }
 
-func ParseAndExecuteCommand(messageBody string) *CommandResult {
-	if !strings.HasPrefix(messageBody, "/") {
-		return nil // Not a command
-	}
-
-	parts := strings.Fields(messageBody)
-	commandName := strings.TrimPrefix(parts[0], "/")
-	args := strings.Join(parts[1:], " ")
-
-	switch commandName {
-	case "roll":
-		r := executeRollCommand(args)
-		return &r
-	case "r":
-		r := executeRollCommand(args)
-		return &r
-	default:
-		return &CommandResult{
-			Success: false,
-			Result:  "Unknown command: /" + commandName,
-		}
-	}
+func ParseAndExecuteCommand(ctx context.Context, env *Env, messageBody string) *CommandResult {
+	return registry.Execute(ctx, env, messageBody)
 }
@@ -0,0 +1,235 @@
+package commands
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+// DamageProfile is a weapon's damage aimed at the locations an attack hit on
+// a target, with the target's armour there. It is stored with the result so
+// the roll can be replayed after the sheets have changed.
+type DamageProfile struct {
+	Label      string      `json:"label"`  // the weapon, and the melee profile when it has one
+	Damage     string      `json:"damage"` // a dice expression such as "1d10+4"
+	DamageType string      `json:"damageType,omitempty"`
+	Pen        int         `json:"pen"`
+	Target     string      `json:"target"`    // the target's character name
+	Locations  []HitArmour `json:"locations"` // one per hit
+}
+
+// HitArmour is a location hit and the target's armour on it.
+type HitArmour struct {
+	Location string `json:"location"`
+	models.LocationArmour
+}
+
+// DamageHit is the damage one hit dealt. Hits are in the order of the
+// profile's Locations.
+type DamageHit struct {
+	Rolled int  `json:"rolled"`
+	Halved bool `json:"halved,omitempty"` // super armour halved the damage
+	Wounds int  `json:"wounds"`
+}
+
+// DamageResult is the outcome of a damage roll: what each hit dealt and the
+// wounds the target takes in total.
+type DamageResult struct {
+	DamageProfile
+	Hits   []DamageHit `json:"hits"`
+	Wounds int         `json:"wounds"`
+}
+
+// DamageProfileFor builds the damage of the weapon at path on the attacker's
+// sheet against the target sheet, hit on locations such as "rightArm". A
+// melee weapon path may end in tabs.items.<id> to pick one of its profiles,
+// otherwise the first one is used.
+func DamageProfileFor(attacker json.RawMessage, path []string, target json.RawMessage, locations []string) (DamageProfile, error) {
+	raw, err := weaponItem(attacker, path)
+	if err != nil {
+		return DamageProfile{}, err
+	}
+
+	var p DamageProfile
+	switch {
+	case path[0] == rangedAttacksSection && len(path) == 4:
+		var weapon models.RangedAttack
+		if err := json.Unmarshal(raw, &weapon); err != nil {
+			return DamageProfile{}, fmt.Errorf("unmarshal ranged attack: %w", err)
+		}
+		p = weaponDamage(weapon.Name, weapon.Damage, weapon.DamageType, weapon.Pen)
+
+	case path[0] == meleeAttacksSection && (len(path) == 4 || len(path) == 7 && path[4] == "tabs" && path[5] == "items"):
+		var weapon models.MeleeAttack
+		if err := json.Unmarshal(raw, &weapon); err != nil {
+			return DamageProfile{}, fmt.Errorf("unmarshal melee attack: %w", err)
+		}
+		tabID := firstItem(weapon.Tabs)
+		if len(path) == 7 {
+			tabID = path[6]
+		}
+		tab, ok := weapon.Tabs.Items[tabID]
+		if !ok {
+			return DamageProfile{}, errors.New("weapon profile not found")
+		}
+		name := weapon.Name
+		if profile := strings.TrimSpace(tab.Profile); profile != "" {
+			name += " (" + profile + ")"
+		}
+		p = weaponDamage(name, tab.Damage, tab.DamageType, tab.Pen)
+
+	default:
+		return DamageProfile{}, fmt.Errorf("path %q is not a weapon", strings.Join(path, "."))
+	}
+	if p.Damage == "" {
+		return DamageProfile{}, fmt.Errorf("%s has no damage", p.Label)
+	}
+
+	var sheet models.CharacterSheetContent
+	if err := json.Unmarshal(target, &sheet); err != nil {
+		return DamageProfile{}, fmt.Errorf("unmarshal target sheet: %w", err)
+	}
+	p.Target = sheet.CharacterInfo.CharacterName
+	for _, loc := range locations {
+		armour, ok := sheet.ArmourAt(loc)
+		if !ok {
+			return DamageProfile{}, fmt.Errorf("unknown hit location %q", loc)
+		}
+		p.Locations = append(p.Locations, HitArmour{Location: loc, LocationArmour: armour})
+	}
+	return p, nil
+}
+
+func weaponDamage(name, damage, damageType, pen string) DamageProfile {
+	if strings.TrimSpace(name) == "" {
+		name = "Unknown"
+	}
+	p := DamageProfile{
+		Label:      name,
+		Damage:     strings.TrimSpace(damage),
+		DamageType: strings.TrimSpace(damageType),
+	}
+	// Pen cells may carry notes, e.g. "4 (Razor Sharp)"; no number means 0
+	p.Pen, _ = leadingNumber(pen)
+	return p
+}
+
+// firstItem is the ID of the item laid out first in the grid: top row
+// first, then leftmost.
+func firstItem[T any](grid models.ItemGrid[T]) string {
+	ids := make([]string, 0, len(grid.Items))
+	for id := range grid.Items {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		pa, pb := grid.Layouts[a], grid.Layouts[b]
+		return cmp.Or(
+			cmp.Compare(pa.RowIndex, pb.RowIndex),
+			cmp.Compare(pa.ColIndex, pb.ColIndex),
+			strings.Compare(a, b),
+		)
+	})
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[0]
+}
+
+// RollDamage rolls the weapon's damage once per hit with dice drawn from
+// seed and takes the target's armour off each hit. @references in the
+// damage are looked up through env, as for /r.
+func RollDamage(ctx context.Context, env *Env, profile DamageProfile, seed Seed) CommandResult {
+	if len(profile.Locations) == 0 {
+		return CommandResult{Success: false, Result: "The attack did not hit"}
+	}
+
+	roll, err := ParseRoll(profile.Damage)
+	if err != nil {
+		return CommandResult{Success: false, Result: fmt.Sprintf("Damage %q: %s", profile.Damage, err)}
+	}
+	if roll.Target != nil || roll.Repeat > 0 {
+		return CommandResult{Success: false, Result: fmt.Sprintf("Damage %q must be a plain dice expression", profile.Damage)}
+	}
+	if err := resolveRefs(ctx, env, roll); err != nil {
+		return CommandResult{Success: false, Result: err.Error()}
+	}
+
+	roll.Repeat = len(profile.Locations)
+	result, err := evaluateRoll(roll, seed.Rand())
+	if err != nil {
+		return CommandResult{Success: false, Result: err.Error()}
+	}
+
+	damage := &DamageResult{DamageProfile: profile}
+	for i, line := range result.Lines {
+		armour := profile.Locations[i].LocationArmour
+		hit := DamageHit{
+			Rolled: line.Total,
+			Halved: armour.Halves(profile.Pen),
+			Wounds: armour.Wounds(line.Total, profile.Pen),
+		}
+		damage.Hits = append(damage.Hits, hit)
+		damage.Wounds += hit.Wounds
+	}
+	result.Damage = damage
+
+	return CommandResult{
+		Success: true,
+		Result:  result.Text(),
+		Roll:    result,
+		Audit:   rollAudit(seed, result),
+	}
+}
+
+// Text renders a damage roll, one hit per line, e.g.
+// "Body: 7+4 = 11 - armour 2 (6 - pen 4) - toughness 4 = 5 wounds".
+func (d *DamageResult) Text(lines []RollLine) string {
+	var sb strings.Builder
+	damage := d.Damage
+	if d.DamageType != "" {
+		damage += " " + d.DamageType
+	}
+	sb.WriteString(fmt.Sprintf("%s damage to %s (%s, pen %d):\n", d.Label, d.Target, damage, d.Pen))
+
+	for i, hit := range d.Hits {
+		loc := d.Locations[i]
+		line := lines[i]
+		sb.WriteString(locationNames[loc.Location] + ": " + breakdown(line.Breakdown, line.Total))
+		if hit.Halved {
+			sb.WriteString(fmt.Sprintf(", halved by super armour %d to %d", loc.SuperArmour, (hit.Rolled+1)/2))
+		}
+		armour := max(0, loc.Armour-d.Pen)
+		if d.Pen > 0 && loc.Armour > 0 {
+			sb.WriteString(fmt.Sprintf(" - armour %d (%d - pen %d)", armour, loc.Armour, d.Pen))
+		} else {
+			sb.WriteString(fmt.Sprintf(" - armour %d", armour))
+		}
+		sb.WriteString(fmt.Sprintf(" - toughness %d = %s\n", loc.Toughness, woundsText(hit.Wounds)))
+	}
+
+	sb.WriteString("Total: " + woundsText(d.Wounds))
+	return sb.String()
+}
+
+func woundsText(n int) string {
+	if n == 1 {
+		return "1 wound"
+	}
+	return fmt.Sprintf("%d wounds", n)
+}
+
+// MessageBody is the chat message a damage roll is posted as: the dice it
+// amounts to, labelled with the weapon and the target.
+func (p DamageProfile) MessageBody() string {
+	expr := p.Damage
+	if len(p.Locations) > 1 {
+		expr = fmt.Sprintf("%dx(%s)", len(p.Locations), p.Damage)
+	}
+	return "/r " + expr + "\n>> " + p.Label + " damage to " + p.Target
+}
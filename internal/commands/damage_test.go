@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+const damageTestAttacker = `{
+	"rangedAttacks": {"list": {"items": {
+		"bolter": {"name": "Boltgun", "damage": "1d10+9", "pen": "4", "damageType": "X"}
+	}}},
+	"meleeAttacks": {"list": {"items": {
+		"sword": {"name": "Chainsword", "tabs": {
+			"items": {
+				"a": {"profile": "Rev", "damage": "12", "pen": "2 (Tearing)"},
+				"b": {"profile": "Idle", "damage": "1d10"}
+			},
+			"layouts": {"a": {"colIndex": 1, "rowIndex": 0}, "b": {"colIndex": 0, "rowIndex": 0}}
+		}},
+		"fist": {"name": "Fist", "tabs": {"items": {"a": {"damage": ""}}}}
+	}}}
+}`
+
+const damageTestTarget = `{
+	"characterInfo": {"characterName": "Ork Boy"},
+	"characteristics": {"T": {"value": "45"}},
+	"armour": {
+		"body": {"armourValue": 4, "extra1Value": 2},
+		"head": {"armourValue": 2, "superArmour": 8},
+		"naturalArmourValue": 1,
+		"daemonicValue": 1
+	}
+}`
+
+func TestDamageProfileFor(t *testing.T) {
+	profile, err := DamageProfileFor(json.RawMessage(damageTestAttacker), strings.Split("rangedAttacks.list.items.bolter", "."),
+		json.RawMessage(damageTestTarget), []string{"body", "head"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Label != "Boltgun" || profile.Damage != "1d10+9" || profile.DamageType != "X" || profile.Pen != 4 || profile.Target != "Ork Boy" {
+		t.Errorf("profile = %+v", profile)
+	}
+	want := []HitArmour{
+		{"body", models.LocationArmour{Armour: 4 + 2 + 1, Toughness: 4 + 1}},
+		{"head", models.LocationArmour{Armour: 2 + 1, Toughness: 4 + 1, SuperArmour: 8}},
+	}
+	for i, loc := range profile.Locations {
+		if loc != want[i] {
+			t.Errorf("location %d = %+v, want %+v", i, loc, want[i])
+		}
+	}
+
+	tests := []struct {
+		path      string
+		wantLabel string
+		wantPen   int
+	}{
+		{"meleeAttacks.list.items.sword", "Chainsword (Idle)", 0},
+		{"meleeAttacks.list.items.sword.tabs.items.a", "Chainsword (Rev)", 2},
+	}
+	for _, tt := range tests {
+		p, err := DamageProfileFor(json.RawMessage(damageTestAttacker), strings.Split(tt.path, "."),
+			json.RawMessage(damageTestTarget), []string{"body"})
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if p.Label != tt.wantLabel || p.Pen != tt.wantPen {
+			t.Errorf("%s = %q pen %d, want %q pen %d", tt.path, p.Label, p.Pen, tt.wantLabel, tt.wantPen)
+		}
+	}
+
+	for _, path := range []string{
+		"meleeAttacks.list.items.fist",
+		"meleeAttacks.list.items.sword.tabs.items.missing",
+		"rangedAttacks.list.items.bolter.tabs.items.a",
+	} {
+		if _, err := DamageProfileFor(json.RawMessage(damageTestAttacker), strings.Split(path, "."),
+			json.RawMessage(damageTestTarget), []string{"body"}); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+	if _, err := DamageProfileFor(json.RawMessage(damageTestAttacker), strings.Split("rangedAttacks.list.items.bolter", "."),
+		json.RawMessage(damageTestTarget), []string{"tail"}); err == nil {
+		t.Error("tail is not a hit location")
+	}
+}
+
+func TestRollDamage(t *testing.T) {
+	profile := DamageProfile{
+		Label:  "Chainsword",
+		Damage: "12",
+		Pen:    2,
+		Target: "Ork Boy",
+		Locations: []HitArmour{
+			{"body", models.LocationArmour{Armour: 7, Toughness: 5}},
+			{"head", models.LocationArmour{Armour: 3, Toughness: 5, SuperArmour: 8}},
+		},
+	}
+	res := RollDamage(context.Background(), nil, profile, NewRoomRNG().NextSeed())
+	if !res.Success {
+		t.Fatalf("damage failed: %s", res.Result)
+	}
+	damage := res.Roll.Damage
+	// body: 12 - (7-2) - 5 = 2; head: 12 halved to 6 - (3-2) - 5 = 0
+	if len(damage.Hits) != 2 || damage.Hits[0].Wounds != 2 || !damage.Hits[1].Halved || damage.Hits[1].Wounds != 0 || damage.Wounds != 2 {
+		t.Errorf("hits = %+v, wounds %d", damage.Hits, damage.Wounds)
+	}
+	if !strings.HasSuffix(res.Result, "Total: 2 wounds") {
+		t.Errorf("result = %q", res.Result)
+	}
+
+	for _, bad := range []string{"d100 vs 50", "2x(d10)", "d10+"} {
+		p := profile
+		p.Damage = bad
+		if res := RollDamage(context.Background(), nil, p, NewRoomRNG().NextSeed()); res.Success {
+			t.Errorf("damage %q should not roll", bad)
+		}
+	}
+	p := profile
+	p.Locations = nil
+	if res := RollDamage(context.Background(), nil, p, NewRoomRNG().NextSeed()); res.Success {
+		t.Error("a miss should not roll damage")
+	}
+}
+
+func TestVerifyDamageRoll(t *testing.T) {
+	ctx := context.Background()
+	profile := DamageProfile{
+		Label:     "Boltgun",
+		Damage:    "1d10+@SB",
+		Pen:       4,
+		Target:    "Ork Boy",
+		Locations: []HitArmour{{"body", models.LocationArmour{Armour: 7, Toughness: 5}}, {"rightArm", models.LocationArmour{}}},
+	}
+	res := RollDamage(ctx, refEnv(2), profile, NewRoomRNG().NextSeed())
+	if !res.Success || res.Audit == nil {
+		t.Fatalf("damage failed: %+v", res)
+	}
+	if res.Roll.Refs["@SB"] != 3 {
+		t.Errorf("refs = %v, want @SB = 3", res.Roll.Refs)
+	}
+	data, err := json.Marshal(res.Roll)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := models.Message{MessageBody: profile.MessageBody(), CommandResult: &res.Result, CommandData: data}
+	v, err := VerifyRoll(ctx, msg, *res.Audit, nil)
+	if err != nil || !v.Verified {
+		t.Fatalf("damage roll did not verify: %+v, %v", v, err)
+	}
+}
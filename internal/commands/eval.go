@@ -0,0 +1,319 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type function struct {
+	minArgs int
+	maxArgs int // 0 means unlimited
+	call    func(args []int) int
+}
+
+var functions = map[string]function{
+	"min": {minArgs: 1, call: func(args []int) int {
+		m := args[0]
+		for _, a := range args[1:] {
+			m = min(m, a)
+		}
+		return m
+	}},
+	"max": {minArgs: 1, call: func(args []int) int {
+		m := args[0]
+		for _, a := range args[1:] {
+			m = max(m, a)
+		}
+		return m
+	}},
+	"abs": {minArgs: 1, maxArgs: 1, call: func(args []int) int {
+		if args[0] < 0 {
+			return -args[0]
+		}
+		return args[0]
+	}},
+}
+
+// evalResult is the value of a node together with its human-readable
+// breakdown, e.g. "3 + (1) + 5 + 6" for 4d6k3.
+type evalResult struct {
+	value int
+	text  string
+	// compound is set when text has several top-level terms and needs
+	// parentheses when used as an operand of * / or unary minus.
+	compound bool
+	groups   []DiceGroup
+}
+
+func (r evalResult) operand() string {
+	if r.compound {
+		return "(" + r.text + ")"
+	}
+	return r.text
+}
+
+type evaluator struct {
+	rng *rand.Rand
+	// rolled counts every die drawn so far, explosions and rerolls
+	// included, across all evaluations of the roll.
+	rolled int
+}
+
+func (ev *evaluator) eval(n Node) (evalResult, error) {
+	switch n := n.(type) {
+	case *NumberNode:
+		return evalResult{value: n.Value, text: strconv.Itoa(n.Value)}, nil
+
+	case *DiceNode:
+		return ev.rollDice(n)
+
+	case *UnaryNode:
+		x, err := ev.eval(n.X)
+		if err != nil {
+			return evalResult{}, err
+		}
+		return evalResult{value: -x.value, text: "-" + x.operand(), groups: x.groups}, nil
+
+	case *ParenNode:
+		x, err := ev.eval(n.X)
+		if err != nil {
+			return evalResult{}, err
+		}
+		return evalResult{value: x.value, text: "(" + x.text + ")", groups: x.groups}, nil
+
+	case *BinaryNode:
+		return ev.evalBinary(n)
+
+	case *CallNode:
+		fn := functions[n.Name]
+		args := make([]int, len(n.Args))
+		texts := make([]string, len(n.Args))
+		var groups []DiceGroup
+		for i, arg := range n.Args {
+			r, err := ev.eval(arg)
+			if err != nil {
+				return evalResult{}, err
+			}
+			args[i] = r.value
+			texts[i] = r.text
+			groups = append(groups, r.groups...)
+		}
+		return evalResult{
+			value:  fn.call(args),
+			text:   fmt.Sprintf("%s(%s)", n.Name, strings.Join(texts, ", ")),
+			groups: groups,
+		}, nil
+
+	case *RefNode:
+		if !n.Resolved {
+			return evalResult{}, fmt.Errorf("%s was not looked up on a character sheet", n.Text)
+		}
+		return evalResult{value: n.Value, text: strconv.Itoa(n.Value)}, nil
+	}
+	return evalResult{}, fmt.Errorf("unsupported expression at column %d", n.Column())
+}
+
+func (ev *evaluator) evalBinary(n *BinaryNode) (evalResult, error) {
+	left, err := ev.eval(n.Left)
+	if err != nil {
+		return evalResult{}, err
+	}
+	right, err := ev.eval(n.Right)
+	if err != nil {
+		return evalResult{}, err
+	}
+
+	groups := append(left.groups[:len(left.groups):len(left.groups)], right.groups...)
+
+	switch n.Op {
+	case '+':
+		sum, ok := addInt(left.value, right.value)
+		if !ok {
+			return evalResult{}, &SyntaxError{Col: n.Col, Msg: "result too large"}
+		}
+		return evalResult{value: sum, text: left.text + " + " + right.text, compound: true, groups: groups}, nil
+	case '-':
+		diff, ok := subInt(left.value, right.value)
+		if !ok {
+			return evalResult{}, &SyntaxError{Col: n.Col, Msg: "result too large"}
+		}
+		return evalResult{value: diff, text: left.text + " - " + right.operand(), compound: true, groups: groups}, nil
+	case '*':
+		product, ok := mulInt(left.value, right.value)
+		if !ok {
+			return evalResult{}, &SyntaxError{Col: n.Col, Msg: "result too large"}
+		}
+		if n.Implicit {
+			return evalResult{value: product, text: left.text + right.text, groups: groups}, nil
+		}
+		return evalResult{value: product, text: left.operand() + " * " + right.operand(), groups: groups}, nil
+	case '/':
+		if right.value == 0 {
+			return evalResult{}, &SyntaxError{Col: n.Right.Column(), Msg: "division by zero"}
+		}
+		return evalResult{value: floorDiv(left.value, right.value), text: left.operand() + " / " + right.operand(), groups: groups}, nil
+	}
+	return evalResult{}, fmt.Errorf("unknown operator '%c' at column %d", n.Op, n.Col)
+}
+
+// addInt adds a and b, reporting false if the sum overflows an int.
+func addInt(a, b int) (int, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+// subInt subtracts b from a, reporting false if the difference overflows
+// an int.
+func subInt(a, b int) (int, bool) {
+	c := a - b
+	return c, (c < a) == (b > 0)
+}
+
+// mulInt multiplies a and b, reporting false if the product overflows an
+// int.
+func mulInt(a, b int) (int, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if (a == -1 && b == math.MinInt) || (b == -1 && a == math.MinInt) || c/b != a {
+		return c, false
+	}
+	return c, true
+}
+
+// floorDiv divides rounding down, so -7/2 is -4 rather than Go's -3.
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// maxExplosions bounds how many extra dice a single die can chain into.
+const maxExplosions = 100
+
+// maxRolledDice bounds how many dice one roll may draw in total, counting
+// every repetition, explosion and reroll.
+const maxRolledDice = 5000
+
+var errTooManyDice = fmt.Errorf("Too many dice: a roll can draw at most %d dice including explosions and rerolls", maxRolledDice)
+
+// draw rolls one die, failing once the roll has used up its dice budget.
+func (ev *evaluator) draw(sides int) (int, error) {
+	ev.rolled++
+	if ev.rolled > maxRolledDice {
+		return 0, errTooManyDice
+	}
+	return ev.rng.Intn(sides) + 1, nil
+}
+
+func (ev *evaluator) rollDie(n *DiceNode) (Die, error) {
+	v, err := ev.draw(n.Sides)
+	if err != nil {
+		return Die{}, err
+	}
+	d := Die{Value: v, Kept: true}
+	for n.Reroll != nil && n.Reroll.Match(d.Value) {
+		d.Rerolled = append(d.Rerolled, d.Value)
+		if d.Value, err = ev.draw(n.Sides); err != nil {
+			return Die{}, err
+		}
+		if n.RerollOnce || len(d.Rerolled) >= maxExplosions {
+			break
+		}
+	}
+	return d, nil
+}
+
+func (ev *evaluator) rollDice(n *DiceNode) (evalResult, error) {
+	var dice []Die
+	for i := 0; i < n.Count; i++ {
+		d, err := ev.rollDie(n)
+		if err != nil {
+			return evalResult{}, err
+		}
+		for chain := 0; n.Explode != nil && n.Explode.Match(d.Value) && chain < maxExplosions; chain++ {
+			d.Exploded = true
+			dice = append(dice, d)
+			if d, err = ev.rollDie(n); err != nil {
+				return evalResult{}, err
+			}
+		}
+		dice = append(dice, d)
+	}
+
+	if n.Keep > 0 && n.Keep < len(dice) {
+		order := make([]int, len(dice))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			if n.KeepLowest {
+				return dice[order[a]].Value < dice[order[b]].Value
+			}
+			return dice[order[a]].Value > dice[order[b]].Value
+		})
+		for _, idx := range order[n.Keep:] {
+			dice[idx].Kept = false
+		}
+	}
+
+	parts := make([]string, len(dice))
+	total := 0
+	for i := range dice {
+		d := &dice[i]
+		if n.CritSuccess != nil {
+			d.CritSuccess = n.CritSuccess.Match(d.Value)
+		}
+		if n.CritFail != nil {
+			d.CritFail = n.CritFail.Match(d.Value)
+		}
+		if d.Kept {
+			if n.Success != nil {
+				d.Success = n.Success.Match(d.Value)
+				if d.Success {
+					total++
+				}
+			} else {
+				total += d.Value
+			}
+		}
+		parts[i] = d.String()
+	}
+
+	groups := []DiceGroup{{Expression: n.Text, Sides: n.Sides, Dice: dice, Subtotal: total}}
+
+	// A success pool totals the number of successes, not the faces, so it
+	// is shown as a list rather than a sum.
+	if n.Success != nil {
+		return evalResult{value: total, text: "{" + strings.Join(parts, ", ") + "}", groups: groups}, nil
+	}
+	return evalResult{value: total, text: strings.Join(parts, " + "), compound: len(dice) > 1, groups: groups}, nil
+}
+
+// maxBreakdownLen bounds the breakdown shown for one line of a roll; the
+// individual dice are still kept in the line's groups.
+const maxBreakdownLen = 2000
+
+// truncateBreakdown shortens text to at most maxBreakdownLen bytes, cutting
+// between terms and marking the cut with "…".
+func truncateBreakdown(text string) string {
+	if len(text) <= maxBreakdownLen {
+		return text
+	}
+	cut := strings.LastIndexByte(text[:maxBreakdownLen], ' ')
+	if cut < 0 {
+		cut = maxBreakdownLen
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+	}
+	return text[:cut] + " …"
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// helpCommand is /help: it documents the commands of its registry. The
+// reply is private to the sender.
+type helpCommand struct {
+	registry *Registry
+}
+
+func (helpCommand) Name() string      { return "help" }
+func (helpCommand) Aliases() []string { return nil }
+
+func (helpCommand) Help() Help {
+	return Help{
+		Description: "show command help",
+		DetailedDescription: `/help — list every command with its usage
+/help r — show the usage of /r only
+
+Help is shown only to you and is not saved in the chat`,
+	}
+}
+
+func (c helpCommand) Execute(ctx context.Context, env *Env, args string) CommandResult {
+	name := strings.TrimPrefix(strings.TrimSpace(args), "/")
+	if name != "" {
+		cmd, ok := c.registry.Lookup(name)
+		if !ok {
+			return CommandResult{
+				Success: false,
+				Result:  "Unknown command: /" + name,
+				Private: true,
+			}
+		}
+		return CommandResult{
+			Success: true,
+			Result:  describeCommand(cmd),
+			Private: true,
+		}
+	}
+
+	cmds := c.registry.Commands()
+	sections := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		sections[i] = describeCommand(cmd)
+	}
+	return CommandResult{
+		Success: true,
+		Result:  strings.Join(sections, "\n\n"),
+		Private: true,
+	}
+}
+
+// describeCommand renders "/r (/roll) — roll a die" followed by the detailed usage.
+func describeCommand(cmd Command) string {
+	var sb strings.Builder
+	sb.WriteString("/" + cmd.Name())
+	for _, alias := range cmd.Aliases() {
+		sb.WriteString(" (/" + alias + ")")
+	}
+
+	help := cmd.Help()
+	if help.Description != "" {
+		sb.WriteString(fmt.Sprintf(" — %s", help.Description))
+	}
+	if help.DetailedDescription != "" {
+		sb.WriteString("\n")
+		sb.WriteString(help.DetailedDescription)
+	}
+	return sb.String()
+}
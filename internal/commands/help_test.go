@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestHelpCommand(t *testing.T) {
+	ctx := context.Background()
+	env := &Env{UserID: 1, RoomID: 1}
+
+	all := ParseAndExecuteCommand(ctx, env, "/help")
+	if !all.Success || !all.Private {
+		t.Fatalf("/help = %+v, want a private success", all)
+	}
+	for _, want := range []string{"/r (/roll) — roll a die", "4d6k3", "/help — show command help"} {
+		if !strings.Contains(all.Result, want) {
+			t.Errorf("/help is missing %q:\n%s", want, all.Result)
+		}
+	}
+
+	one := ParseAndExecuteCommand(ctx, env, "/help r")
+	if !one.Success || !one.Private || !strings.HasPrefix(one.Result, "/r (/roll)") {
+		t.Errorf("/help r = %+v", one)
+	}
+	if strings.Contains(one.Result, "/help") {
+		t.Errorf("/help r should only describe /r:\n%s", one.Result)
+	}
+
+	missing := ParseAndExecuteCommand(ctx, env, "/help nope")
+	if missing.Success || !missing.Private || missing.Result != "Unknown command: /nope" {
+		t.Errorf("/help nope = %+v", missing)
+	}
+}
@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"context"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+// RollInitiative rolls an initiative expression such as "d10+@AB" with dice
+// drawn from seed. References are read from sheet, which is nil for entries
+// typed in by hand. Only a single plain roll makes an initiative: versus and
+// repeated rolls fail.
+func RollInitiative(ctx context.Context, sheet *models.CharacterSheetContent, expression string, seed Seed) CommandResult {
+	env := &Env{}
+	if sheet != nil {
+		env.Refs = contentRefs{sheet: sheet}
+	}
+	result := executeSeededRoll(ctx, env, expression, seed)
+	if !result.Success {
+		return result
+	}
+	if result.Roll.IsVersus() || result.Roll.Repeat > 0 {
+		return CommandResult{Success: false, Result: "Initiative must be a plain roll such as d10+4"}
+	}
+	return result
+}
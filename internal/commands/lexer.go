@@ -0,0 +1,187 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxNumber caps integer literals so arithmetic on them cannot overflow.
+const maxNumber = 1_000_000_000
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokPlus
+	tokMinus
+	tokStar
+	tokSlash
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+	tokBang
+	tokCompare // one of = < <= > >=
+	tokRef     // a sheet reference such as @WS or @{Name}.WS
+)
+
+var punctuation = map[rune]tokenKind{
+	'+': tokPlus,
+	'-': tokMinus,
+	'*': tokStar,
+	'/': tokSlash,
+	'(': tokLParen,
+	')': tokRParen,
+	'[': tokLBracket,
+	']': tokRBracket,
+	',': tokComma,
+	'!': tokBang,
+}
+
+type token struct {
+	kind tokenKind
+	text string
+	num  int
+	col  int // 1-based column in the source expression
+
+	// tokRef only: the named sheet, empty for the sender's own, and the
+	// characteristic or skill
+	sheet string
+	name  string
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return "'" + t.text + "'"
+}
+
+func (t token) isIdent(name string) bool {
+	return t.kind == tokIdent && t.text == name
+}
+
+// SyntaxError reports a malformed roll expression together with the
+// column it was detected at, so the user can find the typo.
+type SyntaxError struct {
+	Col int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Msg, e.Col)
+}
+
+// tokenize splits src into tokens. Letters and digits always form separate
+// tokens, so "4d6k3" becomes 4, d, 6, k, 3 and "d100vs70" becomes d, 100, vs, 70.
+func tokenize(src string) ([]token, error) {
+	runes := []rune(src)
+	var toks []token
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		col := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r >= '0' && r <= '9':
+			j := i
+			for j < len(runes) && runes[j] >= '0' && runes[j] <= '9' {
+				j++
+			}
+			text := string(runes[i:j])
+			n, err := strconv.Atoi(text)
+			if err != nil || n > maxNumber {
+				return nil, &SyntaxError{Col: col, Msg: fmt.Sprintf("number %s is too large", text)}
+			}
+			toks = append(toks, token{kind: tokNumber, text: text, num: n, col: col})
+			i = j
+
+		case unicode.IsLetter(r):
+			j := i
+			for j < len(runes) && unicode.IsLetter(runes[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: string(runes[i:j]), col: col})
+			i = j
+
+		case r == '<' || r == '>' || r == '=':
+			j := i + 1
+			if r != '=' && j < len(runes) && runes[j] == '=' {
+				j++
+			}
+			toks = append(toks, token{kind: tokCompare, text: string(runes[i:j]), col: col})
+			i = j
+
+		case r == '@':
+			tok, j, err := lexRef(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, tok)
+			i = j
+
+		default:
+			kind, ok := punctuation[r]
+			if !ok {
+				return nil, &SyntaxError{Col: col, Msg: fmt.Sprintf("invalid character '%c'", r)}
+			}
+			toks = append(toks, token{kind: kind, text: string(r), col: col})
+			i++
+		}
+	}
+
+	toks = append(toks, token{kind: tokEOF, col: len(runes) + 1})
+	return toks, nil
+}
+
+// lexRef reads the reference starting at the '@' at runes[i] and returns it
+// with the index just past it. A reference is "@name" or "@{sheet}.name",
+// where name is letters, digits and underscores.
+func lexRef(runes []rune, i int) (token, int, error) {
+	col := i + 1
+	j := i + 1
+
+	var sheet string
+	if j < len(runes) && runes[j] == '{' {
+		end := j + 1
+		for end < len(runes) && runes[end] != '}' {
+			end++
+		}
+		if end == len(runes) {
+			return token{}, 0, &SyntaxError{Col: col, Msg: "missing '}' after sheet name"}
+		}
+		sheet = strings.TrimSpace(string(runes[j+1 : end]))
+		if sheet == "" {
+			return token{}, 0, &SyntaxError{Col: col, Msg: "empty sheet name"}
+		}
+		j = end + 1
+		if j == len(runes) || runes[j] != '.' {
+			return token{}, 0, &SyntaxError{Col: j + 1, Msg: "expected '.' and a characteristic or skill after the sheet name"}
+		}
+		j++
+	}
+
+	start := j
+	for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+		j++
+	}
+	if j == start {
+		return token{}, 0, &SyntaxError{Col: start + 1, Msg: "expected a characteristic or skill after '@'"}
+	}
+
+	return token{
+		kind:  tokRef,
+		text:  string(runes[i:j]),
+		col:   col,
+		sheet: sheet,
+		name:  string(runes[start:j]),
+	}, j, nil
+}
@@ -0,0 +1,422 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	maxDiceCount = 1000
+	maxDiceSides = 100000
+	maxRepeat    = 100
+	// maxRollDice bounds the dice a whole roll may ask for: every group
+	// of the expression, times the repetition count.
+	maxRollDice = 2000
+)
+
+// Grammar:
+//
+//	roll     = number "x" "(" versus ")" | versus
+//	versus   = expr [ "vs" expr [ "[" "+" number "]" ] ]
+//	expr     = term { ("+" | "-") term }
+//	term     = unary { ("*" | "/") unary }
+//	unary    = "-" unary | primary
+//	primary  = dice | number "(" expr ")" | number | "(" expr ")" | call | ref
+//	dice     = [ number ] "d" number { modifier }
+//	modifier = ("k" | "l") number | "!" [ cmp ] | ("r" | "ro") cmp
+//	         | ("cs" | "cf") cmp | cmp
+//	cmp      = [ "=" | "<" | "<=" | ">" | ">=" ] number
+//	call     = ident "(" expr { "," expr } ")"
+//	ref      = "@" name | "@" "{" sheet "}" "." name
+type parser struct {
+	toks []token
+	pos  int
+}
+
+// ParseRoll parses a complete /roll argument: an expression, optionally
+// tested against a target with "vs", optionally repeated with "Nx(...)".
+func ParseRoll(src string) (*Roll, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+
+	roll := &Roll{}
+	if p.peek().kind == tokNumber && p.peekAt(1).isIdent("x") && p.peekAt(2).kind == tokLParen {
+		n := p.next()
+		p.next()
+		p.next()
+		if n.num < 1 || n.num > maxRepeat {
+			return nil, errors.New("Repetition count must be between 1 and 100")
+		}
+		roll.Repeat = n.num
+
+		if err := p.parseVersus(roll); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen); err != nil {
+			return nil, err
+		}
+	} else if err := p.parseVersus(roll); err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	if err := checkDiceBudget(roll.Expr, max(1, roll.Repeat)); err != nil {
+		return nil, err
+	}
+	return roll, nil
+}
+
+// ParseExpr parses a bare arithmetic dice expression such as "2d10+5".
+func ParseExpr(src string) (Node, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	if err := checkDiceBudget(n, 1); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// checkDiceBudget rejects an expression that, evaluated repeat times,
+// would roll more than maxRollDice dice before any explode or reroll.
+func checkDiceBudget(n Node, repeat int) error {
+	count := 0
+	walk(n, func(n Node) {
+		if d, ok := n.(*DiceNode); ok {
+			count += d.Count
+		}
+	})
+	if count*repeat > maxRollDice {
+		return fmt.Errorf("Too many dice: a roll can use at most %d dice in total", maxRollDice)
+	}
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.peekAt(0)
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if p.pos < len(p.toks)-1 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind) (token, error) {
+	t := p.peek()
+	if t.kind != kind {
+		return t, p.unexpected(t)
+	}
+	return p.next(), nil
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokEOF {
+		return &SyntaxError{Col: t.col, Msg: "unexpected end of expression"}
+	}
+	return &SyntaxError{Col: t.col, Msg: fmt.Sprintf("unexpected %s", t)}
+}
+
+// textSince joins the tokens consumed since start, which reproduces the
+// source without whitespace.
+func (p *parser) textSince(start int) string {
+	var sb strings.Builder
+	for _, t := range p.toks[start:p.pos] {
+		sb.WriteString(t.text)
+	}
+	return sb.String()
+}
+
+func (p *parser) parseVersus(roll *Roll) error {
+	start := p.pos
+	expr, err := p.parseExpr()
+	if err != nil {
+		return err
+	}
+	roll.Expr = expr
+	roll.ExprText = p.textSince(start)
+
+	if !p.peek().isIdent("vs") {
+		return nil
+	}
+	p.next()
+
+	target, err := p.parseExpr()
+	if err != nil {
+		return err
+	}
+	if containsDice(target) {
+		return &SyntaxError{Col: target.Column(), Msg: "versus target cannot contain dice"}
+	}
+	roll.Target = target
+
+	if p.peek().kind != tokLBracket {
+		return nil
+	}
+	p.next()
+	if _, err := p.expect(tokPlus); err != nil {
+		return err
+	}
+	bonus, err := p.expect(tokNumber)
+	if err != nil {
+		return err
+	}
+	if _, err := p.expect(tokRBracket); err != nil {
+		return err
+	}
+	roll.Bonus = bonus.num
+	return nil
+}
+
+func (p *parser) parseExpr() (Node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokPlus && t.kind != tokMinus {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{Op: t.text[0], Left: left, Right: right, Col: left.Column()}
+	}
+}
+
+func (p *parser) parseTerm() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokStar && t.kind != tokSlash {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{Op: t.text[0], Left: left, Right: right, Col: left.Column()}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if t := p.peek(); t.kind == tokMinus {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryNode{X: x, Col: t.col}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.peek()
+	start := p.pos
+	switch {
+	case t.kind == tokNumber:
+		p.next()
+		if p.peek().isIdent("d") {
+			return p.parseDice(t.num, start)
+		}
+		if p.peek().kind == tokLParen {
+			inner, err := p.parseParen()
+			if err != nil {
+				return nil, err
+			}
+			number := &NumberNode{Value: t.num, Col: t.col}
+			return &BinaryNode{Op: '*', Left: number, Right: inner, Implicit: true, Col: t.col}, nil
+		}
+		return &NumberNode{Value: t.num, Col: t.col}, nil
+
+	case t.isIdent("d"):
+		return p.parseDice(1, start)
+
+	case t.kind == tokIdent && p.peekAt(1).kind == tokLParen:
+		return p.parseCall()
+
+	case t.kind == tokLParen:
+		return p.parseParen()
+
+	case t.kind == tokRef:
+		p.next()
+		return &RefNode{Sheet: t.sheet, Name: t.name, Text: t.text, Col: t.col}, nil
+	}
+	return nil, p.unexpected(t)
+}
+
+func (p *parser) parseParen() (Node, error) {
+	open := p.next()
+	x, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokRParen); err != nil {
+		return nil, err
+	}
+	return &ParenNode{X: x, Col: open.col}, nil
+}
+
+// parseDice parses the "d" and everything after it; the count has already
+// been consumed by the caller. start is the index of the first token of the term.
+func (p *parser) parseDice(count, start int) (Node, error) {
+	col := p.toks[start].col
+	p.next() // "d"
+	sides, err := p.expect(tokNumber)
+	if err != nil {
+		return nil, err
+	}
+	if count < 1 || count > maxDiceCount {
+		return nil, &SyntaxError{Col: col, Msg: "dice count must be between 1 and 1000"}
+	}
+	if sides.num < 1 || sides.num > maxDiceSides {
+		return nil, &SyntaxError{Col: sides.col, Msg: "dice sides must be between 1 and 100000"}
+	}
+	dice := &DiceNode{Count: count, Sides: sides.num, Col: col}
+
+	for {
+		mod := p.peek()
+		switch {
+		case mod.isIdent("k") || mod.isIdent("l"):
+			p.next()
+			n, err := p.expect(tokNumber)
+			if err != nil {
+				return nil, err
+			}
+			if n.num < 1 {
+				return nil, &SyntaxError{Col: n.col, Msg: "keep count must be at least 1"}
+			}
+			dice.Keep = n.num
+			dice.KeepLowest = mod.text == "l"
+
+		case mod.kind == tokBang:
+			p.next()
+			dice.Explode = &Compare{Op: "=", Value: dice.Sides}
+			if p.peek().kind == tokCompare {
+				cmp, err := p.parseCompare(false)
+				if err != nil {
+					return nil, err
+				}
+				dice.Explode = cmp
+			}
+			if dice.Explode.matchesAll(dice.Sides) {
+				return nil, &SyntaxError{Col: mod.col, Msg: "dice would explode forever"}
+			}
+
+		case mod.isIdent("r") || mod.isIdent("ro"):
+			p.next()
+			cmp, err := p.parseCompare(true)
+			if err != nil {
+				return nil, err
+			}
+			dice.Reroll = cmp
+			dice.RerollOnce = mod.text == "ro"
+			if !dice.RerollOnce && cmp.matchesAll(dice.Sides) {
+				return nil, &SyntaxError{Col: mod.col, Msg: "dice would be rerolled forever"}
+			}
+
+		case mod.isIdent("cs") || mod.isIdent("cf"):
+			p.next()
+			cmp, err := p.parseCompare(true)
+			if err != nil {
+				return nil, err
+			}
+			if mod.text == "cs" {
+				dice.CritSuccess = cmp
+			} else {
+				dice.CritFail = cmp
+			}
+
+		case mod.kind == tokCompare:
+			cmp, err := p.parseCompare(false)
+			if err != nil {
+				return nil, err
+			}
+			dice.Success = cmp
+
+		default:
+			dice.Text = p.textSince(start)
+			return dice, nil
+		}
+	}
+}
+
+// parseCompare parses a compare point such as ">=8". When bare is set a plain
+// number is accepted as well and means "equal to".
+func (p *parser) parseCompare(bare bool) (*Compare, error) {
+	op := "="
+	if t := p.peek(); t.kind == tokCompare {
+		op = p.next().text
+	} else if !bare {
+		return nil, p.unexpected(t)
+	}
+	n, err := p.expect(tokNumber)
+	if err != nil {
+		return nil, err
+	}
+	return &Compare{Op: op, Value: n.num}, nil
+}
+
+func (p *parser) parseCall() (Node, error) {
+	name := p.next()
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, &SyntaxError{Col: name.col, Msg: fmt.Sprintf("unknown function '%s'", name.text)}
+	}
+	p.next() // "("
+
+	call := &CallNode{Name: name.text, Col: name.col}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+
+		t := p.next()
+		if t.kind == tokRParen {
+			break
+		}
+		if t.kind != tokComma {
+			return nil, p.unexpected(t)
+		}
+	}
+
+	if len(call.Args) < fn.minArgs || (fn.maxArgs > 0 && len(call.Args) > fn.maxArgs) {
+		return nil, &SyntaxError{Col: name.col, Msg: fmt.Sprintf("wrong number of arguments to %s", name.text)}
+	}
+	return call, nil
+}
@@ -0,0 +1,273 @@
+package commands
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"(d6+2))", "unexpected ')' at column 7"},
+		{"d6+", "unexpected end of expression at column 4"},
+		{"2d6 $ 3", "invalid character '$' at column 5"},
+		{"d", "unexpected end of expression at column 2"},
+		{"2d6 + foo(3)", "unknown function 'foo' at column 7"},
+		{"abs(1, 2)", "wrong number of arguments to abs at column 1"},
+		{"0d6", "dice count must be between 1 and 1000"},
+		{"d0", "dice sides must be between 1 and 100000"},
+		{"4d6k0", "keep count must be at least 1 at column 5"},
+		{"(d6", "unexpected end of expression at column 4"},
+		{"3 3", "unexpected '3' at column 3"},
+		{"1000d6+1000d6+1d6", "Too many dice: a roll can use at most 2000 dice in total"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseExpr(tt.expr)
+		if err == nil {
+			t.Errorf("ParseExpr(%q) should have errored", tt.expr)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParseExpr(%q) error = %q, want %q", tt.expr, err.Error(), tt.wantErr)
+		}
+	}
+}
+
+func TestEvaluateConstantExpressions(t *testing.T) {
+	tests := []struct {
+		expr     string
+		wantText string
+		want     int
+	}{
+		{"2+3*4", "2 + 3 * 4", 14},
+		{"(2+3)*4", "(2 + 3) * 4", 20},
+		{"10-4-3", "10 - 4 - 3", 3},
+		{"10-(4-3)", "10 - (4 - 3)", 9},
+		{"7/2", "7 / 2", 3},
+		{"-7/2", "-7 / 2", -4},
+		{"-3+5", "-3 + 5", 2},
+		{"--3", "--3", 3},
+		{"3(2+1)", "3(2 + 1)", 9},
+		{"max(3, 8, 5)", "max(3, 8, 5)", 8},
+		{"min(3, 8) + abs(-2)", "min(3, 8) + abs(-2)", 5},
+	}
+
+	for _, tt := range tests {
+		expr, err := ParseExpr(tt.expr)
+		if err != nil {
+			t.Errorf("ParseExpr(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		r, err := (&evaluator{}).eval(expr)
+		if err != nil {
+			t.Errorf("eval(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if r.value != tt.want || r.text != tt.wantText {
+			t.Errorf("eval(%q) = %q = %d, want %q = %d", tt.expr, r.text, r.value, tt.wantText, tt.want)
+		}
+	}
+}
+
+func TestEvaluateDivisionByZero(t *testing.T) {
+	expr, err := ParseExpr("d6/(2-2)")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	_, err = (&evaluator{rng: rand.New(rand.NewSource(1))}).eval(expr)
+	if err == nil || err.Error() != "division by zero at column 4" {
+		t.Errorf("eval error = %v, want division by zero at column 4", err)
+	}
+}
+
+func TestEvaluateOverflow(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"1000000000*1000000000*1000000000", "result too large at column 1"},
+		{"2 + (1000000000*1000000000*-1000000000)", "result too large at column 6"},
+		{"1000000000*1000000000*9 + 1000000000*1000000000", "result too large at column 1"},
+		{"-1000000000*1000000000*9 - 1000000000*1000000000", "result too large at column 1"},
+	}
+
+	for _, tt := range tests {
+		expr, err := ParseExpr(tt.expr)
+		if err != nil {
+			t.Errorf("ParseExpr(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		_, err = (&evaluator{}).eval(expr)
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("eval(%q) error = %v, want %q", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEvaluateDiceOperands(t *testing.T) {
+	expr, err := ParseExpr("2d6*2")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	r, err := (&evaluator{rng: rand.New(rand.NewSource(1))}).eval(expr)
+	if err != nil {
+		t.Fatalf("unexpected eval error: %v", err)
+	}
+	if !strings.HasPrefix(r.text, "(") || !strings.HasSuffix(r.text, ") * 2") {
+		t.Errorf("multi-die operand should be parenthesised: %q", r.text)
+	}
+	if r.value < 4 || r.value > 24 || r.value%2 != 0 {
+		t.Errorf("2d6*2 = %d, want an even number in [4, 24]", r.value)
+	}
+}
+
+func TestRollCommandReportsErrorColumn(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	result := executeRollCommandWithRand("(d6+2)) >> attack", rng)
+	if result.Success {
+		t.Fatalf("expected failure, got %q", result.Result)
+	}
+	if result.Result != "unexpected ')' at column 7" {
+		t.Errorf("Result = %q, want column error", result.Result)
+	}
+
+	result = executeRollCommandWithRand("d100 vs 50 +", rng)
+	if result.Success || !strings.Contains(result.Result, "at column 13") {
+		t.Errorf("versus parse error = %q, want column 13", result.Result)
+	}
+}
+
+func TestParseDiceModifiers(t *testing.T) {
+	tests := []struct {
+		expr  string
+		check func(d *DiceNode) bool
+	}{
+		{"d10!", func(d *DiceNode) bool { return *d.Explode == Compare{"=", 10} }},
+		{"d10!>8", func(d *DiceNode) bool { return *d.Explode == Compare{">", 8} }},
+		{"2d6r1", func(d *DiceNode) bool { return *d.Reroll == Compare{"=", 1} && !d.RerollOnce }},
+		{"2d6ro<2", func(d *DiceNode) bool { return *d.Reroll == Compare{"<", 2} && d.RerollOnce }},
+		{"6d10>=8", func(d *DiceNode) bool { return *d.Success == Compare{">=", 8} }},
+		{"d20cs>=19cf1", func(d *DiceNode) bool {
+			return *d.CritSuccess == Compare{">=", 19} && *d.CritFail == Compare{"=", 1}
+		}},
+		{"4d10!k3", func(d *DiceNode) bool { return d.Explode != nil && d.Keep == 3 }},
+	}
+
+	for _, tt := range tests {
+		expr, err := ParseExpr(tt.expr)
+		if err != nil {
+			t.Errorf("ParseExpr(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		d, ok := expr.(*DiceNode)
+		if !ok || !tt.check(d) {
+			t.Errorf("ParseExpr(%q) = %+v, modifiers not parsed", tt.expr, expr)
+		}
+	}
+
+	for _, expr := range []string{"d1!", "d6!>0", "d6r<7", "d6!8", "d6r", "d6cs"} {
+		if _, err := ParseExpr(expr); err == nil {
+			t.Errorf("ParseExpr(%q) should have errored", expr)
+		}
+	}
+}
+
+func TestRollDiceModifiers(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+
+	roll := func(expr string) evalResult {
+		t.Helper()
+		n, err := ParseExpr(expr)
+		if err != nil {
+			t.Fatalf("ParseExpr(%q) unexpected error: %v", expr, err)
+		}
+		r, err := (&evaluator{rng: rng}).eval(n)
+		if err != nil {
+			t.Fatalf("eval(%q) unexpected error: %v", expr, err)
+		}
+		return r
+	}
+
+	for i := 0; i < 200; i++ {
+		r := roll("3d4!")
+		dice := strings.Split(r.text, " + ")
+		exploded := strings.Count(r.text, "!")
+		if len(dice) != 3+exploded {
+			t.Fatalf("3d4! should add a die per explosion: %q", r.text)
+		}
+		if strings.HasSuffix(r.text, "4") {
+			t.Fatalf("a 4 must explode: %q", r.text)
+		}
+
+		r = roll("4d6r1")
+		for _, part := range strings.Split(r.text, " + ") {
+			if strings.HasSuffix(part, "→1") || part == "1" {
+				t.Fatalf("4d6r1 kept a 1: %q", r.text)
+			}
+		}
+
+		r = roll("4d6ro<3")
+		if strings.Count(r.text, "→") > 4 {
+			t.Fatalf("4d6ro<3 rerolled a die twice: %q", r.text)
+		}
+
+		r = roll("6d10>=8")
+		if r.value != strings.Count(r.text, "*") {
+			t.Fatalf("6d10>=8 = %d, want number of marked dice: %q", r.value, r.text)
+		}
+
+		r = roll("2d20cs20cf1")
+		if strings.Contains(r.text, "20") != strings.Contains(r.text, "20↑") {
+			t.Fatalf("natural 20 should be marked as crit: %q", r.text)
+		}
+	}
+}
+
+func TestEvaluateDiceBudget(t *testing.T) {
+	// Every d100000!>1 explodes almost surely, so 2000 dice chain far past
+	// the budget long before maxExplosions stops them.
+	roll, err := ParseRoll("1000d100000!>1+1000d100000!>1")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	_, err = evaluateRoll(roll, rand.New(rand.NewSource(1)))
+	if err != errTooManyDice {
+		t.Errorf("evaluateRoll error = %v, want %v", err, errTooManyDice)
+	}
+}
+
+func TestTruncateBreakdown(t *testing.T) {
+	short := "3 + 4 + 5"
+	if got := truncateBreakdown(short); got != short {
+		t.Errorf("truncateBreakdown(%q) = %q, want it unchanged", short, got)
+	}
+
+	long := strings.Repeat("1→10! + ", maxBreakdownLen)
+	got := truncateBreakdown(long)
+	if len(got) > maxBreakdownLen+len(" …") || !strings.HasSuffix(got, " …") {
+		t.Errorf("truncateBreakdown of %d bytes = %d bytes ending %q", len(long), len(got), got[len(got)-8:])
+	}
+	if !utf8.ValidString(got) {
+		t.Errorf("truncateBreakdown cut a character in half: %q", got[len(got)-8:])
+	}
+}
+
+func TestCalculateSuccessLevelWithCustomCrits(t *testing.T) {
+	crits := critRange{success: &Compare{"<=", 10}, fail: &Compare{">=", 91}}
+
+	level, isCrit, isSuccess := calculateSuccessLevelWithCrits(8, 50, 0, crits)
+	if level != 5 || !isCrit || !isSuccess {
+		t.Errorf("8 vs 50 = (%d, %v, %v), want (5, true, true)", level, isCrit, isSuccess)
+	}
+
+	level, isCrit, isSuccess = calculateSuccessLevelWithCrits(92, 95, 0, crits)
+	if level != 0 || !isCrit || isSuccess {
+		t.Errorf("92 vs 95 = (%d, %v, %v), want (0, true, false)", level, isCrit, isSuccess)
+	}
+}
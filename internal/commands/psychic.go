@@ -0,0 +1,205 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"charactersheet.iociveteres.net/internal/gamedata"
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+// PsychicProfile is everything about a focus power test that is settled
+// before the dice are rolled. It is stored with the result so the roll can
+// be replayed, and names the power so chat can link back to it.
+type PsychicProfile struct {
+	Label   string `json:"label"` // power name and the options picked in the roll dialog
+	Power   string `json:"power"`
+	SheetID int    `json:"sheetID"`
+	Path    string `json:"path"` // the power on the sheet
+	Target  int    `json:"target"`
+	Bonus   int    `json:"bonus,omitempty"`
+	PR      int    `json:"pr"`               // power rating used within the psyker's limit
+	Pushed  int    `json:"pushed,omitempty"` // power rating pushed beyond it
+}
+
+// TableRoll is a roll on a d100 table and the row it landed on.
+type TableRoll struct {
+	Roll  int `json:"roll"`
+	Total int `json:"total"` // the roll with its modifiers, what the row was looked up by
+	gamedata.TableEntry
+}
+
+// PsychicResult is the outcome of a focus power test beyond its success:
+// whether it drew the warp's attention, and what came of it.
+type PsychicResult struct {
+	PsychicProfile
+	Doubles    bool       `json:"doubles,omitempty"`
+	Phenomenon *TableRoll `json:"phenomenon,omitempty"`
+	Peril      *TableRoll `json:"peril,omitempty"`
+}
+
+// The sheet section that holds psychic powers.
+const psykanaSection = "psykana"
+
+// PsychicProfileFor builds the focus power test of the power at path, e.g.
+// psykana.tabs.items.<tab>.powers.items.<id>, from the sheet content and the
+// power's roll dialog settings. The power rating set in the dialog must be
+// within what the psyker has available and may push.
+func PsychicProfileFor(sheetID int, content json.RawMessage, path []string) (PsychicProfile, error) {
+	if len(path) != 7 || path[0] != psykanaSection || path[1] != "tabs" || path[2] != "items" ||
+		path[4] != "powers" || path[5] != "items" {
+		return PsychicProfile{}, fmt.Errorf("path %q is not a psychic power", strings.Join(path, "."))
+	}
+
+	var sheet models.CharacterSheetContent
+	if err := json.Unmarshal(content, &sheet); err != nil {
+		return PsychicProfile{}, fmt.Errorf("unmarshal sheet: %w", err)
+	}
+	var psykana struct {
+		Psykana struct {
+			Tabs struct {
+				Items map[string]struct {
+					Powers struct {
+						Items map[string]json.RawMessage `json:"items"`
+					} `json:"powers"`
+				} `json:"items"`
+			} `json:"tabs"`
+		} `json:"psykana"`
+	}
+	if err := json.Unmarshal(content, &psykana); err != nil {
+		return PsychicProfile{}, fmt.Errorf("unmarshal psykana: %w", err)
+	}
+	raw, ok := psykana.Psykana.Tabs.Items[path[3]].Powers.Items[path[6]]
+	if !ok {
+		return PsychicProfile{}, errors.New("psychic power not found")
+	}
+
+	// Decoded over a copy of the default dialog, like weapons
+	roll := models.DefaultPsychicPowerRoll
+	power := models.PsychicPower{Roll: &roll}
+	if err := json.Unmarshal(raw, &power); err != nil {
+		return PsychicProfile{}, fmt.Errorf("unmarshal psychic power: %w", err)
+	}
+	r := power.Roll
+
+	name := strings.TrimSpace(power.Name)
+	if name == "" {
+		name = "Unknown Power"
+	}
+	switch {
+	case r.EffectivePR < 0 || r.KickPR < 0:
+		return PsychicProfile{}, errors.New("power rating cannot be negative")
+	case r.EffectivePR > sheet.Psykana.AvailablePR():
+		return PsychicProfile{}, fmt.Errorf("%s uses power rating %d but only %d is available", name, r.EffectivePR, sheet.Psykana.AvailablePR())
+	case r.KickPR > sheet.Psykana.MaxPush:
+		return PsychicProfile{}, fmt.Errorf("%s is pushed by %d but the psyker can push at most %d", name, r.KickPR, sheet.Psykana.MaxPush)
+	}
+
+	// The label reads like the one the sheet used to build
+	parts := []string{name}
+	if r.EffectivePR > 0 {
+		parts = append(parts, fmt.Sprintf("%d ePR", r.EffectivePR))
+	}
+	if r.KickPR > 0 {
+		parts = append(parts, fmt.Sprintf("+%d kick", r.KickPR))
+	}
+	for _, e := range []models.RollExtra{r.Extra1, r.Extra2} {
+		if e.Enabled && e.Name != "" {
+			parts = append(parts, e.Name)
+		}
+	}
+
+	return PsychicProfile{
+		Label:   strings.Join(parts, ", "),
+		Power:   name,
+		SheetID: sheetID,
+		Path:    strings.Join(path, "."),
+		Target:  sheet.RollValue(r.BaseSelect) + r.TestModifier(),
+		Bonus:   sheet.RollBonusSuccesses(r.BaseSelect),
+		PR:      r.EffectivePR,
+		Pushed:  r.KickPR,
+	}, nil
+}
+
+// RollPsychicTest rolls the focus power test with dice drawn from seed. A
+// pushed power always draws psychic phenomena, any other does on doubles;
+// phenomena that turn into Perils of the Warp roll on that table as well.
+func RollPsychicTest(profile PsychicProfile, tables *gamedata.PsychicTables, seed Seed) CommandResult {
+	if tables == nil {
+		return CommandResult{Success: false, Result: "The psychic phenomena tables are not loaded"}
+	}
+
+	rng := seed.Rand()
+	result := executeRoll(context.Background(), nil, versusExpression(profile.Target, profile.Bonus), rng)
+	if !result.Success {
+		return result
+	}
+
+	psychic := &PsychicResult{
+		PsychicProfile: profile,
+		Doubles:        isDoubles(result.Roll.Lines[0].Total),
+	}
+	if profile.Pushed > 0 || psychic.Doubles {
+		roll := rng.Intn(100) + 1
+		total := roll + tables.PushModifier*profile.Pushed
+		psychic.Phenomenon = &TableRoll{Roll: roll, Total: total, TableEntry: tables.Phenomenon(total)}
+
+		if psychic.Phenomenon.Perils {
+			roll := rng.Intn(100) + 1
+			psychic.Peril = &TableRoll{Roll: roll, Total: roll, TableEntry: tables.Peril(roll)}
+		}
+	}
+	result.Roll.Psychic = psychic
+	result.Result = result.Roll.Text()
+	result.Audit = rollAudit(seed, result.Roll)
+	return result
+}
+
+// isDoubles reports whether both digits of a d100 roll match; 100 reads as
+// 00.
+func isDoubles(roll int) bool {
+	return roll == 100 || roll%11 == 0 && roll < 100
+}
+
+// dice lists the table rolls in the order they were drawn.
+func (p *PsychicResult) dice() []int {
+	var dice []int
+	if p.Phenomenon != nil {
+		dice = append(dice, p.Phenomenon.Roll)
+	}
+	if p.Peril != nil {
+		dice = append(dice, p.Peril.Roll)
+	}
+	return dice
+}
+
+// Text renders what the warp made of the test, e.g.
+// "Pushed +2: psychic phenomena\nPhenomenon (47+10 = 57): Grave Chill. ..."
+func (p *PsychicResult) Text() string {
+	var lines []string
+	switch {
+	case p.Pushed > 0:
+		lines = append(lines, fmt.Sprintf("Pushed +%d: psychic phenomena", p.Pushed))
+	case p.Doubles:
+		lines = append(lines, "Doubles: psychic phenomena")
+	}
+	if p.Phenomenon != nil {
+		roll := fmt.Sprintf("%d", p.Phenomenon.Roll)
+		if p.Phenomenon.Total != p.Phenomenon.Roll {
+			roll = fmt.Sprintf("%d+%d = %d", p.Phenomenon.Roll, p.Phenomenon.Total-p.Phenomenon.Roll, p.Phenomenon.Total)
+		}
+		lines = append(lines, fmt.Sprintf("Phenomenon (%s): %s. %s", roll, p.Phenomenon.Name, p.Phenomenon.Effect))
+	}
+	if p.Peril != nil {
+		lines = append(lines, fmt.Sprintf("Perils of the Warp (%d): %s. %s", p.Peril.Roll, p.Peril.Name, p.Peril.Effect))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MessageBody is the chat message a focus power test is posted as.
+func (p PsychicProfile) MessageBody() string {
+	return "/r " + versusExpression(p.Target, p.Bonus) + "\n>> " + p.Label
+}
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/gamedata"
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+const psychicTestSheet = `{
+	"characteristics": {"W": {"value": "45", "unnatural": "2"}},
+	"psykana": {
+		"basePR": 4, "sustainedPowers": 1, "maxPush": 2,
+		"tabs": {"items": {"t": {"powers": {"items": {
+			"smite": {"name": "Smite", "roll": {"effectivePR": 3, "kickPR": 1, "modifier": -10}},
+			"greedy": {"name": "Greed", "roll": {"effectivePR": 4}},
+			"reckless": {"name": "Reckless", "roll": {"kickPR": 3}}
+		}}}}}
+	}
+}`
+
+func testPsychicTables() *gamedata.PsychicTables {
+	return &gamedata.PsychicTables{
+		PushModifier: 5,
+		Phenomena: []gamedata.TableEntry{
+			{Min: 1, Max: 74, Name: "Grave Chill", Effect: "It gets cold."},
+			{Min: 75, Max: 100, Name: "Perils of the Warp", Perils: true},
+		},
+		Perils: []gamedata.TableEntry{{Min: 1, Max: 100, Name: "The Gibbering", Effect: "Babbling."}},
+	}
+}
+
+func TestPsychicProfileFor(t *testing.T) {
+	path := strings.Split("psykana.tabs.items.t.powers.items.smite", ".")
+	got, err := PsychicProfileFor(7, json.RawMessage(psychicTestSheet), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PsychicProfile{
+		Label:   "Smite, 3 ePR, +1 kick",
+		Power:   "Smite",
+		SheetID: 7,
+		Path:    "psykana.tabs.items.t.powers.items.smite",
+		Target:  45 - 10 + 5*(3+1),
+		Bonus:   1,
+		PR:      3,
+		Pushed:  1,
+	}
+	if got != want {
+		t.Errorf("profile = %+v, want %+v", got, want)
+	}
+
+	for _, id := range []string{"greedy", "reckless", "missing"} {
+		path := strings.Split("psykana.tabs.items.t.powers.items."+id, ".")
+		if _, err := PsychicProfileFor(7, json.RawMessage(psychicTestSheet), path); err == nil {
+			t.Errorf("%s: expected an error", id)
+		}
+	}
+}
+
+func TestRollPsychicTest(t *testing.T) {
+	tables := testPsychicTables()
+	profile := PsychicProfile{Label: "Smite", Power: "Smite", Target: 60}
+
+	// Rolls that are not pushed only draw phenomena on doubles
+	rng := NewRoomRNG()
+	var sawDoubles bool
+	for range 200 {
+		res := RollPsychicTest(profile, tables, rng.NextSeed())
+		if !res.Success {
+			t.Fatalf("psychic test failed: %s", res.Result)
+		}
+		p := res.Roll.Psychic
+		if p.Doubles != isDoubles(res.Roll.Lines[0].Total) || (p.Phenomenon != nil) != p.Doubles {
+			t.Fatalf("roll %d: doubles %v, phenomenon %+v", res.Roll.Lines[0].Total, p.Doubles, p.Phenomenon)
+		}
+		sawDoubles = sawDoubles || p.Doubles
+	}
+	if !sawDoubles {
+		t.Error("200 rolls without doubles")
+	}
+
+	profile.Pushed = 2
+	res := RollPsychicTest(profile, tables, rng.NextSeed())
+	p := res.Roll.Psychic
+	if p.Phenomenon == nil || p.Phenomenon.Total != p.Phenomenon.Roll+10 {
+		t.Fatalf("pushed roll phenomenon = %+v", p.Phenomenon)
+	}
+	if (p.Peril != nil) != (p.Phenomenon.Total >= 75) {
+		t.Errorf("phenomenon %d, peril %+v", p.Phenomenon.Total, p.Peril)
+	}
+	if !strings.Contains(res.Result, "Pushed +2: psychic phenomena") {
+		t.Errorf("result = %q", res.Result)
+	}
+	if got, want := len(res.Audit.Dice), 1+len(p.dice()); got != want {
+		t.Errorf("audit has %d dice, want %d", got, want)
+	}
+
+	if res := RollPsychicTest(profile, nil, rng.NextSeed()); res.Success {
+		t.Error("rolled without tables")
+	}
+}
+
+func TestVerifyPsychicTest(t *testing.T) {
+	ctx := context.Background()
+	profile := PsychicProfile{Label: "Smite, +2 kick", Power: "Smite", Target: 60, Pushed: 2}
+	catalog := &gamedata.Catalog{Psychic: testPsychicTables()}
+
+	res := RollPsychicTest(profile, catalog.Psychic, NewRoomRNG().NextSeed())
+	data, err := json.Marshal(res.Roll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := models.Message{MessageBody: profile.MessageBody(), CommandResult: &res.Result, CommandData: data}
+	v, err := VerifyRoll(ctx, msg, *res.Audit, catalog)
+	if err != nil || !v.Verified {
+		t.Fatalf("psychic test did not verify: %+v, %v", v, err)
+	}
+}
+
+func TestIsDoubles(t *testing.T) {
+	for roll, want := range map[int]bool{11: true, 99: true, 100: true, 10: false, 1: false, 55: true, 56: false} {
+		if got := isDoubles(roll); got != want {
+			t.Errorf("isDoubles(%d) = %v, want %v", roll, got, want)
+		}
+	}
+}
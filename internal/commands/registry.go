@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+// Command is a chat slash-command such as /r.
+type Command interface {
+	// Name is the canonical name, typed after the slash.
+	Name() string
+	// Aliases are alternative names that run the same command.
+	Aliases() []string
+	Help() Help
+	Execute(ctx context.Context, env *Env, args string) CommandResult
+}
+
+// Help documents a command for the commands popover and /help.
+type Help struct {
+	Description         string
+	DetailedDescription string
+}
+
+// Env gives a command access to who invoked it and where.
+type Env struct {
+	UserID int
+	RoomID int
+	Models *models.Models
+	// Seeds supplies roll seeds, usually the room's RoomRNG. When nil every
+	// roll is seeded straight from crypto/rand.
+	Seeds SeedSource
+	// Refs looks up @references in roll expressions. When nil they are read
+	// from the room's character sheets through Models.
+	Refs RefResolver
+}
+
+// SeedSource hands out the seed of each roll.
+type SeedSource interface {
+	NextSeed() Seed
+}
+
+func (e *Env) nextSeed() Seed {
+	if e == nil || e.Seeds == nil {
+		return randomSeed()
+	}
+	return e.Seeds.NextSeed()
+}
+
+// Registry maps command names and aliases to commands.
+type Registry struct {
+	commands []Command
+	byName   map[string]Command
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]Command)}
+}
+
+// Register adds cmd under its name and aliases. It panics if any of them is
+// already taken, since that is a programming error.
+func (r *Registry) Register(cmd Command) {
+	names := append([]string{cmd.Name()}, cmd.Aliases()...)
+	for _, name := range names {
+		if _, exists := r.byName[name]; exists {
+			panic(fmt.Sprintf("commands: /%s registered twice", name))
+		}
+	}
+	for _, name := range names {
+		r.byName[name] = cmd
+	}
+	r.commands = append(r.commands, cmd)
+}
+
+// Lookup finds a command by name or alias.
+func (r *Registry) Lookup(name string) (Command, bool) {
+	cmd, ok := r.byName[name]
+	return cmd, ok
+}
+
+// Commands returns the registered commands sorted by name.
+func (r *Registry) Commands() []Command {
+	out := make([]Command, len(r.commands))
+	copy(out, r.commands)
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name() < out[j].Name()
+	})
+	return out
+}
+
+// Execute runs the command in messageBody. It returns nil when the message
+// is not a command.
+func (r *Registry) Execute(ctx context.Context, env *Env, messageBody string) *CommandResult {
+	if !strings.HasPrefix(messageBody, "/") {
+		return nil // Not a command
+	}
+
+	parts := strings.Fields(messageBody)
+	commandName := strings.TrimPrefix(parts[0], "/")
+	args := strings.TrimSpace(messageBody[len(parts[0]):])
+
+	cmd, ok := r.Lookup(commandName)
+	if !ok {
+		return &CommandResult{
+			Success: false,
+			Result:  "Unknown command: /" + commandName,
+		}
+	}
+
+	result := cmd.Execute(ctx, env, args)
+	return &result
+}
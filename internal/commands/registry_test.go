@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+type echoCommand struct{}
+
+func (echoCommand) Name() string      { return "echo" }
+func (echoCommand) Aliases() []string { return []string{"e"} }
+func (echoCommand) Help() Help        { return Help{Description: "echo the arguments"} }
+
+func (echoCommand) Execute(ctx context.Context, env *Env, args string) CommandResult {
+	return CommandResult{Success: true, Result: args}
+}
+
+func TestRegistryExecute(t *testing.T) {
+	r := NewRegistry()
+	r.Register(echoCommand{})
+	ctx := context.Background()
+	env := &Env{UserID: 1, RoomID: 2}
+
+	if res := r.Execute(ctx, env, "hello"); res != nil {
+		t.Errorf("plain message should not be a command, got %+v", res)
+	}
+
+	for _, body := range []string{"/echo two  spaces", "/e two  spaces"} {
+		res := r.Execute(ctx, env, body)
+		if res == nil || !res.Success || res.Result != "two  spaces" {
+			t.Errorf("Execute(%q) = %+v, want args passed through", body, res)
+		}
+	}
+
+	res := r.Execute(ctx, env, "/nope")
+	if res == nil || res.Success || res.Result != "Unknown command: /nope" {
+		t.Errorf("unknown command result = %+v", res)
+	}
+}
+
+func TestRegistryRejectsDuplicates(t *testing.T) {
+	r := NewRegistry()
+	r.Register(echoCommand{})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a taken name should panic")
+		}
+	}()
+	r.Register(echoCommand{})
+}
+
+func TestAvailableCommandsReadsRegistry(t *testing.T) {
+	for _, c := range AvailableCommands() {
+		if c.Command == "/r" {
+			if !strings.Contains(c.DetailedDescription, "4d6k3") {
+				t.Errorf("/r is missing its detailed description")
+			}
+			return
+		}
+	}
+	t.Error("/r is not listed in AvailableCommands")
+}
+
+func TestSecretRollCommands(t *testing.T) {
+	ctx := context.Background()
+	env := &Env{UserID: 1, RoomID: 2}
+
+	tests := map[string]models.MessageVisibility{
+		"/gr d100":       models.MessageGMOnly,
+		"/gmroll d100":   models.MessageGMOnly,
+		"/br d100 vs 40": models.MessageBlind,
+		"/sr 2d6":        models.MessageSelf,
+		"/r d100":        "",
+	}
+	for body, want := range tests {
+		res := ParseAndExecuteCommand(ctx, env, body)
+		if res == nil || !res.Success || res.Visibility != want || res.Roll == nil {
+			t.Errorf("%s = %+v, want a roll with visibility %q", body, res, want)
+		}
+	}
+
+	res := ParseAndExecuteCommand(ctx, env, "/gr d100 +")
+	if res.Success || !res.Private {
+		t.Errorf("a failed secret roll should be answered privately, got %+v", res)
+	}
+}
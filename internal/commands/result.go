@@ -0,0 +1,220 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Die is a single rolled die and what happened to it.
+type Die struct {
+	Value       int   `json:"value"`
+	Rerolled    []int `json:"rerolled,omitempty"` // earlier values replaced by a reroll, oldest first
+	Kept        bool  `json:"kept"`
+	Exploded    bool  `json:"exploded"` // this die triggered an extra die
+	Success     bool  `json:"success,omitempty"`
+	CritSuccess bool  `json:"critSuccess,omitempty"`
+	CritFail    bool  `json:"critFail,omitempty"`
+}
+
+// String renders the die for the breakdown: "(n)" dropped, "1→7" rerolled,
+// "10!" exploded, "8*" counted as a success, "20↑"/"1↓" custom crits.
+func (d Die) String() string {
+	var sb strings.Builder
+	for _, v := range d.Rerolled {
+		sb.WriteString(strconv.Itoa(v))
+		sb.WriteString("→")
+	}
+	sb.WriteString(strconv.Itoa(d.Value))
+	if d.Exploded {
+		sb.WriteString("!")
+	}
+	if d.Success {
+		sb.WriteString("*")
+	}
+	if d.CritSuccess {
+		sb.WriteString("↑")
+	}
+	if d.CritFail {
+		sb.WriteString("↓")
+	}
+	if !d.Kept {
+		return "(" + sb.String() + ")"
+	}
+	return sb.String()
+}
+
+// DiceGroup is one dice term of an expression, e.g. the 4d6k3 in 4d6k3+2.
+type DiceGroup struct {
+	Expression string `json:"expression"`
+	Sides      int    `json:"sides"`
+	Dice       []Die  `json:"dice"`
+	Subtotal   int    `json:"subtotal"`
+}
+
+// RollLine is one evaluation of a roll expression. Repeated rolls have one
+// line per repetition.
+type RollLine struct {
+	Groups    []DiceGroup `json:"groups"`
+	Breakdown string      `json:"breakdown"`
+	Total     int         `json:"total"`
+
+	// Set for versus rolls only. Degrees counts successes when Success is
+	// true and failures otherwise.
+	Success     *bool `json:"success,omitempty"`
+	Degrees     int   `json:"degrees,omitempty"`
+	CritSuccess bool  `json:"critSuccess,omitempty"`
+	CritFail    bool  `json:"critFail,omitempty"`
+}
+
+// RollResult is the structured outcome of a /roll command. The chat text
+// stored in CommandResult.Result is derived from it by Text.
+type RollResult struct {
+	Expression string     `json:"expression"`
+	Repeat     int        `json:"repeat,omitempty"`
+	Target     *int       `json:"target,omitempty"`
+	Bonus      int        `json:"bonus,omitempty"`
+	Lines      []RollLine `json:"rolls"`
+	Total      int        `json:"total"`                // sum of all line totals
+	NetDegrees int        `json:"netDegrees,omitempty"` // versus rolls: successes minus failures
+	// Refs holds the value each @reference had when the roll was made
+	Refs map[string]int `json:"refs,omitempty"`
+	// Attack is set for attack rolls made from a weapon on a sheet
+	Attack *AttackResult `json:"attack,omitempty"`
+	// Damage is set for damage rolled from a weapon against a target sheet
+	Damage *DamageResult `json:"damage,omitempty"`
+	// Psychic is set for focus power tests made from a power on a sheet
+	Psychic *PsychicResult `json:"psychic,omitempty"`
+	// TechPower is set for tech power tests made from a power on a sheet
+	TechPower *TechPowerResult `json:"techPower,omitempty"`
+}
+
+// RawDice lists every value drawn for the roll in the order it was drawn,
+// including rerolled and dropped dice.
+func (r *RollResult) RawDice() []int {
+	var dice []int
+	for _, line := range r.Lines {
+		for _, group := range line.Groups {
+			for _, d := range group.Dice {
+				dice = append(dice, d.Rerolled...)
+				dice = append(dice, d.Value)
+			}
+		}
+	}
+	if r.Psychic != nil {
+		dice = append(dice, r.Psychic.dice()...)
+	}
+	return dice
+}
+
+// IsVersus reports whether the roll was made against a target.
+func (r *RollResult) IsVersus() bool {
+	return r.Target != nil
+}
+
+// Text renders the result the way it is shown in chat.
+func (r *RollResult) Text() string {
+	if r.Attack != nil {
+		return r.versusText() + "\n" + r.Attack.Text()
+	}
+	if r.Damage != nil {
+		return r.Damage.Text(r.Lines)
+	}
+	if r.Psychic != nil {
+		if text := r.Psychic.Text(); text != "" {
+			return r.versusText() + "\n" + text
+		}
+		return r.versusText()
+	}
+	if r.TechPower != nil {
+		if text := r.TechPower.Text(); text != "" {
+			return r.versusText() + "\n" + text
+		}
+		return r.versusText()
+	}
+	if r.IsVersus() {
+		return r.versusText()
+	}
+
+	if r.Repeat == 0 {
+		line := r.Lines[0]
+		return fmt.Sprintf("%s:\n%s", r.Expression, breakdown(line.Breakdown, line.Total))
+	}
+
+	totals := make([]int, len(r.Lines))
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%dx(%s):\n", r.Repeat, r.Expression))
+	for i, line := range r.Lines {
+		sb.WriteString(fmt.Sprintf("%s = %d\n", line.Breakdown, line.Total))
+		totals[i] = line.Total
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(totals)))
+	for i, total := range totals {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(strconv.Itoa(total))
+	}
+	return sb.String()
+}
+
+func (r *RollResult) versusText() string {
+	var sb strings.Builder
+
+	header := fmt.Sprintf("%s vs %d", r.Expression, *r.Target)
+	if r.Bonus > 0 {
+		header += fmt.Sprintf(" [+%d]", r.Bonus)
+	}
+
+	if r.Repeat == 0 {
+		line := r.Lines[0]
+		sb.WriteString(header + ":\n")
+		// Show the roll breakdown - only when it says more than the result
+		if b := breakdown(line.Breakdown, line.Total); b != line.Breakdown {
+			sb.WriteString(b + "\n")
+		}
+		sb.WriteString(fmt.Sprintf("%d, %s", line.Total, line.outcome()))
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("%dx(%s):\n", r.Repeat, header))
+	contributions := make([]string, len(r.Lines))
+	for i, line := range r.Lines {
+		sb.WriteString(fmt.Sprintf("%s, %s\n", breakdown(line.Breakdown, line.Total), line.outcome()))
+		if *line.Success {
+			contributions[i] = strconv.Itoa(line.Degrees)
+		} else {
+			contributions[i] = strconv.Itoa(-line.Degrees)
+		}
+	}
+
+	// Show the calculation breakdown
+	calculation := strings.Join(contributions, " + ")
+	calculation = strings.ReplaceAll(calculation, "+ -", "- ")
+	sb.WriteString(fmt.Sprintf("%s = %d\n", calculation, r.NetDegrees))
+	sb.WriteString(fmt.Sprintf("Total: %d success", r.NetDegrees))
+	return sb.String()
+}
+
+// outcome renders "2 success" or "1 fail, crit!" for a versus line.
+func (l RollLine) outcome() string {
+	s := fmt.Sprintf("%d fail", l.Degrees)
+	if *l.Success {
+		s = fmt.Sprintf("%d success", l.Degrees)
+	}
+	if l.CritSuccess || l.CritFail {
+		s += ", crit!"
+	}
+	return s
+}
+
+// breakdown renders a line as shown to users: the bare value when the
+// breakdown adds nothing, "breakdown = value" otherwise.
+func breakdown(text string, total int) string {
+	if text == strconv.Itoa(total) {
+		return text
+	}
+	return fmt.Sprintf("%s = %d", text, total)
+}
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func TestRollResultStructure(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+
+	result := executeRollCommandWithRand("4d6k3+2", rng)
+	if !result.Success || result.Roll == nil {
+		t.Fatalf("expected a structured result, got %+v", result)
+	}
+	if result.Result != result.Roll.Text() {
+		t.Errorf("Result %q is not the text view of Roll %q", result.Result, result.Roll.Text())
+	}
+
+	roll := result.Roll
+	if roll.Expression != "4d6k3+2" || len(roll.Lines) != 1 {
+		t.Fatalf("unexpected roll %+v", roll)
+	}
+	line := roll.Lines[0]
+	if len(line.Groups) != 1 || line.Groups[0].Expression != "4d6k3" || len(line.Groups[0].Dice) != 4 {
+		t.Fatalf("unexpected dice groups %+v", line.Groups)
+	}
+
+	kept, sum := 0, 0
+	for _, d := range line.Groups[0].Dice {
+		if d.Kept {
+			kept++
+			sum += d.Value
+		}
+	}
+	if kept != 3 || sum != line.Groups[0].Subtotal || line.Total != sum+2 || roll.Total != line.Total {
+		t.Errorf("subtotals do not add up: %+v", line)
+	}
+}
+
+func TestRollResultVersus(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+
+	result := executeRollCommandWithRand("3x(d100 vs 50 [+1])", rng)
+	if !result.Success || result.Roll == nil {
+		t.Fatalf("expected a structured result, got %+v", result)
+	}
+	roll := result.Roll
+	if roll.Target == nil || *roll.Target != 50 || roll.Bonus != 1 || roll.Repeat != 3 {
+		t.Fatalf("unexpected versus fields %+v", roll)
+	}
+
+	net := 0
+	for _, line := range roll.Lines {
+		if line.Success == nil {
+			t.Fatalf("versus line without success flag: %+v", line)
+		}
+		if *line.Success {
+			net += line.Degrees
+		} else {
+			net -= line.Degrees
+		}
+		if line.CritSuccess != (line.Total <= 5) || line.CritFail != (line.Total >= 96) {
+			t.Errorf("wrong crit flags for %d: %+v", line.Total, line)
+		}
+	}
+	if net != roll.NetDegrees {
+		t.Errorf("NetDegrees = %d, want %d", roll.NetDegrees, net)
+	}
+
+	data, err := json.Marshal(roll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"expression", "target", "rolls", "total", "repeat"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("JSON is missing %q: %s", key, data)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package commands
+
+import (
+	crand "crypto/rand"
+	"math/rand"
+	randv2 "math/rand/v2"
+	"sync"
+)
+
+// Seed is everything a roll's randomness comes from: replaying a roll with
+// the same seed reproduces the same dice.
+type Seed [32]byte
+
+// Rand returns a generator that yields the same sequence for the same seed.
+func (s Seed) Rand() *rand.Rand {
+	return rand.New(&chachaSource{chacha: randv2.NewChaCha8(s)})
+}
+
+// chachaSource adapts ChaCha8 to the math/rand Source the evaluator uses.
+type chachaSource struct {
+	chacha *randv2.ChaCha8
+}
+
+func (s *chachaSource) Int63() int64   { return int64(s.chacha.Uint64() >> 1) }
+func (s *chachaSource) Uint64() uint64 { return s.chacha.Uint64() }
+
+// Seed is required by rand.Source but a seeded roll must not be reseeded.
+func (s *chachaSource) Seed(int64) { panic("commands: chachaSource cannot be reseeded") }
+
+// RoomRNG hands out roll seeds for one room. It is a ChaCha8 stream seeded
+// from crypto/rand, so seeds are unpredictable but every roll made from one
+// can be replayed.
+type RoomRNG struct {
+	mu     sync.Mutex
+	chacha *randv2.ChaCha8
+}
+
+func NewRoomRNG() *RoomRNG {
+	return &RoomRNG{chacha: randv2.NewChaCha8(randomSeed())}
+}
+
+// NextSeed returns the seed for the next roll.
+func (g *RoomRNG) NextSeed() Seed {
+	var s Seed
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// ChaCha8.Read never fails
+	_, _ = g.chacha.Read(s[:])
+	return s
+}
+
+func randomSeed() Seed {
+	var s Seed
+	// crypto/rand.Read never returns an error on supported platforms
+	_, _ = crand.Read(s[:])
+	return s
+}
@@ -1,20 +1,129 @@
 package commands
 
 import (
+	"context"
 	"fmt"
-	"maps"
 	"math/rand"
-	"sort"
-	"strconv"
 	"strings"
-	"time"
+
+	"charactersheet.iociveteres.net/internal/models"
 )
 
-func executeRollCommand(args string) CommandResult {
-	return executeRollCommandWithRand(args, rand.New(rand.NewSource(time.Now().UnixNano())))
+// rollCommand is /r: roll a dice expression, optionally against a target.
+type rollCommand struct{}
+
+func (rollCommand) Name() string      { return "r" }
+func (rollCommand) Aliases() []string { return []string{"roll"} }
+
+func (rollCommand) Help() Help {
+	return Help{
+		Description: "roll a die",
+		DetailedDescription: `d6 — roll 1d6
+1d3 — roll 1d3
+d100 + 32 — roll 1d100, add 32
+2d100 — roll 2d100, sum results
+4d6k3 — roll 4d6, keep the 3 highest, sum them
+2d6-1+d10 — roll 2d6 and 1d10, subtract 1, sum all
+3(d6+2) — roll 1d6, add 2, multiply total by 3
+13x(2d10+25) — repeat 13 times: roll 2d10, add 25; print each result on a new line in ascending order
+(2d6+1)*2 — roll 2d6, add 1, double the total
+d10/2 — roll 1d10, halve it rounding down
+10-d6 — roll 1d6, subtract it from 10
+max(d10, d10) — roll two d10, take the higher; min(...) and abs(...) work the same way
+
+Dice modifiers (written right after the die, can be combined):
+d10! — explode: every 10 adds another d10, shown as 10!
+d10!>8 — explode on 9 or 10; compare with =, <, <=, >, >=
+2d10r1 — reroll every 1 until it isn't, shown as 1→7
+2d10ro<2 — reroll values below 2 once, keep the second roll
+6d10>=8 — count successes instead of summing: each die of 8+ is one success, shown as 8*
+d20cs>=19 — custom crit success range, crits are shown as 19↑
+d100cf>90 — custom crit failure range, shown as 95↓; vs rolls use cs/cf instead of the default ranges
+
+Versus rolls (roll vs difficulty):
+d100 vs 70 — roll 1d100, compare to 70, count success/fail levels
+2d50+3 vs 77 — roll 2d50+3, compare to 77
+d100 vs 77 [+1] — roll d100, compare to 77, if succesfull add +1 extra success
+5x(d100 vs 50) — repeat 5 times, aggregate success/fail levels
+
+Character sheet values (read from your sheet in this room):
+d100 vs @WS — roll against your Weapon Skill; any characteristic works: WS, BS, S, T, A, I, P, W, F, Inf, Cor
+d100 vs @Awareness+10 — roll against a skill, custom skills included: @Dodge, @SleightOfHand, @Tech_Use
+d10+@SB — characteristic bonus: @SB, @TB, @WSB...
+d100 vs @{Brother Marcus}.WS — use another sheet of the room by its character name
+
+Success/fail levels: Every 10 points above/below target adds 1 level
+Critical results: Values 1-5 are critical success, 96-100 are critical failure (scaled for other dice)`,
+	}
+}
+
+func (rollCommand) Execute(ctx context.Context, env *Env, args string) CommandResult {
+	return executeSeededRoll(ctx, env, args, env.nextSeed())
+}
+
+// secretRollCommand is /r whose result only some of the room sees; everyone
+// else gets a "rolled secretly" placeholder.
+type secretRollCommand struct {
+	name       string
+	aliases    []string
+	visibility models.MessageVisibility
+}
+
+func (c secretRollCommand) Name() string      { return c.name }
+func (c secretRollCommand) Aliases() []string { return c.aliases }
+
+func (c secretRollCommand) Help() Help {
+	var who string
+	switch c.visibility {
+	case models.MessageGMOnly:
+		who = "only you and the gamemasters see the result"
+	case models.MessageBlind:
+		who = "only the gamemasters see the result, not even you"
+	case models.MessageSelf:
+		who = "only you see the result"
+	}
+	return Help{
+		Description: "roll a die secretly: " + who,
+		DetailedDescription: fmt.Sprintf(`/%s d100 vs 45 — takes the same expressions as /r
+Everyone else sees that you rolled, but not what`, c.name),
+	}
+}
+
+func (c secretRollCommand) Execute(ctx context.Context, env *Env, args string) CommandResult {
+	result := executeSeededRoll(ctx, env, args, env.nextSeed())
+	if !result.Success {
+		// Errors go back to the sender only, so a typo doesn't reveal the roll
+		result.Private = true
+		return result
+	}
+	result.Visibility = c.visibility
+	return result
+}
+
+// executeSeededRoll rolls args with dice drawn from seed and records the
+// seed and the dice in the result's audit trail.
+func executeSeededRoll(ctx context.Context, env *Env, args string, seed Seed) CommandResult {
+	result := executeRoll(ctx, env, args, seed.Rand())
+	if result.Roll != nil {
+		result.Audit = rollAudit(seed, result.Roll)
+	}
+	return result
+}
+
+// rollAudit is the audit trail of a roll made with dice drawn from seed.
+func rollAudit(seed Seed, roll *RollResult) *models.RollAudit {
+	return &models.RollAudit{
+		Seed: seed[:],
+		Dice: roll.RawDice(),
+	}
 }
 
 func executeRollCommandWithRand(args string, rng *rand.Rand) CommandResult {
+	return executeRoll(context.Background(), nil, args, rng)
+}
+
+// executeRoll parses args, looks up its @references through env and rolls it.
+func executeRoll(ctx context.Context, env *Env, args string, rng *rand.Rand) CommandResult {
 	args = strings.TrimSpace(args)
 	if args == "" {
 		return CommandResult{
@@ -35,342 +144,94 @@ func executeRollCommandWithRand(args string, rng *rand.Rand) CommandResult {
 		}
 	}
 
-	// Remove all spaces for easier parsing
-	args = strings.ReplaceAll(args, " ", "")
-
-	// Check if this is a versus roll FIRST
-	if isVersusRoll(args) {
-		return executeVersusRollCommand(args, rng)
-	}
-
-	// Check if it's a multiple roll (Nx(...))
-	if idx := strings.Index(args, "x("); idx > 0 {
-		// Extract N
-		nStr := args[:idx]
-		n, err := strconv.Atoi(nStr)
-		if err != nil || n < 1 || n > 100 {
-			return CommandResult{
-				Success: false,
-				Result:  "Repetition count must be between 1 and 100",
-			}
-		}
-
-		// Extract expression inside parentheses
-		if !strings.HasSuffix(args, ")") {
-			return CommandResult{
-				Success: false,
-				Result:  "Missing closing parenthesis",
-			}
-		}
-		expr := args[idx+2 : len(args)-1]
-
-		// Execute N times
-		results := make([]int, n)
-		outputs := make([]string, n)
-
-		for i := 0; i < n; i++ {
-			output, result, err := evaluate(expr, rng)
-			if err != nil {
-				return CommandResult{
-					Success: false,
-					Result:  err.Error(),
-				}
-			}
-			results[i] = result
-			// Add result to each output line
-			// Only show "= result" if there are operators in the output
-			if strings.ContainsAny(output, "+-*/(") {
-				outputs[i] = fmt.Sprintf("%s = %d", output, result)
-			} else {
-				outputs[i] = output
-			}
-		}
-
-		// Sort results
-		sortedResults := make([]int, n)
-		copy(sortedResults, results)
-		sort.Slice(sortedResults, func(i, j int) bool {
-			return sortedResults[i] > sortedResults[j]
-		})
-
-		// Format output
-		var sb strings.Builder
-		sb.WriteString(fmt.Sprintf("%dx(%s):\n", n, expr))
-		for _, output := range outputs {
-			sb.WriteString(output)
-			sb.WriteString("\n")
-		}
-		for i, r := range sortedResults {
-			if i > 0 {
-				sb.WriteString(", ")
-			}
-			sb.WriteString(strconv.Itoa(r))
-		}
-
-		return CommandResult{
-			Success: true,
-			Result:  sb.String(),
-		}
-	}
-
-	// Single evaluation
-	output, result, err := evaluate(args, rng)
+	roll, err := ParseRoll(args)
 	if err != nil {
 		return CommandResult{
 			Success: false,
 			Result:  err.Error(),
 		}
 	}
-
-	// For simple single-value results (no operators in output),
-	// just show the value without redundant "= result"
-	// Check for any of: +, -, *, /, or parentheses
-	hasOperators := strings.ContainsAny(output, "+-*/()")
-	if !hasOperators {
+	if err := resolveRefs(ctx, env, roll); err != nil {
 		return CommandResult{
-			Success: true,
-			Result:  fmt.Sprintf("%s:\n%s", args, output),
+			Success: false,
+			Result:  err.Error(),
 		}
 	}
 
-	return CommandResult{
-		Success: true,
-		Result:  fmt.Sprintf("%s:\n%s = %d", args, output, result),
-	}
+	return rollCommandResult(roll, rng)
 }
 
-func evaluate(expr string, rng *rand.Rand) (string, int, error) {
-	var terms []struct {
-		positive bool
-		term     string
-	}
-
-	current := ""
-	positive := true
-
-	for i := 0; i < len(expr); i++ {
-		ch := expr[i]
-		if ch == '+' || (ch == '-' && i > 0 && expr[i-1] != 'd' && expr[i-1] != 'k' && expr[i-1] != 'l') {
-			if current != "" {
-				terms = append(terms, struct {
-					positive bool
-					term     string
-				}{positive, current})
-				current = ""
-			}
-			positive = (ch == '+')
-		} else {
-			current += string(ch)
+// rollCommandResult evaluates a parsed roll into a command result
+func rollCommandResult(roll *Roll, rng *rand.Rand) CommandResult {
+	result, err := evaluateRoll(roll, rng)
+	if err != nil {
+		return CommandResult{
+			Success: false,
+			Result:  err.Error(),
 		}
 	}
-	if current != "" {
-		terms = append(terms, struct {
-			positive bool
-			term     string
-		}{positive, current})
-	}
-
-	if len(terms) == 0 {
-		return "", 0, fmt.Errorf("empty expression")
-	}
-
-	var outputs []string
-	total := 0
 
-	for _, t := range terms {
-		output, value, err := evaluateTerm(t.term, rng)
-		if err != nil {
-			return "", 0, err
-		}
-
-		if !t.positive {
-			value = -value
-			output = "-" + output
-		}
-
-		if output != "" {
-			outputs = append(outputs, output)
-		}
-		total += value
+	return CommandResult{
+		Success: true,
+		Result:  result.Text(),
+		Roll:    result,
 	}
-
-	return strings.Join(outputs, " + "), total, nil
 }
 
-func evaluateTerm(term string, rng *rand.Rand) (string, int, error) {
-	// Check for multiplier at the beginning (e.g., "3(...)")
-	if idx := strings.Index(term, "("); idx > 0 {
-		multStr := term[:idx]
-		mult, err := strconv.Atoi(multStr)
-		if err == nil && strings.HasSuffix(term, ")") {
-			// It's a multiplier
-			inner := term[idx+1 : len(term)-1]
-			output, value, err := evaluate(inner, rng)
-			if err != nil {
-				return "", 0, err
-			}
-			return fmt.Sprintf("%d(%s)", mult, output), mult * value, nil
-		}
+// evaluateRoll rolls a parsed expression, once per repetition, and scores
+// it against the target when there is one
+func evaluateRoll(roll *Roll, rng *rand.Rand) (*RollResult, error) {
+	ev := &evaluator{rng: rng}
+	result := &RollResult{
+		Expression: roll.ExprText,
+		Repeat:     roll.Repeat,
+		Bonus:      roll.Bonus,
 	}
 
-	// Check for parentheses
-	if strings.HasPrefix(term, "(") && strings.HasSuffix(term, ")") {
-		inner := term[1 : len(term)-1]
-		output, value, err := evaluate(inner, rng)
+	var crits critRange
+	if roll.Target != nil {
+		target, err := versusTarget(roll, ev)
 		if err != nil {
-			return "", 0, err
+			return nil, err
 		}
-		return "(" + output + ")", value, nil
-	}
-
-	// Check if it's a dice roll
-	if strings.Contains(term, "d") {
-		return evaluateDiceRoll(term, rng)
-	}
-
-	// It's a constant
-	value, err := strconv.Atoi(term)
-	if err != nil {
-		return "", 0, fmt.Errorf("invalid term: %s", term)
-	}
-	return strconv.Itoa(value), value, nil
-}
-
-func evaluateDiceRoll(term string, rng *rand.Rand) (string, int, error) {
-	// Parse formats: d6, 2d10, 4d6k3, 4d6l3
-	parts := strings.Split(term, "d")
-	if len(parts) != 2 {
-		return "", 0, fmt.Errorf("invalid dice format: %s", term)
+		result.Target = &target
+		crits = critRangeFor(roll.Expr)
 	}
 
-	numDice := 1
-	if parts[0] != "" {
-		var err error
-		numDice, err = strconv.Atoi(parts[0])
-		if err != nil {
-			return "", 0, fmt.Errorf("invalid number of dice: %s", parts[0])
+	for _, ref := range rollRefs(roll) {
+		if result.Refs == nil {
+			result.Refs = map[string]int{}
 		}
+		result.Refs[ref.Text] = ref.Value
 	}
 
-	// Validate dice count
-	if numDice < 1 || numDice > 1000 {
-		return "", 0, fmt.Errorf("dice count must be between 1 and 1000")
-	}
-
-	// Check for keep highest (k) or keep lowest (l)
-	diceSides := 0
-	keepCount := numDice
-	keepHighest := true
-
-	remaining := parts[1]
-	if idx := strings.Index(remaining, "k"); idx > 0 {
-		var err error
-		diceSides, err = strconv.Atoi(remaining[:idx])
+	for i := 0; i < max(1, roll.Repeat); i++ {
+		r, err := ev.eval(roll.Expr)
 		if err != nil {
-			return "", 0, fmt.Errorf("invalid dice sides: %s", remaining[:idx])
-		}
-		keepCount, err = strconv.Atoi(remaining[idx+1:])
-		if err != nil {
-			return "", 0, fmt.Errorf("invalid keep count: %s", remaining[idx+1:])
-		}
-		keepHighest = true
-	} else if idx := strings.Index(remaining, "l"); idx > 0 {
-		var err error
-		diceSides, err = strconv.Atoi(remaining[:idx])
-		if err != nil {
-			return "", 0, fmt.Errorf("invalid dice sides: %s", remaining[:idx])
-		}
-		keepCount, err = strconv.Atoi(remaining[idx+1:])
-		if err != nil {
-			return "", 0, fmt.Errorf("invalid keep count: %s", remaining[idx+1:])
-		}
-		keepHighest = false
-	} else {
-		var err error
-		diceSides, err = strconv.Atoi(remaining)
-		if err != nil {
-			return "", 0, fmt.Errorf("invalid dice sides: %s", remaining)
-		}
-	}
-
-	// Validate dice sides
-	if diceSides < 1 || diceSides > 100000 {
-		return "", 0, fmt.Errorf("dice sides must be between 1 and 100000")
-	}
-
-	// Roll the dice
-	rolls := make([]int, numDice)
-	for i := 0; i < numDice; i++ {
-		rolls[i] = rng.Intn(diceSides) + 1
-	}
-
-	// Calculate sum and format output
-	if keepCount < numDice {
-		// Sort to keep highest or lowest
-		sorted := make([]int, numDice)
-		copy(sorted, rolls)
-		sort.Ints(sorted)
-
-		kept := make(map[int]int) // value -> count of how many to keep
-		if keepHighest {
-			for i := numDice - keepCount; i < numDice; i++ {
-				kept[sorted[i]]++
-			}
-		} else {
-			for i := 0; i < keepCount; i++ {
-				kept[sorted[i]]++
-			}
-		}
-
-		// Format output
-		var parts []string
-		sum := 0
-		keptCopy := make(map[int]int)
-		maps.Copy(keptCopy, kept)
-
-		for _, roll := range rolls {
-			if keptCopy[roll] > 0 {
-				parts = append(parts, strconv.Itoa(roll))
-				sum += roll
-				keptCopy[roll]--
+			return nil, err
+		}
+
+		line := RollLine{
+			Groups:    r.groups,
+			Breakdown: truncateBreakdown(r.text),
+			Total:     r.value,
+		}
+		if result.Target != nil {
+			level, _, isSuccess := calculateSuccessLevelWithCrits(r.value, *result.Target, roll.Bonus, crits)
+			line.Success = &isSuccess
+			line.Degrees = level
+			line.CritSuccess = crits.success.Match(r.value)
+			line.CritFail = crits.fail.Match(r.value)
+			if isSuccess {
+				result.NetDegrees += level
 			} else {
-				parts = append(parts, "("+strconv.Itoa(roll)+")")
+				result.NetDegrees -= level
 			}
 		}
 
-		return strings.Join(parts, " + "), sum, nil
-	} else {
-		// Simple roll (keepCount >= numDice, so keep all)
-		sum := 0
-		var parts []string
-		for _, roll := range rolls {
-			parts = append(parts, strconv.Itoa(roll))
-			sum += roll
-		}
-		return strings.Join(parts, " + "), sum, nil
+		result.Total += r.value
+		result.Lines = append(result.Lines, line)
 	}
-}
 
-// getMaxDiceValue estimates the maximum value from a roll expression
-func getMaxDiceValue(expr string) int {
-	// Simple heuristic: if it contains "d100", return 100
-	// For more complex expressions, we'll default to 100
-	if strings.Contains(expr, "d100") {
-		return 100
-	}
-	// Try to extract dice size from format like "2d20", "d6", etc.
-	if idx := strings.Index(expr, "d"); idx >= 0 {
-		// Find the number after 'd'
-		start := idx + 1
-		end := start
-		for end < len(expr) && expr[end] >= '0' && expr[end] <= '9' {
-			end++
-		}
-		if end > start {
-			if size, err := strconv.Atoi(expr[start:end]); err == nil {
-				return size
-			}
-		}
-	}
-	return 100 // Default to d100 rules
+	return result, nil
 }
@@ -517,6 +517,18 @@ func TestExecuteRollCommandValidation(t *testing.T) {
 			wantSuccess: false,
 			wantContain: "Repetition count must be between 1 and 100",
 		},
+		{
+			name:        "Too many dice across repetitions",
+			args:        "100x(1000d100000!>1+1000d100000!>1+1)",
+			wantSuccess: false,
+			wantContain: "Too many dice",
+		},
+		{
+			name:        "At boundary - 2000 dice across repetitions",
+			args:        "2x(500d6+500d6)",
+			wantSuccess: true,
+			wantContain: "",
+		},
 		{
 			name:        "At boundary - 1000 dice",
 			args:        "1000d6",
@@ -1,53 +1,49 @@
 package commands
 
 import (
-	"fmt"
 	"math/rand"
-	"regexp"
-	"strconv"
-	"strings"
 )
 
-// isVersusRoll checks if the expression contains a "vs" comparison
-func isVersusRoll(expr string) bool {
-	return strings.Contains(expr, "vs")
+// critRange holds the compare points that make a versus roll critical.
+type critRange struct {
+	success *Compare
+	fail    *Compare
 }
 
-// parseVersusRoll splits expression into roll part and target difficulty
-func parseVersusRoll(expr string) (rollExpr string, target int, bonusSuccesses int, err error) {
-	// Groups: 1 rollExpr, 2 target, 3 bonus (optional)
-	versusRegex := regexp.MustCompile(`^(.+?)\s*vs\s*(\d+)(?:\s*\[\+(\d+)\])?$`)
-
-	matches := versusRegex.FindStringSubmatch(expr)
-	if matches == nil {
-		return "", 0, 0, fmt.Errorf("invalid vs format")
-	}
-
-	rollExpr = strings.TrimSpace(matches[1])
-
-	target, err = strconv.Atoi(matches[2])
-	if err != nil {
-		return "", 0, 0, fmt.Errorf("invalid target value: %s", matches[2])
+// defaultCritRange is 1-5 and 96-100 for d100, scaled for other dice
+func defaultCritRange(maxValue int) critRange {
+	critLowThreshold := max(1, maxValue/20) // 5% low
+	critHighThreshold := maxValue - critLowThreshold + 1
+	return critRange{
+		success: &Compare{Op: "<=", Value: critLowThreshold},
+		fail:    &Compare{Op: ">=", Value: critHighThreshold},
 	}
+}
 
-	if matches[3] != "" {
-		bonusSuccesses, err = strconv.Atoi(matches[3])
-		if err != nil {
-			return "", 0, 0, fmt.Errorf("invalid bonus successes: %s", matches[3])
+// critRangeFor uses the cs/cf modifiers of the first dice group when
+// present and the default range for its size otherwise
+func critRangeFor(expr Node) critRange {
+	crits := defaultCritRange(maxDieSides(expr))
+	if d := firstDice(expr); d != nil {
+		if d.CritSuccess != nil {
+			crits.success = d.CritSuccess
+		}
+		if d.CritFail != nil {
+			crits.fail = d.CritFail
 		}
 	}
-
-	return rollExpr, target, bonusSuccesses, nil
+	return crits
 }
 
 // calculateSuccessLevel determines success/fail levels and if it's a critical
 func calculateSuccessLevel(rollResult, target, maxValue, bonusSuccesses int) (level int, isCrit bool, isSuccess bool) {
-	// Check for critical results (for d100: 1-5 and 96-100)
-	// For other dice, scale proportionally
-	critLowThreshold := max(1, maxValue/20) // 5% low
-	critHighThreshold := maxValue - critLowThreshold + 1
+	return calculateSuccessLevelWithCrits(rollResult, target, bonusSuccesses, defaultCritRange(maxValue))
+}
 
-	isCrit = (rollResult <= critLowThreshold) || (rollResult >= critHighThreshold)
+// calculateSuccessLevelWithCrits is calculateSuccessLevel with explicit crit ranges
+func calculateSuccessLevelWithCrits(rollResult, target, bonusSuccesses int, crits critRange) (level int, isCrit bool, isSuccess bool) {
+	isCritFail := crits.fail.Match(rollResult)
+	isCrit = crits.success.Match(rollResult) || isCritFail
 
 	// Calculate success/failure levels based on distance from target
 	if rollResult <= target {
@@ -57,7 +53,7 @@ func calculateSuccessLevel(rollResult, target, maxValue, bonusSuccesses int) (le
 		// Add bonus successes only on success
 		level += bonusSuccesses
 		// Crit fail overrides success: 0 fails instead
-		if rollResult >= critHighThreshold {
+		if isCritFail {
 			return 0, isCrit, false
 		}
 		return level, isCrit, true
@@ -70,175 +66,31 @@ func calculateSuccessLevel(rollResult, target, maxValue, bonusSuccesses int) (le
 	}
 }
 
-// executeVersusRollCommand handles versus roll logic
+// executeVersusRollCommand parses and executes a versus roll
 func executeVersusRollCommand(args string, rng *rand.Rand) CommandResult {
-	args = strings.ReplaceAll(args, " ", "")
-
-	// Check if it's a multiple roll (Nx(...))
-	if idx := strings.Index(args, "x("); idx > 0 {
-		return executeMultipleVersusRoll(args, rng)
-	}
-
-	// Single versus roll
-	return executeSingleVersusRoll(args, rng)
-}
-
-// executeSingleVersusRoll handles a single roll vs difficulty
-func executeSingleVersusRoll(args string, rng *rand.Rand) CommandResult {
-	rollExpr, target, bonusSuccesses, err := parseVersusRoll(args)
+	roll, err := ParseRoll(args)
 	if err != nil {
 		return CommandResult{
 			Success: false,
 			Result:  err.Error(),
 		}
 	}
-
-	// Execute the roll
-	output, result, err := evaluate(rollExpr, rng)
-	if err != nil {
+	if roll.Target == nil {
 		return CommandResult{
 			Success: false,
-			Result:  err.Error(),
-		}
-	}
-
-	// Determine max value for crit calculation
-	maxValue := getMaxDiceValue(rollExpr)
-
-	// Calculate success/failure
-	level, isCrit, isSuccess := calculateSuccessLevel(result, target, maxValue, bonusSuccesses)
-
-	// Format result
-	var sb strings.Builder
-
-	// Show command with bonus if present
-	if bonusSuccesses > 0 {
-		sb.WriteString(fmt.Sprintf("%s vs %d [+%d]:\n", rollExpr, target, bonusSuccesses))
-	} else {
-		sb.WriteString(fmt.Sprintf("%s vs %d:\n", rollExpr, target))
-	}
-
-	// Show the roll breakdown - only show calculation if there are operators
-	if strings.ContainsAny(output, "+-*/(") {
-		sb.WriteString(fmt.Sprintf("%s = %d\n", output, result))
-	}
-
-	// Show result line
-	if isSuccess {
-		sb.WriteString(fmt.Sprintf("%d, %d success", result, level))
-		if isCrit {
-			sb.WriteString(", crit!")
+			Result:  "invalid vs format",
 		}
-	} else {
-		sb.WriteString(fmt.Sprintf("%d, %d fail", result, level))
-		if isCrit {
-			sb.WriteString(", crit!")
-		}
-	}
-
-	return CommandResult{
-		Success: true,
-		Result:  sb.String(),
 	}
+	return rollCommandResult(roll, rng)
 }
 
-// executeMultipleVersusRoll handles multiple versus rolls (e.g., 5x(d100 vs 50))
-func executeMultipleVersusRoll(args string, rng *rand.Rand) CommandResult {
-	// Extract N
-	idx := strings.Index(args, "x(")
-	nStr := args[:idx]
-	n, err := strconv.Atoi(nStr)
-	if err != nil || n < 1 || n > 100 {
-		return CommandResult{
-			Success: false,
-			Result:  "Repetition count must be between 1 and 100",
-		}
-	}
-
-	// Extract expression inside parentheses
-	if !strings.HasSuffix(args, ")") {
-		return CommandResult{
-			Success: false,
-			Result:  "Missing closing parenthesis",
-		}
-	}
-	expr := args[idx+2 : len(args)-1]
-
-	// Parse the versus roll
-	rollExpr, target, bonusSuccesses, err := parseVersusRoll(expr)
+// versusTarget evaluates the difficulty of a versus roll
+func versusTarget(roll *Roll, ev *evaluator) (int, error) {
+	r, err := ev.eval(roll.Target)
 	if err != nil {
-		return CommandResult{
-			Success: false,
-			Result:  err.Error(),
-		}
-	}
-
-	maxValue := getMaxDiceValue(rollExpr)
-
-	// Execute N times
-	var outputs []string
-	var levelContributions []string
-	totalSuccessLevel := 0
-
-	for i := 0; i < n; i++ {
-		output, result, err := evaluate(rollExpr, rng)
-		if err != nil {
-			return CommandResult{
-				Success: false,
-				Result:  err.Error(),
-			}
-		}
-
-		level, isCrit, isSuccess := calculateSuccessLevel(result, target, maxValue, bonusSuccesses)
-
-		// Format individual result - only show calculation if there are operators
-		var line strings.Builder
-		if strings.ContainsAny(output, "+-*/(") {
-			line.WriteString(fmt.Sprintf("%s = %d, ", output, result))
-		} else {
-			line.WriteString(fmt.Sprintf("%d, ", result))
-		}
-
-		if isSuccess {
-			line.WriteString(fmt.Sprintf("%d success", level))
-			totalSuccessLevel += level
-			levelContributions = append(levelContributions, fmt.Sprintf("%d", level))
-		} else {
-			line.WriteString(fmt.Sprintf("%d fail", level))
-			totalSuccessLevel -= level
-			levelContributions = append(levelContributions, fmt.Sprintf("-%d", level))
-		}
-
-		if isCrit {
-			line.WriteString(", crit!")
-		}
-
-		outputs = append(outputs, line.String())
-	}
-
-	// Format final output
-	var sb strings.Builder
-	if bonusSuccesses > 0 {
-		sb.WriteString(fmt.Sprintf("%dx(%s vs %d [+%d]):\n", n, rollExpr, target, bonusSuccesses))
-	} else {
-		sb.WriteString(fmt.Sprintf("%dx(%s vs %d):\n", n, rollExpr, target))
-	}
-
-	for _, output := range outputs {
-		sb.WriteString(output)
-		sb.WriteString("\n")
-	}
-
-	// Show the calculation breakdown
-	calculation := strings.Join(levelContributions, " + ")
-	calculation = strings.ReplaceAll(calculation, "+ -", "- ")
-	sb.WriteString(fmt.Sprintf("%s = %d\n", calculation, totalSuccessLevel))
-	sb.WriteString(fmt.Sprintf("Total: %d success", totalSuccessLevel))
-
-	return CommandResult{
-		Success: true,
-		Result:  sb.String(),
+		return 0, err
 	}
+	return r.value, nil
 }
 
 func max(a, b int) int {
@@ -1,12 +1,13 @@
 package commands
 
 import (
+	"errors"
 	"math/rand"
 	"strings"
 	"testing"
 )
 
-func TestIsVersusRoll(t *testing.T) {
+func TestParseRollVersus(t *testing.T) {
 	tests := []struct {
 		expr     string
 		expected bool
@@ -18,9 +19,13 @@ func TestIsVersusRoll(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		result := isVersusRoll(tt.expr)
-		if result != tt.expected {
-			t.Errorf("isVersusRoll(%q) = %v, want %v", tt.expr, result, tt.expected)
+		roll, err := ParseRoll(tt.expr)
+		if err != nil {
+			t.Errorf("ParseRoll(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if result := roll.Target != nil; result != tt.expected {
+			t.Errorf("ParseRoll(%q) has target = %v, want %v", tt.expr, result, tt.expected)
 		}
 	}
 }
@@ -35,26 +40,33 @@ func TestParseVersusRoll(t *testing.T) {
 		{"d100vs70", "d100", 70, false},
 		{"2d50+3vs77", "2d50+3", 77, false},
 		{"d20vs15", "d20", 15, false},
+		{"d100 vs 60+10", "d100", 70, false},
 		{"invalid", "", 0, true},
 		{"d100vsabc", "", 0, true},
+		{"d100vsd10", "", 0, true},
 	}
 
 	for _, tt := range tests {
-		roll, target, _, err := parseVersusRoll(tt.expr)
+		roll, err := ParseRoll(tt.expr)
+		if err == nil && roll.Target == nil {
+			err = errors.New("missing target")
+		}
 		if tt.shouldError {
 			if err == nil {
-				t.Errorf("parseVersusRoll(%q) should have errored", tt.expr)
-			}
-		} else {
-			if err != nil {
-				t.Errorf("parseVersusRoll(%q) unexpected error: %v", tt.expr, err)
-			}
-			if roll != tt.expectedRoll {
-				t.Errorf("parseVersusRoll(%q) roll = %q, want %q", tt.expr, roll, tt.expectedRoll)
-			}
-			if target != tt.expectedTarget {
-				t.Errorf("parseVersusRoll(%q) target = %d, want %d", tt.expr, target, tt.expectedTarget)
+				t.Errorf("ParseRoll(%q) should have errored", tt.expr)
 			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRoll(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if roll.ExprText != tt.expectedRoll {
+			t.Errorf("ParseRoll(%q) roll = %q, want %q", tt.expr, roll.ExprText, tt.expectedRoll)
+		}
+		target, _ := versusTarget(roll, &evaluator{})
+		if target != tt.expectedTarget {
+			t.Errorf("ParseRoll(%q) target = %d, want %d", tt.expr, target, tt.expectedTarget)
 		}
 	}
 }
@@ -113,7 +125,7 @@ func TestCalculateSuccessLevel(t *testing.T) {
 	}
 }
 
-func TestGetMaxDiceValue(t *testing.T) {
+func TestMaxDieSides(t *testing.T) {
 	tests := []struct {
 		expr     string
 		expected int
@@ -123,13 +135,18 @@ func TestGetMaxDiceValue(t *testing.T) {
 		{"d20", 20},
 		{"3d6", 6},
 		{"d6+2", 6},
-		{"complex", 100}, // Default
+		{"2(d10+1)", 10},
+		{"5+3", 100}, // Default
 	}
 
 	for _, tt := range tests {
-		result := getMaxDiceValue(tt.expr)
+		expr, err := ParseExpr(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseExpr(%q) unexpected error: %v", tt.expr, err)
+		}
+		result := maxDieSides(expr)
 		if result != tt.expected {
-			t.Errorf("getMaxDiceValue(%q) = %d, want %d", tt.expr, result, tt.expected)
+			t.Errorf("maxDieSides(%q) = %d, want %d", tt.expr, result, tt.expected)
 		}
 	}
 }
@@ -166,7 +183,7 @@ func TestExecuteSingleVersusRoll(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		result := executeSingleVersusRoll(tt.args, rng)
+		result := executeVersusRollCommand(tt.args, rng)
 		if tt.shouldError && result.Success {
 			t.Errorf("executeSingleVersusRoll(%q) should have failed", tt.args)
 		}
@@ -213,7 +230,7 @@ func TestExecuteMultipleVersusRoll(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		result := executeMultipleVersusRoll(tt.args, rng)
+		result := executeVersusRollCommand(tt.args, rng)
 		if tt.shouldError && result.Success {
 			t.Errorf("executeMultipleVersusRoll(%q) should have failed", tt.args)
 		}
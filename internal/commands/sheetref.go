@@ -0,0 +1,179 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+// RefResolver looks up the value of an @reference in a roll expression.
+type RefResolver interface {
+	ResolveRef(ctx context.Context, ref *RefNode) (int, error)
+}
+
+// resolveRefs fills in the value of every @reference in roll. References
+// are looked up through env.Refs, or on the room's character sheets when it
+// is nil.
+func resolveRefs(ctx context.Context, env *Env, roll *Roll) error {
+	refs := rollRefs(roll)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	var resolver RefResolver
+	switch {
+	case env != nil && env.Refs != nil:
+		resolver = env.Refs
+	case env != nil && env.Models != nil && env.Models.Rooms != nil && env.Models.CharacterSheets != nil:
+		resolver = &sheetRefs{env: env, sheets: map[string]*models.CharacterSheetContent{}}
+	default:
+		return fmt.Errorf("%s needs a character sheet, which is not available here", refs[0].Text)
+	}
+
+	for _, ref := range refs {
+		v, err := resolver.ResolveRef(ctx, ref)
+		if err != nil {
+			return err
+		}
+		ref.Value = v
+		ref.Resolved = true
+	}
+	return nil
+}
+
+// rollRefs returns the references in the expression and the target of roll,
+// in source order.
+func rollRefs(roll *Roll) []*RefNode {
+	var refs []*RefNode
+	collect := func(n Node) {
+		if ref, ok := n.(*RefNode); ok {
+			refs = append(refs, ref)
+		}
+	}
+	walk(roll.Expr, collect)
+	if roll.Target != nil {
+		walk(roll.Target, collect)
+	}
+	return refs
+}
+
+// sheetRefs resolves references against the character sheets of the room:
+// the one the sender owns, or the one named in @{Name}.WS. Each sheet is
+// loaded once per roll.
+type sheetRefs struct {
+	env    *Env
+	sheets map[string]*models.CharacterSheetContent // by lower-cased name, "" for the sender's own
+}
+
+func (s *sheetRefs) ResolveRef(ctx context.Context, ref *RefNode) (int, error) {
+	sheet, err := s.sheet(ctx, ref.Sheet)
+	if err != nil {
+		return 0, err
+	}
+	return sheetRefValue(sheet, ref)
+}
+
+// sheetRefValue looks up ref on sheet: a characteristic, a characteristic
+// bonus or a skill.
+func sheetRefValue(sheet *models.CharacterSheetContent, ref *RefNode) (int, error) {
+	if v, ok := sheet.CharacteristicValue(ref.Name); ok {
+		return v, nil
+	}
+	// @SB, @WSB, @InfB ... are characteristic bonuses
+	if key, found := strings.CutSuffix(ref.Name, "B"); found {
+		if v, ok := sheet.CharacteristicBonus(key); ok {
+			return v, nil
+		}
+	}
+	if v, ok := sheet.SkillDifficulty(ref.Name); ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("%s: no characteristic or skill called %s on %s", ref.Text, ref.Name, sheet.CharacterInfo.CharacterName)
+}
+
+func (s *sheetRefs) sheet(ctx context.Context, name string) (*models.CharacterSheetContent, error) {
+	cacheKey := strings.ToLower(name)
+	if sheet, ok := s.sheets[cacheKey]; ok {
+		return sheet, nil
+	}
+
+	players, err := s.env.Models.Rooms.PlayersWithSheets(ctx, s.env.RoomID)
+	if err != nil {
+		return nil, errors.New("Could not load the character sheets of this room")
+	}
+
+	var matches []*models.CharacterSheet
+	for _, p := range players {
+		for _, cs := range p.CharacterSheets {
+			if name == "" && cs.OwnerID == s.env.UserID ||
+				name != "" && strings.EqualFold(strings.TrimSpace(cs.CharacterName), name) {
+				matches = append(matches, cs)
+			}
+		}
+	}
+
+	switch {
+	case len(matches) == 0 && name == "":
+		return nil, errors.New("You have no character sheet in this room")
+	case len(matches) == 0:
+		return nil, fmt.Errorf("No character sheet named %s in this room", name)
+	case len(matches) > 1 && name == "":
+		return nil, errors.New("You have several character sheets in this room, pick one with @{Name}.WS")
+	case len(matches) > 1:
+		return nil, fmt.Errorf("Several character sheets are named %s", name)
+	}
+
+	var raw json.RawMessage
+	if matches[0].OwnerID == s.env.UserID {
+		cs, err := s.env.Models.CharacterSheets.Get(ctx, matches[0].ID)
+		if err != nil {
+			return nil, errors.New("Could not load your character sheet")
+		}
+		raw = cs.Content
+	} else {
+		view, err := s.env.Models.CharacterSheets.GetWithPermission(ctx, s.env.UserID, matches[0].ID)
+		if errors.Is(err, models.ErrPermissionDenied) {
+			return nil, fmt.Errorf("You cannot see the character sheet of %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not load the character sheet of %s", name)
+		}
+		raw = view.CharacterSheet.Content
+	}
+
+	sheet := &models.CharacterSheetContent{}
+	if err := json.Unmarshal(raw, sheet); err != nil {
+		return nil, errors.New("Character sheet is corrupted")
+	}
+	s.sheets[cacheKey] = sheet
+	return sheet, nil
+}
+
+// contentRefs resolves references against a single sheet that is already
+// loaded, such as the one an initiative entry was added from.
+type contentRefs struct {
+	sheet *models.CharacterSheetContent
+}
+
+func (c contentRefs) ResolveRef(ctx context.Context, ref *RefNode) (int, error) {
+	if ref.Sheet != "" {
+		return 0, fmt.Errorf("%s: only the sheet's own values can be used here", ref.Text)
+	}
+	return sheetRefValue(c.sheet, ref)
+}
+
+// storedRefs replays references with the values they had when the roll was
+// made.
+type storedRefs map[string]int
+
+func (s storedRefs) ResolveRef(ctx context.Context, ref *RefNode) (int, error) {
+	v, ok := s[ref.Text]
+	if !ok {
+		return 0, fmt.Errorf("no value was recorded for %s", ref.Text)
+	}
+	return v, nil
+}
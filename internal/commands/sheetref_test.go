@@ -0,0 +1,191 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+type fakeRooms struct {
+	models.RoomModelInterface
+	players []*models.PlayerView
+}
+
+func (f fakeRooms) PlayersWithSheets(ctx context.Context, roomID int) ([]*models.PlayerView, error) {
+	return f.players, nil
+}
+
+type fakeCharacterSheets struct {
+	models.CharacterSheetModelInterface
+	sheets map[int]*models.CharacterSheet
+	hidden map[int]bool // sheets other players may not view
+}
+
+func (f fakeCharacterSheets) Get(ctx context.Context, id int) (*models.CharacterSheet, error) {
+	sheet, ok := f.sheets[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	return sheet, nil
+}
+
+func (f fakeCharacterSheets) GetWithPermission(ctx context.Context, userID, id int) (*models.CharacterSheetView, error) {
+	sheet, ok := f.sheets[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	if f.hidden[id] && sheet.OwnerID != userID {
+		return nil, models.ErrPermissionDenied
+	}
+	return &models.CharacterSheetView{CharacterSheet: sheet, CanView: true}, nil
+}
+
+func refEnv(userID int) *Env {
+	sheet := func(id, owner int, name, characteristics string) *models.CharacterSheet {
+		content := `{"characterInfo": {"characterName": "` + name + `"}, "characteristics": ` + characteristics + `,
+			"skillsLeft": {"awareness": {"plus0": true}}}`
+		return &models.CharacterSheet{ID: id, OwnerID: owner, RoomID: 1, CharacterName: name, Content: json.RawMessage(content)}
+	}
+	sheets := map[int]*models.CharacterSheet{
+		10: sheet(10, 2, "Brother Marcus", `{"WS": {"value": "47"}, "S": {"value": "38"}, "P": {"value": "41"}}`),
+		11: sheet(11, 3, "Ada", `{"WS": {"value": "30"}}`),
+		12: sheet(12, 3, "Ada's Servitor", `{"WS": {"value": "25"}}`),
+		13: sheet(13, 1, "Secret Villain", `{"WS": {"value": "65"}}`),
+	}
+	player := func(id int, sheetIDs ...int) *models.PlayerView {
+		p := &models.PlayerView{User: &models.User{ID: id}}
+		for _, sid := range sheetIDs {
+			p.CharacterSheets = append(p.CharacterSheets, sheets[sid])
+		}
+		return p
+	}
+	return &Env{
+		UserID: userID,
+		RoomID: 1,
+		Models: &models.Models{
+			Rooms:           fakeRooms{players: []*models.PlayerView{player(1, 13), player(2, 10), player(3, 11, 12), player(4)}},
+			CharacterSheets: fakeCharacterSheets{sheets: sheets, hidden: map[int]bool{13: true}},
+		},
+		Seeds: NewRoomRNG(),
+	}
+}
+
+func TestRollSheetRefs(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		userID int
+		args   string
+		want   map[string]int
+	}{
+		{2, "d100 vs @WS", map[string]int{"@WS": 47}},
+		{2, "d100 vs @Awareness+10", map[string]int{"@Awareness": 41}},
+		{2, "d10+@SB", map[string]int{"@SB": 3}},
+		{2, "d100 vs @ws - @{ada}.WS", map[string]int{"@ws": 47, "@{ada}.WS": 30}},
+		{4, "d100 vs @{Brother Marcus}.WS", map[string]int{"@{Brother Marcus}.WS": 47}},
+		{1, "d100 vs @{Secret Villain}.WS", map[string]int{"@{Secret Villain}.WS": 65}},
+	}
+	for _, tt := range tests {
+		res := rollCommand{}.Execute(ctx, refEnv(tt.userID), tt.args)
+		if !res.Success {
+			t.Errorf("/r %s by %d failed: %s", tt.args, tt.userID, res.Result)
+			continue
+		}
+		if len(res.Roll.Refs) != len(tt.want) {
+			t.Errorf("/r %s refs = %v, want %v", tt.args, res.Roll.Refs, tt.want)
+		}
+		for text, v := range tt.want {
+			if res.Roll.Refs[text] != v {
+				t.Errorf("/r %s: %s = %d, want %d", tt.args, text, res.Roll.Refs[text], v)
+			}
+		}
+	}
+
+	res := rollCommand{}.Execute(ctx, refEnv(2), "d100 vs @WS")
+	if *res.Roll.Target != 47 {
+		t.Errorf("target = %d, want 47", *res.Roll.Target)
+	}
+}
+
+func TestRollSheetRefErrors(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		userID  int
+		args    string
+		wantErr string
+	}{
+		{4, "d100 vs @WS", "You have no character sheet"},
+		{3, "d100 vs @WS", "several character sheets"},
+		{2, "d100 vs @Basketry", "no characteristic or skill called Basketry"},
+		{2, "d100 vs @{Nobody}.WS", "No character sheet named Nobody"},
+		{2, "d100 vs @{Secret Villain}.WS", "You cannot see"},
+		{2, "d100 vs @{Ada}", "expected '.'"},
+		{2, "d100 vs @", "expected a characteristic or skill"},
+		{2, "d100 vs @{Ada.WS", "missing '}'"},
+	}
+	for _, tt := range tests {
+		res := rollCommand{}.Execute(ctx, refEnv(tt.userID), tt.args)
+		if res.Success || !strings.Contains(res.Result, tt.wantErr) {
+			t.Errorf("/r %s by %d = %q, want error containing %q", tt.args, tt.userID, res.Result, tt.wantErr)
+		}
+	}
+
+	res := executeRollCommandWithRand("d100 vs @WS", NewRoomRNG().NextSeed().Rand())
+	if res.Success || !strings.Contains(res.Result, "needs a character sheet") {
+		t.Errorf("roll without sheets = %q, want an error", res.Result)
+	}
+}
+
+func TestVerifyRollWithSheetRefs(t *testing.T) {
+	ctx := context.Background()
+	body := "/r d100 vs @WS"
+
+	res := ParseAndExecuteCommand(ctx, refEnv(2), body)
+	if res == nil || !res.Success || res.Audit == nil {
+		t.Fatalf("roll failed: %+v", res)
+	}
+	data, err := json.Marshal(res.Roll)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The sheets are not consulted again: the recorded values are replayed
+	msg := models.Message{MessageBody: body, CommandResult: &res.Result, CommandData: data}
+	v, err := VerifyRoll(ctx, msg, *res.Audit, nil)
+	if err != nil || !v.Verified {
+		t.Fatalf("roll with references did not verify: %+v, %v", v, err)
+	}
+}
+
+func TestRollInitiative(t *testing.T) {
+	ctx := context.Background()
+	sheet := &models.CharacterSheetContent{}
+	if err := json.Unmarshal([]byte(`{"characteristics": {"A": {"value": "42"}}}`), sheet); err != nil {
+		t.Fatal(err)
+	}
+
+	res := RollInitiative(ctx, sheet, "d10+@AB", NewRoomRNG().NextSeed())
+	if !res.Success || res.Audit == nil {
+		t.Fatalf("initiative failed: %+v", res)
+	}
+	if total := res.Roll.Total; total < 1+4 || total > 10+4 {
+		t.Errorf("total = %d, want 5..14", total)
+	}
+
+	for _, tt := range []struct {
+		sheet      *models.CharacterSheetContent
+		expression string
+	}{
+		{nil, "d10+@AB"},
+		{sheet, "d10+@{Ada}.AB"},
+		{sheet, "d100 vs 40"},
+		{sheet, "2x(d10)"},
+		{sheet, ""},
+	} {
+		if res := RollInitiative(ctx, tt.sheet, tt.expression, NewRoomRNG().NextSeed()); res.Success {
+			t.Errorf("%q should not roll: %s", tt.expression, res.Result)
+		}
+	}
+}
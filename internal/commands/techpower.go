@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+// TechPowerProfile is everything about a tech power test that is settled
+// before the dice are rolled. It is stored with the result so the roll can
+// be replayed, and records the price that was paid for it.
+type TechPowerProfile struct {
+	Label   string              `json:"label"` // power name and the options picked in the roll dialog
+	Power   string              `json:"power"`
+	SheetID int                 `json:"sheetID"`
+	Path    string              `json:"path"` // the power on the sheet
+	Target  int                 `json:"target"`
+	Bonus   int                 `json:"bonus,omitempty"`
+	Price   models.ArcanaPoints `json:"price"`
+}
+
+// TechPowerResult is the outcome of a tech power test beyond its success.
+type TechPowerResult struct {
+	TechPowerProfile
+}
+
+// The sheet section that holds tech powers.
+const technoArcanaSection = "technoArcana"
+
+// TechPowerProfileFor builds the test of the tech power at path, e.g.
+// technoArcana.tabs.items.<tab>.powers.items.<id>, from the sheet content
+// and the power's roll dialog settings. The power's price must parse, but
+// whether the sheet can pay it is left to the caller.
+func TechPowerProfileFor(sheetID int, content json.RawMessage, path []string) (TechPowerProfile, error) {
+	if len(path) != 7 || path[0] != technoArcanaSection || path[1] != "tabs" || path[2] != "items" ||
+		path[4] != "powers" || path[5] != "items" {
+		return TechPowerProfile{}, fmt.Errorf("path %q is not a tech power", strings.Join(path, "."))
+	}
+
+	var sheet models.CharacterSheetContent
+	if err := json.Unmarshal(content, &sheet); err != nil {
+		return TechPowerProfile{}, fmt.Errorf("unmarshal sheet: %w", err)
+	}
+	var arcana struct {
+		TechnoArcana struct {
+			Tabs struct {
+				Items map[string]struct {
+					Powers struct {
+						Items map[string]json.RawMessage `json:"items"`
+					} `json:"powers"`
+				} `json:"items"`
+			} `json:"tabs"`
+		} `json:"technoArcana"`
+	}
+	if err := json.Unmarshal(content, &arcana); err != nil {
+		return TechPowerProfile{}, fmt.Errorf("unmarshal techno-arcana: %w", err)
+	}
+	raw, ok := arcana.TechnoArcana.Tabs.Items[path[3]].Powers.Items[path[6]]
+	if !ok {
+		return TechPowerProfile{}, errors.New("tech power not found")
+	}
+
+	// Decoded over a copy of the default dialog, like weapons
+	roll := models.DefaultTechPowerRoll
+	power := models.TechPower{Roll: &roll}
+	if err := json.Unmarshal(raw, &power); err != nil {
+		return TechPowerProfile{}, fmt.Errorf("unmarshal tech power: %w", err)
+	}
+	r := power.Roll
+
+	name := strings.TrimSpace(power.Name)
+	if name == "" {
+		name = "Unknown Power"
+	}
+	price, err := models.ParseTechPowerPrice(power.Price)
+	if err != nil {
+		return TechPowerProfile{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	// The label reads like the one the sheet used to build
+	parts := []string{name}
+	for _, e := range []models.RollExtra{r.Extra1, r.Extra2} {
+		if e.Enabled && e.Name != "" {
+			parts = append(parts, e.Name)
+		}
+	}
+
+	return TechPowerProfile{
+		Label:   strings.Join(parts, ", "),
+		Power:   name,
+		SheetID: sheetID,
+		Path:    strings.Join(path, "."),
+		Target:  sheet.RollValue(r.BaseSelect) + r.TestModifier(),
+		Bonus:   sheet.RollBonusSuccesses(r.BaseSelect),
+		Price:   price,
+	}, nil
+}
+
+// RollTechPower rolls the tech power test with dice drawn from seed.
+func RollTechPower(profile TechPowerProfile, seed Seed) CommandResult {
+	result := executeRoll(context.Background(), nil, versusExpression(profile.Target, profile.Bonus), seed.Rand())
+	if !result.Success {
+		return result
+	}
+	result.Roll.TechPower = &TechPowerResult{TechPowerProfile: profile}
+	result.Result = result.Roll.Text()
+	result.Audit = rollAudit(seed, result.Roll)
+	return result
+}
+
+// Text renders what the activation cost, e.g. "Spent 2 cognition, 1 energy".
+func (t *TechPowerResult) Text() string {
+	if t.Price.IsZero() {
+		return ""
+	}
+	var spent []string
+	if t.Price.Cognition > 0 {
+		spent = append(spent, fmt.Sprintf("%d cognition", t.Price.Cognition))
+	}
+	if t.Price.Energy > 0 {
+		spent = append(spent, fmt.Sprintf("%d energy", t.Price.Energy))
+	}
+	return "Spent " + strings.Join(spent, ", ")
+}
+
+// MessageBody is the chat message a tech power test is posted as.
+func (p TechPowerProfile) MessageBody() string {
+	return "/r " + versusExpression(p.Target, p.Bonus) + "\n>> " + p.Label
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+const techPowerTestSheet = `{
+	"characteristics": {"I": {"value": "40", "unnatural": "2"}},
+	"technoArcana": {
+		"currentCognition": 3, "currentEnergy": 2,
+		"tabs": {"items": {"t": {"powers": {"items": {
+			"spark": {"name": "Spark", "price": "2 cognition, 1 energy",
+				"roll": {"baseSelect": "I", "modifier": 10, "extra1": {"enabled": true, "name": "Haste", "value": -10}}},
+			"free": {"name": "Idle Hum", "roll": {"baseSelect": "I"}},
+			"vague": {"name": "Vague", "price": "3"}
+		}}}}}
+	}
+}`
+
+func TestTechPowerProfileFor(t *testing.T) {
+	path := strings.Split("technoArcana.tabs.items.t.powers.items.spark", ".")
+	got, err := TechPowerProfileFor(7, json.RawMessage(techPowerTestSheet), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := TechPowerProfile{
+		Label:   "Spark, Haste",
+		Power:   "Spark",
+		SheetID: 7,
+		Path:    "technoArcana.tabs.items.t.powers.items.spark",
+		Target:  40 + 10 - 10,
+		Bonus:   1,
+		Price:   models.ArcanaPoints{Cognition: 2, Energy: 1},
+	}
+	if got != want {
+		t.Errorf("profile = %+v, want %+v", got, want)
+	}
+
+	free, err := TechPowerProfileFor(7, json.RawMessage(techPowerTestSheet), strings.Split("technoArcana.tabs.items.t.powers.items.free", "."))
+	if err != nil || !free.Price.IsZero() {
+		t.Errorf("free power = %+v, %v", free, err)
+	}
+
+	for _, p := range []string{
+		"technoArcana.tabs.items.t.powers.items.vague",
+		"technoArcana.tabs.items.t.powers.items.missing",
+		"psykana.tabs.items.t.powers.items.spark",
+	} {
+		if _, err := TechPowerProfileFor(7, json.RawMessage(techPowerTestSheet), strings.Split(p, ".")); err == nil {
+			t.Errorf("%s: expected an error", p)
+		}
+	}
+}
+
+func TestVerifyTechPower(t *testing.T) {
+	profile := TechPowerProfile{Label: "Spark", Power: "Spark", Target: 40, Price: models.ArcanaPoints{Cognition: 2}}
+	res := RollTechPower(profile, NewRoomRNG().NextSeed())
+	if !res.Success || res.Audit == nil {
+		t.Fatalf("tech power failed: %+v", res)
+	}
+	if !strings.HasSuffix(res.Result, "\nSpent 2 cognition") {
+		t.Errorf("result = %q", res.Result)
+	}
+	data, err := json.Marshal(res.Roll)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := models.Message{MessageBody: profile.MessageBody(), CommandResult: &res.Result, CommandData: data}
+	v, err := VerifyRoll(context.Background(), msg, *res.Audit, nil)
+	if err != nil || !v.Verified {
+		t.Fatalf("tech power did not verify: %+v, %v", v, err)
+	}
+}
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"charactersheet.iociveteres.net/internal/gamedata"
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+// Verification is the outcome of replaying a stored roll from its audit trail.
+// It is an audit for the gamemaster: it shows the stored result follows from
+// the stored seed, not that the seed was fixed before the roll was made.
+type Verification struct {
+	Dice           []int  `json:"dice"`
+	ReplayedDice   []int  `json:"replayedDice"`
+	Result         string `json:"result"`
+	ReplayedResult string `json:"replayedResult"`
+	// Verified is set when the replay drew the same dice and produced the
+	// same result
+	Verified bool `json:"verified"`
+}
+
+// fixedSeed replays a single recorded seed.
+type fixedSeed Seed
+
+func (s fixedSeed) NextSeed() Seed { return Seed(s) }
+
+// VerifyRoll replays the body of msg with the recorded seed and compares the
+// outcome with what was stored. @references take the values recorded in the
+// message's command data, since the sheets may have changed since. Table
+// rolls, such as psychic phenomena, are looked up in catalog again.
+func VerifyRoll(ctx context.Context, msg models.Message, audit models.RollAudit, catalog *gamedata.Catalog) (*Verification, error) {
+	var seed Seed
+	if len(audit.Seed) != len(seed) {
+		return nil, errors.New("stored seed has the wrong length")
+	}
+	copy(seed[:], audit.Seed)
+
+	v := &Verification{
+		Dice: audit.Dice,
+	}
+	if msg.CommandResult != nil {
+		v.Result = *msg.CommandResult
+	}
+
+	var stored RollResult
+	if msg.CommandData != nil {
+		if err := json.Unmarshal(msg.CommandData, &stored); err != nil {
+			return nil, err
+		}
+	}
+
+	var replayed *CommandResult
+	switch {
+	case stored.Attack != nil:
+		// Attacks are rolled from a weapon, not typed: replay the stored profile
+		attack := RollAttack(stored.Attack.AttackProfile, seed)
+		replayed = &attack
+	case stored.Psychic != nil:
+		var tables *gamedata.PsychicTables
+		if catalog != nil {
+			tables = catalog.Psychic
+		}
+		psychic := RollPsychicTest(stored.Psychic.PsychicProfile, tables, seed)
+		replayed = &psychic
+	case stored.TechPower != nil:
+		techPower := RollTechPower(stored.TechPower.TechPowerProfile, seed)
+		replayed = &techPower
+	case stored.Damage != nil:
+		env := &Env{Refs: storedRefs(stored.Refs)}
+		damage := RollDamage(ctx, env, stored.Damage.DamageProfile, seed)
+		replayed = &damage
+	default:
+		env := &Env{Seeds: fixedSeed(seed), Refs: storedRefs(stored.Refs)}
+		replayed = registry.Execute(ctx, env, msg.MessageBody)
+	}
+	if replayed == nil || replayed.Audit == nil {
+		return nil, errors.New("message is not a roll")
+	}
+	v.ReplayedDice = replayed.Audit.Dice
+	v.ReplayedResult = replayed.Result
+
+	v.Verified = slices.Equal(v.Dice, v.ReplayedDice) && v.Result == v.ReplayedResult
+	return v, nil
+}
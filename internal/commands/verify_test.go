@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+func TestSeededRollIsReproducible(t *testing.T) {
+	seed := NewRoomRNG().NextSeed()
+
+	first := executeSeededRoll(context.Background(), nil, "4d6r1k3 + d10!", seed)
+	second := executeSeededRoll(context.Background(), nil, "4d6r1k3 + d10!", seed)
+	if !first.Success || first.Result != second.Result || !slices.Equal(first.Audit.Dice, second.Audit.Dice) {
+		t.Fatalf("same seed gave different rolls: %q vs %q", first.Result, second.Result)
+	}
+	if string(first.Audit.Seed) != string(seed[:]) || len(first.Audit.Dice) < 5 {
+		t.Errorf("audit = %+v, want the seed and at least 5 dice", first.Audit)
+	}
+}
+
+func TestRoomRNGSeedsDiffer(t *testing.T) {
+	rng := NewRoomRNG()
+	if rng.NextSeed() == rng.NextSeed() {
+		t.Error("consecutive seeds are equal")
+	}
+}
+
+func TestVerifyRoll(t *testing.T) {
+	ctx := context.Background()
+	body := "/gr 3x(d100 vs 40)"
+
+	res := ParseAndExecuteCommand(ctx, &Env{Seeds: NewRoomRNG()}, body)
+	if res == nil || res.Audit == nil {
+		t.Fatalf("roll has no audit trail: %+v", res)
+	}
+
+	msg := models.Message{MessageBody: body, CommandResult: &res.Result}
+	v, err := VerifyRoll(ctx, msg, *res.Audit, nil)
+	if err != nil || !v.Verified {
+		t.Fatalf("genuine roll did not verify: %+v, %v", v, err)
+	}
+
+	forged := "3x(d100 vs 40): 1 success"
+	v, err = VerifyRoll(ctx, models.Message{MessageBody: body, CommandResult: &forged}, *res.Audit, nil)
+	if err != nil || v.Verified {
+		t.Errorf("forged result verified: %+v, %v", v, err)
+	}
+
+	tampered := *res.Audit
+	tampered.Dice = append([]int{1}, tampered.Dice[1:]...)
+	if v, _ := VerifyRoll(ctx, msg, tampered, nil); v.Verified && res.Audit.Dice[0] != 1 {
+		t.Errorf("tampered dice verified: %+v", v)
+	}
+
+	if _, err := VerifyRoll(ctx, models.Message{MessageBody: "just chatting"}, *res.Audit, nil); err == nil {
+		t.Error("a plain message should not verify")
+	}
+}
@@ -0,0 +1,171 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+// whisperCommand is /w: a message only the sender and one room member see.
+type whisperCommand struct{}
+
+func (whisperCommand) Name() string      { return "w" }
+func (whisperCommand) Aliases() []string { return []string{"whisper"} }
+
+func (whisperCommand) Help() Help {
+	return Help{
+		Description: "whisper to a player",
+		DetailedDescription: `/w Alice meet me at the docks
+Names are matched case-insensitively and may contain spaces:
+/w Brother Marcus hold the line
+
+Only you and the recipient see the message`,
+	}
+}
+
+func (whisperCommand) Execute(ctx context.Context, env *Env, args string) CommandResult {
+	members, err := roomMembers(ctx, env)
+	if err != nil {
+		return whisperError(err.Error())
+	}
+
+	target, text, err := matchRecipient(members, args)
+	if err != nil {
+		return whisperError(err.Error())
+	}
+	if target.UserID == env.UserID {
+		return whisperError("You cannot whisper to yourself")
+	}
+	if text == "" {
+		return whisperError("Usage: /w <name> <message>")
+	}
+
+	return CommandResult{
+		Success:    true,
+		Result:     text,
+		Recipients: []int{target.UserID},
+	}
+}
+
+// gmCommand is /gm: a message only the sender and the room's gamemasters see.
+type gmCommand struct{}
+
+func (gmCommand) Name() string      { return "gm" }
+func (gmCommand) Aliases() []string { return nil }
+
+func (gmCommand) Help() Help {
+	return Help{
+		Description: "whisper to the gamemaster",
+		DetailedDescription: `/gm I pocket the data-slate when nobody is looking
+
+Only you and the gamemasters of the room see the message`,
+	}
+}
+
+func (gmCommand) Execute(ctx context.Context, env *Env, args string) CommandResult {
+	text := strings.TrimSpace(args)
+	if text == "" {
+		return whisperError("Usage: /gm <message>")
+	}
+
+	members, err := roomMembers(ctx, env)
+	if err != nil {
+		return whisperError(err.Error())
+	}
+
+	var recipients []int
+	for _, m := range members {
+		if m.Role == models.RoleGamemaster && m.UserID != env.UserID {
+			recipients = append(recipients, m.UserID)
+		}
+	}
+	if len(recipients) == 0 {
+		return whisperError("There is no other gamemaster in this room")
+	}
+
+	return CommandResult{
+		Success:    true,
+		Result:     text,
+		Recipients: recipients,
+	}
+}
+
+func roomMembers(ctx context.Context, env *Env) ([]*models.NamedRoomMember, error) {
+	if env == nil || env.Models == nil || env.Models.RoomMembers == nil {
+		return nil, errors.New("Whispers are not available here")
+	}
+	members, err := env.Models.RoomMembers.ListWithNames(ctx, env.RoomID)
+	if err != nil {
+		return nil, errors.New("Could not load room members")
+	}
+	return members, nil
+}
+
+// matchRecipient splits "<name> <text>" into the member whose name is the
+// longest case-insensitive prefix of args and the remaining text. The name
+// must be followed by whitespace or the end of args. Names are compared
+// rune by rune, since a case variant may take more or fewer bytes than the
+// stored name.
+func matchRecipient(members []*models.NamedRoomMember, args string) (*models.NamedRoomMember, string, error) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return nil, "", errors.New("Usage: /w <name> <message>")
+	}
+
+	var best []*models.NamedRoomMember
+	bestLen := 0
+	for _, m := range members {
+		name := strings.TrimSpace(m.UserName)
+		n, ok := foldPrefix(args, name)
+		if name == "" || !ok {
+			continue
+		}
+		if next, _ := utf8.DecodeRuneInString(args[n:]); n < len(args) && !unicode.IsSpace(next) {
+			continue
+		}
+		switch {
+		case n > bestLen:
+			best, bestLen = []*models.NamedRoomMember{m}, n
+		case n == bestLen:
+			best = append(best, m)
+		}
+	}
+
+	switch len(best) {
+	case 0:
+		return nil, "", errors.New("No player named " + strings.Fields(args)[0] + " in this room")
+	case 1:
+		return best[0], strings.TrimSpace(args[bestLen:]), nil
+	default:
+		return nil, "", errors.New("Several players are called " + args[:bestLen])
+	}
+}
+
+// foldPrefix reports whether s starts with prefix under Unicode case
+// folding and, if it does, how many bytes of s the prefix covers.
+func foldPrefix(s, prefix string) (int, bool) {
+	i := 0
+	for _, pr := range prefix {
+		if i >= len(s) {
+			return 0, false
+		}
+		sr, size := utf8.DecodeRuneInString(s[i:])
+		if !strings.EqualFold(string(sr), string(pr)) {
+			return 0, false
+		}
+		i += size
+	}
+	return i, true
+}
+
+func whisperError(msg string) CommandResult {
+	return CommandResult{
+		Success: false,
+		Result:  msg,
+		Private: true,
+	}
+}
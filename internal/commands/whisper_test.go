@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+type fakeRoomMembers struct {
+	models.RoomMembersInterface
+	members []*models.NamedRoomMember
+}
+
+func (f fakeRoomMembers) ListWithNames(ctx context.Context, roomID int) ([]*models.NamedRoomMember, error) {
+	return f.members, nil
+}
+
+func whisperEnv(userID int) *Env {
+	member := func(id int, name string, role models.RoomRole) *models.NamedRoomMember {
+		return &models.NamedRoomMember{RoomMember: models.RoomMember{UserID: id, Role: role}, UserName: name}
+	}
+	return &Env{
+		UserID: userID,
+		RoomID: 1,
+		Models: &models.Models{RoomMembers: fakeRoomMembers{members: []*models.NamedRoomMember{
+			member(1, "Game Master", models.RoleGamemaster),
+			member(2, "Brother", models.RolePlayer),
+			member(3, "Brother Marcus", models.RolePlayer),
+			member(4, "Ada", models.RolePlayer),
+			member(5, "Sam", models.RolePlayer),
+		}}},
+	}
+}
+
+func TestWhisperCommand(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		args           string
+		wantRecipients []int
+		wantResult     string
+	}{
+		{"ada hello there", []int{4}, "hello there"},
+		{"Brother Marcus hold the line", []int{3}, "hold the line"},
+		{"Brother hold the line", []int{2}, "hold the line"},
+		{"Game Master  psst", []int{1}, "psst"},
+		{"ſam over here", []int{5}, "over here"},
+		{"SAM\u00a0over here", []int{5}, "over here"},
+	}
+
+	for _, tt := range tests {
+		res := whisperCommand{}.Execute(ctx, whisperEnv(4), tt.args)
+		if tt.wantRecipients[0] == 4 {
+			// whispering to yourself is rejected
+			if res.Success || !res.Private {
+				t.Errorf("/w %s = %+v, want private error", tt.args, res)
+			}
+			continue
+		}
+		if !res.Success || res.Result != tt.wantResult || !reflect.DeepEqual(res.Recipients, tt.wantRecipients) {
+			t.Errorf("/w %s = %+v, want %v %q", tt.args, res, tt.wantRecipients, tt.wantResult)
+		}
+	}
+
+	for _, args := range []string{"", "Nobody hi", "Ada", "Adam hi", "Sa\xc5 hi"} {
+		res := whisperCommand{}.Execute(ctx, whisperEnv(1), args)
+		if res.Success || !res.Private || res.Recipients != nil {
+			t.Errorf("/w %q = %+v, want private error", args, res)
+		}
+	}
+}
+
+func TestGMCommand(t *testing.T) {
+	ctx := context.Background()
+
+	res := gmCommand{}.Execute(ctx, whisperEnv(2), "I pocket the slate")
+	if !res.Success || res.Result != "I pocket the slate" || !reflect.DeepEqual(res.Recipients, []int{1}) {
+		t.Errorf("/gm = %+v, want whisper to the gamemaster", res)
+	}
+
+	res = gmCommand{}.Execute(ctx, whisperEnv(1), "note to self")
+	if res.Success || !res.Private {
+		t.Errorf("/gm from the only gamemaster = %+v, want private error", res)
+	}
+
+	res = gmCommand{}.Execute(ctx, whisperEnv(2), "  ")
+	if res.Success || !res.Private {
+		t.Errorf("empty /gm = %+v, want usage error", res)
+	}
+}
@@ -9,6 +9,7 @@ import (
 // Catalog holds all loaded game data collections.
 type Catalog struct {
 	Advancements *AdvancementIndex
+	Psychic      *PsychicTables
 }
 
 func Load() (*Catalog, error) {
@@ -26,6 +27,18 @@ func Load() (*Catalog, error) {
 		c.Advancements = idx
 	}
 
+	raw, err := os.ReadFile(psychicPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("psychic tables: %w", err)
+	}
+	if raw != nil {
+		tables, err := newPsychicTables(raw)
+		if err != nil {
+			return nil, fmt.Errorf("psychic tables: %w", err)
+		}
+		c.Psychic = tables
+	}
+
 	return c, nil
 }
 
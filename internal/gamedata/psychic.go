@@ -0,0 +1,77 @@
+package gamedata
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const psychicPath = "internal/gamedata/assets/psychic.json"
+
+// TableEntry is one row of a d100 table, covering rolls Min to Max.
+type TableEntry struct {
+	Min    int    `json:"min"`
+	Max    int    `json:"max"`
+	Name   string `json:"name"`
+	Effect string `json:"effect"`
+	// Perils sends the psyker on to the Perils of the Warp table
+	Perils bool `json:"perils,omitempty"`
+}
+
+// PsychicTables are the tables rolled on when a psychic power goes wrong.
+type PsychicTables struct {
+	// PushModifier is added to the phenomena roll for every point of
+	// power rating pushed beyond the psyker's limit
+	PushModifier int          `json:"pushModifier"`
+	Phenomena    []TableEntry `json:"phenomena"`
+	Perils       []TableEntry `json:"perils"`
+}
+
+// newPsychicTables decodes the tables and checks that each one covers 1 to
+// 100 without gaps, so every roll finds a row.
+func newPsychicTables(raw json.RawMessage) (*PsychicTables, error) {
+	var t PsychicTables
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, err
+	}
+	if err := checkTable(t.Phenomena); err != nil {
+		return nil, fmt.Errorf("phenomena: %w", err)
+	}
+	if err := checkTable(t.Perils); err != nil {
+		return nil, fmt.Errorf("perils: %w", err)
+	}
+	return &t, nil
+}
+
+func checkTable(rows []TableEntry) error {
+	next := 1
+	for _, row := range rows {
+		if row.Min != next || row.Max < row.Min {
+			return fmt.Errorf("row %q covers %d-%d, want it to start at %d", row.Name, row.Min, row.Max, next)
+		}
+		next = row.Max + 1
+	}
+	if next != 101 {
+		return fmt.Errorf("rows end at %d, want 100", next-1)
+	}
+	return nil
+}
+
+// Phenomenon looks up a psychic phenomena roll. Rolls pushed past 100 take
+// the last row.
+func (t *PsychicTables) Phenomenon(roll int) TableEntry {
+	return lookup(t.Phenomena, roll)
+}
+
+// Peril looks up a Perils of the Warp roll.
+func (t *PsychicTables) Peril(roll int) TableEntry {
+	return lookup(t.Perils, roll)
+}
+
+func lookup(rows []TableEntry, roll int) TableEntry {
+	for _, row := range rows {
+		if roll <= row.Max {
+			return row
+		}
+	}
+	return rows[len(rows)-1]
+}
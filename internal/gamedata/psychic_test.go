@@ -0,0 +1,39 @@
+package gamedata
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPsychicTablesAsset(t *testing.T) {
+	raw, err := os.ReadFile("assets/psychic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, err := newPsychicTables(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tables.Phenomenon(74); got.Perils {
+		t.Errorf("phenomenon 74 = %q, want no perils", got.Name)
+	}
+	if got := tables.Phenomenon(130); !got.Perils {
+		t.Errorf("phenomenon 130 = %q, want perils", got.Name)
+	}
+	if got := tables.Peril(100); got.Name != "Annihilation" {
+		t.Errorf("peril 100 = %q, want Annihilation", got.Name)
+	}
+}
+
+func TestPsychicTablesGaps(t *testing.T) {
+	tests := []string{
+		`{"phenomena": [{"min": 1, "max": 50}, {"min": 52, "max": 100}], "perils": [{"min": 1, "max": 100}]}`,
+		`{"phenomena": [{"min": 1, "max": 100}], "perils": [{"min": 1, "max": 99}]}`,
+		`{"phenomena": [{"min": 2, "max": 100}], "perils": [{"min": 1, "max": 100}]}`,
+	}
+	for _, raw := range tests {
+		if _, err := newPsychicTables([]byte(raw)); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
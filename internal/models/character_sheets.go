@@ -22,11 +22,28 @@ type CharacterSheetModelInterface interface {
 
 	// JSON
 	CreateItem(ctx context.Context, userID, sheetID int, path []string, itemID string, pos json.RawMessage, init json.RawMessage) (int, error)
-	ChangeField(ctx context.Context, userID, sheetID int, path []string, newValueJSON []byte) (int, error)
-	ApplyBatch(ctx context.Context, userID, sheetID int, path []string, changes []byte) (int, error)
-	DeleteItem(ctx context.Context, userID, sheetID int, path []string) (int, error)
-	ReplacePositions(ctx context.Context, userID, sheetID int, path []string, positions map[string]Position) (int, error)
+	ChangeField(ctx context.Context, userID, sheetID, baseVersion int, path []string, newValueJSON []byte) (int, error)
+	ApplyBatch(ctx context.Context, userID, sheetID, baseVersion int, path []string, changes []byte) (int, error)
+	DeleteItem(ctx context.Context, userID, sheetID, baseVersion int, path []string) (int, error)
+	ReplacePositions(ctx context.Context, userID, sheetID, baseVersion int, path []string, positions map[string]Position) (int, error)
 	MoveItemBetweenGrids(ctx context.Context, userID, sheetID int, fromPath, toPath []string, itemID string, toPos json.RawMessage) (int, error)
+	SpendArcana(ctx context.Context, userID, sheetID int, cost ArcanaPoints) (ArcanaPoints, int, error)
+	AddWounds(ctx context.Context, userID, sheetID, wounds int) (int, int, error)
+
+	// History
+	History(ctx context.Context, userID, sheetID int, filter SheetHistoryFilter) (*SheetHistory, error)
+	RestoreField(ctx context.Context, userID, sheetID, version int, path []string) (int, error)
+	RestoreItem(ctx context.Context, userID, sheetID, version int, itemPath []string) (int, error)
+	RestoreSheet(ctx context.Context, userID, sheetID, version int) (int, error)
+	ContentAt(ctx context.Context, userID, sheetID, version int) (json.RawMessage, int, error)
+	Undo(ctx context.Context, userID, sheetID int) (*SheetEdit, error)
+	Redo(ctx context.Context, userID, sheetID int) (*SheetEdit, error)
+
+	// Snapshots
+	CreateSnapshot(ctx context.Context, userID, sheetID int, label string) (int, error)
+	ListSnapshots(ctx context.Context, userID, sheetID int) ([]*SheetSnapshot, error)
+	GetSnapshot(ctx context.Context, userID, sheetID, snapshotID int) (*SheetSnapshot, error)
+	RestoreSnapshot(ctx context.Context, userID, sheetID, snapshotID int) (int, error)
 
 	// DTO
 	SummaryByUser(ctx context.Context, ownerID int) ([]*CharacterSheetSummary, error)
@@ -91,6 +108,7 @@ type CharacterSheet struct {
 	Content       json.RawMessage
 	Visibility    SheetVisibility
 	FolderID      *int
+	Version       int
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
@@ -157,6 +175,7 @@ func (m *CharacterSheetModel) Get(ctx context.Context, id int) (*CharacterSheet,
 		content,
 		sheet_visibility,
 		folder_id,
+		version,
 		created_at, 
 		updated_at
 	FROM character_sheets
@@ -173,6 +192,7 @@ func (m *CharacterSheetModel) Get(ctx context.Context, id int) (*CharacterSheet,
 		&s.Content,
 		&s.Visibility,
 		&s.FolderID,
+		&s.Version,
 		&s.CreatedAt,
 		&s.UpdatedAt,
 	)
@@ -369,8 +389,10 @@ func (m *CharacterSheetModel) GetWithPermission(ctx context.Context, userID, she
         SELECT 
             cs.id,
             cs.owner_id,
+            cs.room_id,
             cs.content->'characterInfo'->>'characterName' AS character_name,
             cs.content,
+            cs.version,
             cs.created_at,
             cs.updated_at,
             cs.sheet_visibility,
@@ -389,8 +411,10 @@ func (m *CharacterSheetModel) GetWithPermission(ctx context.Context, userID, she
 	err := row.Scan(
 		&s.ID,
 		&s.OwnerID,
+		&s.RoomID,
 		&s.CharacterName,
 		&s.Content,
+		&s.Version,
 		&s.CreatedAt,
 		&s.UpdatedAt,
 		&s.Visibility,
@@ -477,6 +477,13 @@ func (m *CharacterSheetModel) CreateItem(ctx context.Context, userID, sheetID in
 	}
 	// ["customSkills", "layouts", "skill1"]
 
+	return m.checkedWrite(ctx, userID, sheetID, 0, [][]string{itemPath, layoutPath}, func(tx pgx.Tx) (int, error) {
+		return createItem(ctx, tx, userID, sheetID, itemPath, layoutPath, pos, init)
+	})
+}
+
+// createItem is the write CreateItem makes, for use inside a checked write.
+func createItem(ctx context.Context, tx pgx.Tx, userID, sheetID int, itemPath, layoutPath []string, pos, init json.RawMessage) (int, error) {
 	// Always do two jsonb_set operations (create item + set position)
 	const q = `
         UPDATE character_sheets
@@ -492,9 +499,8 @@ func (m *CharacterSheetModel) CreateItem(ctx context.Context, userID, sheetID in
         WHERE id = $6 AND can_edit_character_sheet($5, $6)
         RETURNING version
     `
-
 	var version int
-	err = m.DB.QueryRow(ctx, q, itemPath, init, layoutPath, pos, userID, sheetID).Scan(&version)
+	err := tx.QueryRow(ctx, q, itemPath, init, layoutPath, pos, userID, sheetID).Scan(&version)
 
 	if err == pgx.ErrNoRows {
 		return 0, ErrPermissionDenied
@@ -505,8 +511,17 @@ func (m *CharacterSheetModel) CreateItem(ctx context.Context, userID, sheetID in
 	return version, nil
 }
 
-// Set a scalar value at the exact JSON path
-func (m *CharacterSheetModel) ChangeField(ctx context.Context, userID, sheetID int, path []string, newValueJSON []byte) (int, error) {
+// ChangeField sets a scalar value at the exact JSON path. With a
+// baseVersion the write is rejected with a *ConflictError when path changed
+// after it.
+func (m *CharacterSheetModel) ChangeField(ctx context.Context, userID, sheetID, baseVersion int, path []string, newValueJSON []byte) (int, error) {
+	return m.checkedWrite(ctx, userID, sheetID, baseVersion, [][]string{path}, func(tx pgx.Tx) (int, error) {
+		return changeField(ctx, tx, userID, sheetID, path, newValueJSON)
+	})
+}
+
+// changeField is the write ChangeField makes, for use inside a checked write.
+func changeField(ctx context.Context, tx pgx.Tx, userID, sheetID int, path []string, newValueJSON []byte) (int, error) {
 	// Example path: []string{"characteristics","WS","value"}
 	// Use jsonb_ensure_path to create all parent objects if they don't exist
 	const stmt = `
@@ -524,7 +539,7 @@ func (m *CharacterSheetModel) ChangeField(ctx context.Context, userID, sheetID i
         RETURNING version
     `
 	var version int
-	err := m.DB.QueryRow(ctx, stmt, path, newValueJSON, sheetID, userID).Scan(&version)
+	err := tx.QueryRow(ctx, stmt, path, newValueJSON, sheetID, userID).Scan(&version)
 
 	if err == pgx.ErrNoRows {
 		return 0, ErrPermissionDenied
@@ -535,8 +550,10 @@ func (m *CharacterSheetModel) ChangeField(ctx context.Context, userID, sheetID i
 	return version, nil
 }
 
-// Merge a partial object into content at the given JSON path
-func (m *CharacterSheetModel) ApplyBatch(ctx context.Context, userID, sheetID int, path []string, changes []byte) (int, error) {
+// Merge a partial object into content at the given JSON path. With a
+// baseVersion the merge is rejected with a *ConflictError when any of the
+// merged fields changed after it.
+func (m *CharacterSheetModel) ApplyBatch(ctx context.Context, userID, sheetID, baseVersion int, path []string, changes []byte) (int, error) {
 	// Merge semantics: ensure path exists, then merge changes into it
 	// coalesce(content #> path, '{}'::jsonb) || $2::jsonb
 	const stmt = `
@@ -553,20 +570,33 @@ func (m *CharacterSheetModel) ApplyBatch(ctx context.Context, userID, sheetID in
           AND can_edit_character_sheet($4, $3)
         RETURNING version
     `
-	var version int
-	err := m.DB.QueryRow(ctx, stmt, path, changes, sheetID, userID).Scan(&version)
 
-	if err == pgx.ErrNoRows {
-		return 0, ErrPermissionDenied
-	}
-	if err != nil {
-		return 0, err
+	// Only the merged fields are written, not the whole object at path
+	paths := [][]string{path}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(changes, &fields); err == nil && len(fields) > 0 {
+		paths = paths[:0]
+		for key := range fields {
+			paths = append(paths, append(append([]string(nil), path...), key))
+		}
 	}
-	return version, nil
+
+	return m.checkedWrite(ctx, userID, sheetID, baseVersion, paths, func(tx pgx.Tx) (int, error) {
+		var version int
+		err := tx.QueryRow(ctx, stmt, path, changes, sheetID, userID).Scan(&version)
+
+		if err == pgx.ErrNoRows {
+			return 0, ErrPermissionDenied
+		}
+		if err != nil {
+			return 0, err
+		}
+		return version, nil
+	})
 }
 
 // Update Layout position for an item (layouts.<grid>.positions.<item>)
-func (m *CharacterSheetModel) ReplacePositions(ctx context.Context, userID, sheetID int, path []string, positions map[string]Position) (int, error) {
+func (m *CharacterSheetModel) ReplacePositions(ctx context.Context, userID, sheetID, baseVersion int, path []string, positions map[string]Position) (int, error) {
 	// path is now ["customSkills", "layouts"] - already complete
 
 	layoutPath, err := replaceLastSegment(path, "items", "layouts")
@@ -598,16 +628,18 @@ func (m *CharacterSheetModel) ReplacePositions(ctx context.Context, userID, shee
         RETURNING version
     `
 
-	var version int
-	err = m.DB.QueryRow(ctx, stmt, layoutPath, string(valB), sheetID, userID).Scan(&version)
+	return m.checkedWrite(ctx, userID, sheetID, baseVersion, [][]string{layoutPath}, func(tx pgx.Tx) (int, error) {
+		var version int
+		err := tx.QueryRow(ctx, stmt, layoutPath, string(valB), sheetID, userID).Scan(&version)
 
-	if err == pgx.ErrNoRows {
-		return 0, ErrPermissionDenied
-	}
-	if err != nil {
-		return 0, err
-	}
-	return version, nil
+		if err == pgx.ErrNoRows {
+			return 0, ErrPermissionDenied
+		}
+		if err != nil {
+			return 0, err
+		}
+		return version, nil
+	})
 }
 
 func (m *CharacterSheetModel) MoveItemBetweenGrids(
@@ -643,6 +675,7 @@ func (m *CharacterSheetModel) MoveItemBetweenGrids(
 		SELECT content #> $1::text[]
 		FROM character_sheets
 		WHERE id = $2 AND can_edit_character_sheet($3, $2)
+		FOR UPDATE
 	`
 	var itemContent json.RawMessage
 	err = tx.QueryRow(ctx, getItemStmt, fromItemPath, sheetID, userID).Scan(&itemContent)
@@ -653,6 +686,12 @@ func (m *CharacterSheetModel) MoveItemBetweenGrids(
 		return 0, fmt.Errorf("get item content: %w", err)
 	}
 
+	paths := [][]string{fromItemPath, fromLayoutPath, toItemPath, toLayoutPath}
+	changes, err := captureChanges(ctx, tx, sheetID, paths)
+	if err != nil {
+		return 0, err
+	}
+
 	// Delete from source (both item and layout)
 	const deleteStmt = `
 		UPDATE character_sheets
@@ -695,6 +734,13 @@ func (m *CharacterSheetModel) MoveItemBetweenGrids(
 		return 0, fmt.Errorf("create in destination: %w", err)
 	}
 
+	if err := changes.log(ctx, tx, userID, finalVersion); err != nil {
+		return 0, err
+	}
+	if err := recordPathVersions(ctx, tx, userID, sheetID, finalVersion, nil, paths); err != nil {
+		return 0, err
+	}
+
 	// Commit transaction
 	if err := tx.Commit(ctx); err != nil {
 		return 0, fmt.Errorf("commit transaction: %w", err)
@@ -704,7 +750,7 @@ func (m *CharacterSheetModel) MoveItemBetweenGrids(
 }
 
 // Delete item at JSON path
-func (m *CharacterSheetModel) DeleteItem(ctx context.Context, userID, sheetID int, path []string) (int, error) {
+func (m *CharacterSheetModel) DeleteItem(ctx context.Context, userID, sheetID, baseVersion int, path []string) (int, error) {
 	itemPath := append([]string(nil), path...)
 
 	layoutPath, err := replaceLastSegment(itemPath, "items", "layouts")
@@ -713,17 +759,24 @@ func (m *CharacterSheetModel) DeleteItem(ctx context.Context, userID, sheetID in
 	}
 	// layoutPath is now ["customSkills", "layouts", "skill1"]
 
+	return m.checkedWrite(ctx, userID, sheetID, baseVersion, [][]string{itemPath, layoutPath}, func(tx pgx.Tx) (int, error) {
+		return deleteItem(ctx, tx, userID, sheetID, itemPath, layoutPath)
+	})
+}
+
+// deleteItem is the write DeleteItem makes, for use inside a checked write.
+// It removes any path, not just items, when layoutPath is nil.
+func deleteItem(ctx context.Context, tx pgx.Tx, userID, sheetID int, itemPath, layoutPath []string) (int, error) {
 	const query = `
         UPDATE character_sheets
-        SET content = (content #- $1::text[]) #- $2::text[],
+        SET content = (content #- $1::text[]) #- coalesce($2::text[], '{}'),
             version = version + 1,
             updated_at = now()
         WHERE id = $3 AND can_edit_character_sheet($4, $3)
         RETURNING version
     `
-
 	var version int
-	err = m.DB.QueryRow(ctx, query, itemPath, layoutPath, sheetID, userID).Scan(&version)
+	err := tx.QueryRow(ctx, query, itemPath, layoutPath, sheetID, userID).Scan(&version)
 
 	if err == pgx.ErrNoRows {
 		return 0, ErrPermissionDenied
@@ -733,3 +786,115 @@ func (m *CharacterSheetModel) DeleteItem(ctx context.Context, userID, sheetID in
 	}
 	return version, nil
 }
+
+// AddWounds adds wounds to the wounds the sheet's character has taken,
+// returning the new total and version. The sum is taken in the database
+// under the sheet's lock, so damage applied at the same time as another
+// write to the wounds cannot lose either.
+func (m *CharacterSheetModel) AddWounds(ctx context.Context, userID, sheetID, wounds int) (int, int, error) {
+	// A missing or non-numeric value counts as no wounds taken
+	const stmt = `
+		UPDATE character_sheets
+		SET content = jsonb_set(
+				jsonb_ensure_path(content, '{armour,woundsCur}'::text[]),
+				'{armour,woundsCur}',
+				to_jsonb(
+					CASE WHEN content #>> '{armour,woundsCur}' ~ '^-?[0-9]+(\.[0-9]+)?$'
+						THEN (content #>> '{armour,woundsCur}')::numeric::int
+						ELSE 0
+					END + $1::int
+				),
+				true
+			),
+			version = version + 1,
+			updated_at = now()
+		WHERE id = $2
+		RETURNING version, (content #>> '{armour,woundsCur}')::int
+	`
+	path := []string{"armour", "woundsCur"}
+	var total int
+	version, err := m.checkedWrite(ctx, userID, sheetID, 0, [][]string{path}, func(tx pgx.Tx) (int, error) {
+		var version int
+		if err := tx.QueryRow(ctx, stmt, wounds, sheetID).Scan(&version, &total); err != nil {
+			return 0, fmt.Errorf("add wounds: %w", err)
+		}
+		return version, nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return total, version, nil
+}
+
+// SpendArcana takes cost from the sheet's current cognition and energy in
+// one step, returning what is left and the new version. The sheet is left
+// untouched with ErrInsufficientArcana when it cannot pay.
+func (m *CharacterSheetModel) SpendArcana(ctx context.Context, userID, sheetID int, cost ArcanaPoints) (ArcanaPoints, int, error) {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return ArcanaPoints{}, 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the row so concurrent activations cannot both spend the same points
+	const getStmt = `
+		SELECT coalesce(content->'technoArcana', '{}'::jsonb)
+		FROM character_sheets
+		WHERE id = $1 AND can_edit_character_sheet($2, $1)
+		FOR UPDATE
+	`
+	var raw json.RawMessage
+	err = tx.QueryRow(ctx, getStmt, sheetID, userID).Scan(&raw)
+	if err == pgx.ErrNoRows {
+		return ArcanaPoints{}, 0, ErrPermissionDenied
+	}
+	if err != nil {
+		return ArcanaPoints{}, 0, fmt.Errorf("get techno-arcana: %w", err)
+	}
+
+	var arcana TechnoArcana
+	if err := json.Unmarshal(raw, &arcana); err != nil {
+		return ArcanaPoints{}, 0, fmt.Errorf("unmarshal techno-arcana: %w", err)
+	}
+	current := ArcanaPoints{Cognition: arcana.CurrentCognition, Energy: arcana.CurrentEnergy}
+	left, ok := current.Spend(cost)
+	if !ok {
+		return current, 0, ErrInsufficientArcana
+	}
+
+	paths := [][]string{{"technoArcana", "currentCognition"}, {"technoArcana", "currentEnergy"}}
+	changes, err := captureChanges(ctx, tx, sheetID, paths)
+	if err != nil {
+		return ArcanaPoints{}, 0, err
+	}
+
+	const updateStmt = `
+		UPDATE character_sheets
+		SET content = jsonb_set(
+				jsonb_set(
+					jsonb_ensure_path(content, '{technoArcana,currentCognition}'::text[]),
+					'{technoArcana,currentCognition}', to_jsonb($1::int), true
+				),
+				'{technoArcana,currentEnergy}', to_jsonb($2::int), true
+			),
+			version = version + 1,
+			updated_at = now()
+		WHERE id = $3
+		RETURNING version
+	`
+	var version int
+	if err := tx.QueryRow(ctx, updateStmt, left.Cognition, left.Energy, sheetID).Scan(&version); err != nil {
+		return ArcanaPoints{}, 0, fmt.Errorf("spend techno-arcana: %w", err)
+	}
+	if err := changes.log(ctx, tx, userID, version); err != nil {
+		return ArcanaPoints{}, 0, err
+	}
+	if err := recordPathVersions(ctx, tx, userID, sheetID, version, nil, paths); err != nil {
+		return ArcanaPoints{}, 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return ArcanaPoints{}, 0, fmt.Errorf("commit transaction: %w", err)
+	}
+	return left, version, nil
+}
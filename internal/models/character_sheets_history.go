@@ -0,0 +1,571 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SheetChange is one entry of a sheet's change log: the value at Path
+// before and after the write that made Version. A nil OldValue means the
+// path did not exist before; a nil NewValue that the write removed it.
+type SheetChange struct {
+	ID        int64
+	SheetID   int
+	UserID    int
+	UserName  string
+	Version   int
+	Path      []string
+	OldValue  json.RawMessage
+	NewValue  json.RawMessage
+	Action    string // "edit", "undo" or "redo"
+	CreatedAt time.Time
+}
+
+// Section is the top-level part of the sheet the change was made in, e.g.
+// "characteristics" or "gear".
+func (c *SheetChange) Section() string {
+	if len(c.Path) == 0 {
+		return ""
+	}
+	return c.Path[0]
+}
+
+// PathString is the path as the client writes it, e.g. "gear.items.abc".
+func (c *SheetChange) PathString() string {
+	return pathKey(c.Path)
+}
+
+// VersionBefore is the version the sheet was at just before the change.
+func (c *SheetChange) VersionBefore() int {
+	return c.Version - 1
+}
+
+// SheetHistoryFilter narrows a sheet's history. Zero values match
+// everything.
+type SheetHistoryFilter struct {
+	Section string
+	UserID  int
+	Limit   int
+}
+
+// SheetHistoryUser is someone who has changed a sheet.
+type SheetHistoryUser struct {
+	ID   int
+	Name string
+}
+
+// SheetHistory is a page of a sheet's change log, newest first, along with
+// the sections and users the whole log can be filtered by.
+type SheetHistory struct {
+	Changes  []*SheetChange
+	Sections []string
+	Users    []SheetHistoryUser
+}
+
+const defaultHistoryLimit = 200
+
+// History returns the sheet's change log as filter narrows it, to anyone who
+// can view the sheet.
+func (m *CharacterSheetModel) History(ctx context.Context, userID, sheetID int, filter SheetHistoryFilter) (*SheetHistory, error) {
+	var canView bool
+	err := m.DB.QueryRow(ctx, `SELECT can_view_character_sheet($1, $2)`, userID, sheetID).Scan(&canView)
+	if err != nil {
+		return nil, err
+	}
+	if !canView {
+		return nil, ErrPermissionDenied
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	const stmt = `
+		SELECT c.id, c.sheet_id, c.user_id, u.name, c.version, c.path, c.old_value, c.new_value, c.action, c.created_at
+		FROM character_sheet_changes c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.sheet_id = $1
+		  AND ($2 = '' OR c.path[1] = $2)
+		  AND ($3 = 0 OR c.user_id = $3)
+		ORDER BY c.id DESC
+		LIMIT $4
+	`
+	rows, err := m.DB.Query(ctx, stmt, sheetID, filter.Section, filter.UserID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	h := &SheetHistory{}
+	for rows.Next() {
+		c := &SheetChange{}
+		if err := rows.Scan(&c.ID, &c.SheetID, &c.UserID, &c.UserName, &c.Version, &c.Path, &c.OldValue, &c.NewValue, &c.Action, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		h.Changes = append(h.Changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	const sectionsStmt = `
+		SELECT DISTINCT path[1]
+		FROM character_sheet_changes
+		WHERE sheet_id = $1 AND cardinality(path) > 0
+		ORDER BY 1
+	`
+	rows, err = m.DB.Query(ctx, sectionsStmt, sheetID)
+	if err != nil {
+		return nil, err
+	}
+	h.Sections, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	const usersStmt = `
+		SELECT DISTINCT u.id, u.name
+		FROM character_sheet_changes c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.sheet_id = $1
+		ORDER BY u.name
+	`
+	rows, err = m.DB.Query(ctx, usersStmt, sheetID)
+	if err != nil {
+		return nil, err
+	}
+	h.Users, err = pgx.CollectRows(rows, pgx.RowToStructByPos[SheetHistoryUser])
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// IsItem reports whether the change was to a whole item of an item grid,
+// such as creating or deleting it, rather than to one of its fields.
+func (c *SheetChange) IsItem() bool {
+	return len(c.Path) >= 2 && c.Path[len(c.Path)-2] == "items"
+}
+
+// RestoreField sets the value at path back to what it was as of version,
+// removing it when it did not exist then. Only the sheet's owner or a
+// gamemaster of its room may restore.
+func (m *CharacterSheetModel) RestoreField(ctx context.Context, userID, sheetID, version int, path []string) (int, error) {
+	if len(path) == 0 {
+		return 0, fmt.Errorf("models: restore needs a path")
+	}
+	return m.restore(ctx, userID, sheetID, version, [][]string{path})
+}
+
+// RestoreItem brings an item of an item grid, with its place in the grid,
+// back to how it was as of version. This is how a deleted item is undeleted.
+func (m *CharacterSheetModel) RestoreItem(ctx context.Context, userID, sheetID, version int, itemPath []string) (int, error) {
+	layoutPath, err := replaceLastSegment(itemPath, "items", "layouts")
+	if err != nil {
+		return 0, fmt.Errorf("invalid item path: %w", err)
+	}
+	return m.restore(ctx, userID, sheetID, version, [][]string{itemPath, layoutPath})
+}
+
+// RestoreSheet sets the whole sheet back to what it was as of version.
+// Changes made before the change log existed cannot be undone.
+func (m *CharacterSheetModel) RestoreSheet(ctx context.Context, userID, sheetID, version int) (int, error) {
+	return m.restore(ctx, userID, sheetID, version, [][]string{{}})
+}
+
+func (m *CharacterSheetModel) restore(ctx context.Context, userID, sheetID, version int, paths [][]string) (int, error) {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	content, current, err := lockForRestore(ctx, tx, userID, sheetID)
+	if err != nil {
+		return 0, err
+	}
+	if version < 1 || version > current {
+		return 0, ErrNoRecord
+	}
+
+	newestFirst, err := changesSince(ctx, tx, sheetID, version)
+	if err != nil {
+		return 0, err
+	}
+
+	// The whole sheet is logged section by section
+	if len(paths) == 1 && len(paths[0]) == 0 {
+		restored, _, err := valueAsOf(content, nil, newestFirst)
+		if err != nil {
+			return 0, err
+		}
+		return m.replaceContent(ctx, tx, userID, sheetID, content, restored)
+	}
+
+	values := make([]PathValue, len(paths))
+	for i, path := range paths {
+		value, ok, err := valueAsOf(content, path, newestFirst)
+		if err != nil {
+			return 0, err
+		}
+		values[i].Path = path
+		if ok {
+			if values[i].Value, err = json.Marshal(value); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return m.writeRestored(ctx, tx, userID, sheetID, paths, func() (int, error) {
+		return setPaths(ctx, tx, sheetID, values)
+	})
+}
+
+// changesSince returns the paths and old values of every change made to the
+// sheet after version, newest first, ready for valueAsOf.
+func changesSince(ctx context.Context, tx pgx.Tx, sheetID, version int) ([]*SheetChange, error) {
+	const stmt = `
+		SELECT path, old_value
+		FROM character_sheet_changes
+		WHERE sheet_id = $1 AND version > $2
+		ORDER BY id DESC
+	`
+	rows, err := tx.Query(ctx, stmt, sheetID, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var newestFirst []*SheetChange
+	for rows.Next() {
+		c := &SheetChange{}
+		if err := rows.Scan(&c.Path, &c.OldValue); err != nil {
+			return nil, err
+		}
+		newestFirst = append(newestFirst, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get changes: %w", err)
+	}
+	return newestFirst, nil
+}
+
+// ContentAt returns the sheet's content as it was at version, worked out
+// from the change log, to anyone who can view the sheet. A version of 0 is
+// the sheet as it is now. It also returns the version it resolved to.
+func (m *CharacterSheetModel) ContentAt(ctx context.Context, userID, sheetID, version int) (json.RawMessage, int, error) {
+	tx, err := m.DB.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const stmt = `
+		SELECT content, version, can_view_character_sheet($1, id)
+		FROM character_sheets
+		WHERE id = $2
+	`
+	var content json.RawMessage
+	var current int
+	var canView bool
+	err = tx.QueryRow(ctx, stmt, userID, sheetID).Scan(&content, &current, &canView)
+	if err == pgx.ErrNoRows {
+		return nil, 0, ErrNoRecord
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if !canView {
+		return nil, 0, ErrPermissionDenied
+	}
+	if version == 0 || version == current {
+		return content, current, nil
+	}
+	if version < 1 || version > current {
+		return nil, 0, ErrNoRecord
+	}
+
+	newestFirst, err := changesSince(ctx, tx, sheetID, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	past, _, err := valueAsOf(content, nil, newestFirst)
+	if err != nil {
+		return nil, 0, err
+	}
+	b, err := json.Marshal(past)
+	if err != nil {
+		return nil, 0, err
+	}
+	return b, version, nil
+}
+
+// lockForRestore locks the sheet for a restore, which only its owner or a
+// gamemaster of its room may make, returning its content and version.
+func lockForRestore(ctx context.Context, tx pgx.Tx, userID, sheetID int) (json.RawMessage, int, error) {
+	const stmt = `
+		SELECT content, version
+		FROM character_sheets
+		WHERE id = $1
+		  AND (owner_id = $2 OR has_sufficient_role($2, room_id, 'gamemaster'))
+		FOR UPDATE
+	`
+	var content json.RawMessage
+	var version int
+	err := tx.QueryRow(ctx, stmt, sheetID, userID).Scan(&content, &version)
+	if err == pgx.ErrNoRows {
+		return nil, 0, ErrPermissionDenied
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("lock character sheet: %w", err)
+	}
+	return content, version, nil
+}
+
+// replaceContent swaps the sheet's whole content, currently content, for
+// restored as a new version, logged section by section.
+func (m *CharacterSheetModel) replaceContent(ctx context.Context, tx pgx.Tx, userID, sheetID int, content json.RawMessage, restored any) (int, error) {
+	paths, err := topLevelPaths(content, restored)
+	if err != nil {
+		return 0, err
+	}
+	b, err := json.Marshal(restored)
+	if err != nil {
+		return 0, err
+	}
+	return m.writeRestored(ctx, tx, userID, sheetID, paths, func() (int, error) {
+		const stmt = `
+			UPDATE character_sheets
+			SET content = $2, version = version + 1, updated_at = now()
+			WHERE id = $1
+			RETURNING version
+		`
+		var v int
+		err := tx.QueryRow(ctx, stmt, sheetID, b).Scan(&v)
+		return v, err
+	})
+}
+
+// PathValue is a value to put at a path of a sheet; a nil Value removes the
+// path.
+type PathValue struct {
+	Path  []string
+	Value json.RawMessage
+}
+
+// setPaths writes values into the sheet's content as one new version.
+func setPaths(ctx context.Context, tx pgx.Tx, sheetID int, values []PathValue) (int, error) {
+	const setStmt = `
+		UPDATE character_sheets
+		SET content = jsonb_set(jsonb_ensure_path(content, $2::text[]), $2::text[], $3::jsonb, true)
+		WHERE id = $1
+	`
+	const removeStmt = `UPDATE character_sheets SET content = content #- $2::text[] WHERE id = $1`
+	for _, v := range values {
+		var err error
+		if v.Value == nil {
+			_, err = tx.Exec(ctx, removeStmt, sheetID, v.Path)
+		} else {
+			_, err = tx.Exec(ctx, setStmt, sheetID, v.Path, v.Value)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("set %s: %w", pathKey(v.Path), err)
+		}
+	}
+
+	const versionStmt = `
+		UPDATE character_sheets
+		SET version = version + 1, updated_at = now()
+		WHERE id = $1
+		RETURNING version
+	`
+	var version int
+	if err := tx.QueryRow(ctx, versionStmt, sheetID).Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// writeRestored runs a restoring write, logging it and recording its path
+// versions like any other edit.
+func (m *CharacterSheetModel) writeRestored(ctx context.Context, tx pgx.Tx, userID, sheetID int, paths [][]string, write func() (int, error)) (int, error) {
+	changes, err := captureChanges(ctx, tx, sheetID, paths)
+	if err != nil {
+		return 0, err
+	}
+	version, err := write()
+	if err != nil {
+		return 0, err
+	}
+	if err := changes.log(ctx, tx, userID, version); err != nil {
+		return 0, err
+	}
+	if err := recordPathVersions(ctx, tx, userID, sheetID, version, nil, paths); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit transaction: %w", err)
+	}
+	return version, nil
+}
+
+// What a logged change was: a plain edit, or an undo or redo of the write
+// that made its Target version.
+const (
+	actionEdit = "edit"
+	actionUndo = "undo"
+	actionRedo = "redo"
+)
+
+type changeAction struct {
+	Kind   string
+	Target int
+}
+
+// sheetChanges holds the values at some paths of a sheet from before a
+// write, so the write can be logged once it is made, in the same
+// transaction.
+type sheetChanges struct {
+	sheetID int
+	paths   [][]string
+	old     []json.RawMessage
+	action  changeAction
+}
+
+func captureChanges(ctx context.Context, tx pgx.Tx, sheetID int, paths [][]string) (*sheetChanges, error) {
+	c := &sheetChanges{
+		sheetID: sheetID,
+		paths:   paths,
+		old:     make([]json.RawMessage, len(paths)),
+		action:  changeAction{Kind: actionEdit},
+	}
+	const stmt = `SELECT content #> $2::text[] FROM character_sheets WHERE id = $1`
+	for i, path := range paths {
+		if err := tx.QueryRow(ctx, stmt, sheetID, path).Scan(&c.old[i]); err != nil {
+			return nil, fmt.Errorf("get value before change: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// log appends a change for every path whose value the write changed.
+func (c *sheetChanges) log(ctx context.Context, tx pgx.Tx, userID, version int) error {
+	const stmt = `
+		INSERT INTO character_sheet_changes (sheet_id, user_id, version, path, old_value, new_value, action, target_version)
+		SELECT id, $2, $3, $4::text[], $5::jsonb, content #> $4::text[], $6, nullif($7, 0)
+		FROM character_sheets
+		WHERE id = $1 AND $5::jsonb IS DISTINCT FROM content #> $4::text[]
+	`
+	for i, path := range c.paths {
+		if _, err := tx.Exec(ctx, stmt, c.sheetID, userID, version, path, c.old[i], c.action.Kind, c.action.Target); err != nil {
+			return fmt.Errorf("log change: %w", err)
+		}
+	}
+	return nil
+}
+
+// valueAsOf works out the value at path before the given changes by undoing
+// them, newest first, on top of content as it is now. It reports false when
+// the path did not exist then.
+func valueAsOf(content json.RawMessage, path []string, newestFirst []*SheetChange) (any, bool, error) {
+	var doc any
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, false, fmt.Errorf("unmarshal content: %w", err)
+	}
+
+	value, ok := jsonLookup(doc, path)
+	for _, c := range newestFirst {
+		var old any
+		hadOld := c.OldValue != nil
+		if hadOld {
+			if err := json.Unmarshal(c.OldValue, &old); err != nil {
+				return nil, false, fmt.Errorf("unmarshal change %d: %w", c.ID, err)
+			}
+		}
+		switch {
+		case hasPrefix(c.Path, path):
+			// The change was at path or inside it
+			value, ok = jsonReplace(value, ok, c.Path[len(path):], old, hadOld)
+		case hasPrefix(path, c.Path):
+			// The change replaced something path is inside of
+			value, ok = nil, false
+			if hadOld {
+				value, ok = jsonLookup(old, path[len(c.Path):])
+			}
+		}
+	}
+	return value, ok, nil
+}
+
+func hasPrefix(path, prefix []string) bool {
+	return len(path) >= len(prefix) && slices.Equal(path[:len(prefix)], prefix)
+}
+
+func jsonLookup(v any, path []string) (any, bool) {
+	for _, key := range path {
+		obj, isObj := v.(map[string]any)
+		if !isObj {
+			return nil, false
+		}
+		if v, isObj = obj[key]; !isObj {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonReplace sets the value at path inside v, or removes it when present
+// is false, creating objects on the way as needed.
+func jsonReplace(v any, ok bool, path []string, value any, present bool) (any, bool) {
+	if len(path) == 0 {
+		return value, present
+	}
+	obj, isObj := v.(map[string]any)
+	if !ok || !isObj {
+		if !present {
+			return v, ok
+		}
+		obj = map[string]any{}
+	}
+	child, childOK := obj[path[0]]
+	child, childOK = jsonReplace(child, childOK, path[1:], value, present)
+	if childOK {
+		obj[path[0]] = child
+	} else {
+		delete(obj, path[0])
+	}
+	return obj, true
+}
+
+// topLevelPaths lists every top-level key of content or restored as a
+// path.
+func topLevelPaths(content json.RawMessage, restored any) ([][]string, error) {
+	var current map[string]json.RawMessage
+	if err := json.Unmarshal(content, &current); err != nil {
+		return nil, fmt.Errorf("unmarshal content: %w", err)
+	}
+	keys := map[string]bool{}
+	for key := range current {
+		keys[key] = true
+	}
+	if obj, ok := restored.(map[string]any); ok {
+		for key := range obj {
+			keys[key] = true
+		}
+	}
+
+	paths := make([][]string, 0, len(keys))
+	for key := range keys {
+		paths = append(paths, []string{key})
+	}
+	slices.SortFunc(paths, func(a, b []string) int {
+		return strings.Compare(a[0], b[0])
+	})
+	return paths, nil
+}
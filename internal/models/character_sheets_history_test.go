@@ -0,0 +1,143 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/assert"
+)
+
+func TestValueAsOf(t *testing.T) {
+	content := json.RawMessage(`{
+		"characteristics": {"WS": {"value": 45}},
+		"gear": {"items": {"b": {"name": "Lasgun"}}, "layouts": {"b": {"x": 0}}}
+	}`)
+	// Newest first: WS 40 -> 45, item a deleted, item b created, WS 35 -> 40
+	newestFirst := []*SheetChange{
+		{ID: 4, Path: []string{"characteristics", "WS", "value"}, OldValue: json.RawMessage(`40`)},
+		{ID: 3, Path: []string{"gear", "items", "a"}, OldValue: json.RawMessage(`{"name": "Knife"}`)},
+		{ID: 2, Path: []string{"gear", "items", "b"}},
+		{ID: 1, Path: []string{"characteristics"}, OldValue: json.RawMessage(`{"WS": {"value": 35}}`)},
+	}
+
+	tests := []struct {
+		name    string
+		path    []string
+		changes int
+		want    string
+	}{
+		{"field", []string{"characteristics", "WS", "value"}, 1, `40`},
+		{"field through an ancestor's change", []string{"characteristics", "WS", "value"}, 4, `35`},
+		{"deleted item", []string{"gear", "items", "a"}, 2, `{"name":"Knife"}`},
+		{"parent of changes", []string{"gear"}, 3, `{"items":{"a":{"name":"Knife"}},"layouts":{"b":{"x":0}}}`},
+		{"untouched", []string{"gear", "layouts"}, 4, `{"b":{"x":0}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok, err := valueAsOf(content, tt.path, newestFirst[:tt.changes])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Fatal("value does not exist")
+			}
+			got, _ := json.Marshal(value)
+			if string(got) != tt.want {
+				t.Errorf("value = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok, _ := valueAsOf(content, []string{"gear", "items", "b"}, newestFirst[:3]); ok {
+		t.Error("item b existed before it was created")
+	}
+}
+
+func TestTopLevelPaths(t *testing.T) {
+	restored := map[string]any{"gear": nil, "notes": nil}
+	paths, err := topLevelPaths(json.RawMessage(`{"gear": {}, "armour": {}}`), restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, p := range paths {
+		keys = append(keys, pathKey(p))
+	}
+	if got := pathKey(keys); got != "armour.gear.notes" {
+		t.Errorf("paths = %s, want armour.gear.notes", got)
+	}
+}
+
+func TestRestoreAgainstDatabase(t *testing.T) {
+	const initial = `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":30}},"gear":{"items":{},"layouts":{}}}`
+	m, userID, sheetID := newTestSheet(t, initial)
+	ctx := context.Background()
+
+	ws := []string{"characteristics", "WS", "value"}
+	knife := []string{"gear", "items", "a"}
+	write := func(v int, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, version := sheetState(t, m, sheetID)
+		assert.Equal(t, version, v)
+	}
+	write(m.ChangeField(ctx, userID, sheetID, 0, ws, []byte(`35`)))
+	write(m.ChangeField(ctx, userID, sheetID, 0, ws, []byte(`40`)))
+	write(m.CreateItem(ctx, userID, sheetID, []string{"gear", "items"}, "a", json.RawMessage(`{"x":0}`), json.RawMessage(`{"name":"Knife"}`)))
+	write(m.DeleteItem(ctx, userID, sheetID, 0, knife))
+	// Versions: 1 initial, 2 WS 35, 3 WS 40, 4 knife created, 5 knife deleted
+
+	t.Run("ContentAt", func(t *testing.T) {
+		tests := []struct {
+			version int
+			want    string
+			wantAt  int
+		}{
+			{0, `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":40}},"gear":{"items":{},"layouts":{}}}`, 5},
+			{1, initial, 1},
+			{2, `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":35}},"gear":{"items":{},"layouts":{}}}`, 2},
+			{4, `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":40}},"gear":{"items":{"a":{"name":"Knife"}},"layouts":{"a":{"x":0}}}}`, 4},
+		}
+		for _, tt := range tests {
+			content, at, err := m.ContentAt(ctx, userID, sheetID, tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, compactJSON(t, content), compactJSON(t, []byte(tt.want)))
+			assert.Equal(t, at, tt.wantAt)
+		}
+
+		_, _, err := m.ContentAt(ctx, userID, sheetID, 6)
+		assert.Equal(t, err, ErrNoRecord)
+	})
+
+	t.Run("RestoreField", func(t *testing.T) {
+		write(m.RestoreField(ctx, userID, sheetID, 2, ws))
+		content, _ := sheetState(t, m, sheetID)
+		assert.Equal(t, content, `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":35}},"gear":{"items":{},"layouts":{}}}`)
+	})
+
+	t.Run("RestoreItem", func(t *testing.T) {
+		write(m.RestoreItem(ctx, userID, sheetID, 4, knife))
+		content, _ := sheetState(t, m, sheetID)
+		assert.Equal(t, content, `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":35}},"gear":{"items":{"a":{"name":"Knife"}},"layouts":{"a":{"x":0}}}}`)
+	})
+
+	t.Run("RestoreSheet", func(t *testing.T) {
+		write(m.RestoreSheet(ctx, userID, sheetID, 1))
+		content, version := sheetState(t, m, sheetID)
+		assert.Equal(t, content, compactJSON(t, []byte(initial)))
+		assert.Equal(t, version, 8)
+
+		// The restore is itself in the log: the sheet as of version 7
+		// still has the knife.
+		at7, _, err := m.ContentAt(ctx, userID, sheetID, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, compactJSON(t, at7), `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":35}},"gear":{"items":{"a":{"name":"Knife"}},"layouts":{"a":{"x":0}}}}`)
+	})
+}
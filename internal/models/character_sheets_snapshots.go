@@ -0,0 +1,143 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SheetSnapshot is a named copy of a sheet's content as of Version.
+type SheetSnapshot struct {
+	ID        int
+	SheetID   int
+	UserID    int
+	UserName  string
+	Label     string
+	Content   json.RawMessage
+	Version   int
+	CreatedAt time.Time
+}
+
+// CreateSnapshot copies the sheet's content under label, for anyone who can
+// edit the sheet, and returns the new snapshot's id.
+func (m *CharacterSheetModel) CreateSnapshot(ctx context.Context, userID, sheetID int, label string) (int, error) {
+	const stmt = `
+		INSERT INTO character_sheet_snapshots (sheet_id, user_id, label, content, version)
+		SELECT id, $2, $3, content, version
+		FROM character_sheets
+		WHERE id = $1 AND can_edit_character_sheet($2, $1)
+		RETURNING id
+	`
+	var id int
+	err := m.DB.QueryRow(ctx, stmt, sheetID, userID, label).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return 0, ErrPermissionDenied
+	}
+	if err != nil {
+		return 0, fmt.Errorf("create snapshot: %w", err)
+	}
+	return id, nil
+}
+
+// ListSnapshots returns the sheet's snapshots, newest first and without
+// their content, to anyone who can view the sheet.
+func (m *CharacterSheetModel) ListSnapshots(ctx context.Context, userID, sheetID int) ([]*SheetSnapshot, error) {
+	var canView bool
+	err := m.DB.QueryRow(ctx, `SELECT can_view_character_sheet($1, $2)`, userID, sheetID).Scan(&canView)
+	if err != nil {
+		return nil, err
+	}
+	if !canView {
+		return nil, ErrPermissionDenied
+	}
+
+	const stmt = `
+		SELECT s.id, s.sheet_id, s.user_id, u.name, s.label, s.version, s.created_at
+		FROM character_sheet_snapshots s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.sheet_id = $1
+		ORDER BY s.created_at DESC, s.id DESC
+	`
+	rows, err := m.DB.Query(ctx, stmt, sheetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []*SheetSnapshot
+	for rows.Next() {
+		s := &SheetSnapshot{}
+		if err := rows.Scan(&s.ID, &s.SheetID, &s.UserID, &s.UserName, &s.Label, &s.Version, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// GetSnapshot returns one of the sheet's snapshots, content included, to
+// anyone who can view the sheet.
+func (m *CharacterSheetModel) GetSnapshot(ctx context.Context, userID, sheetID, snapshotID int) (*SheetSnapshot, error) {
+	const stmt = `
+		SELECT s.id, s.sheet_id, s.user_id, u.name, s.label, s.content, s.version, s.created_at,
+		       can_view_character_sheet($3, s.sheet_id)
+		FROM character_sheet_snapshots s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = $1 AND s.sheet_id = $2
+	`
+	s := &SheetSnapshot{}
+	var canView bool
+	err := m.DB.QueryRow(ctx, stmt, snapshotID, sheetID, userID).Scan(
+		&s.ID, &s.SheetID, &s.UserID, &s.UserName, &s.Label, &s.Content, &s.Version, &s.CreatedAt, &canView)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNoRecord
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !canView {
+		return nil, ErrPermissionDenied
+	}
+	return s, nil
+}
+
+// RestoreSnapshot writes the snapshot's content over the sheet as a new
+// version, logged like any restore so it can itself be undone from the
+// history. Only the sheet's owner or a gamemaster of its room may restore.
+func (m *CharacterSheetModel) RestoreSnapshot(ctx context.Context, userID, sheetID, snapshotID int) (int, error) {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	content, _, err := lockForRestore(ctx, tx, userID, sheetID)
+	if err != nil {
+		return 0, err
+	}
+
+	const stmt = `
+		SELECT content
+		FROM character_sheet_snapshots
+		WHERE id = $1 AND sheet_id = $2
+	`
+	var snapshot json.RawMessage
+	err = tx.QueryRow(ctx, stmt, snapshotID, sheetID).Scan(&snapshot)
+	if err == pgx.ErrNoRows {
+		return 0, ErrNoRecord
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get snapshot: %w", err)
+	}
+	var restored any
+	if err := json.Unmarshal(snapshot, &restored); err != nil {
+		return 0, fmt.Errorf("unmarshal snapshot: %w", err)
+	}
+	return m.replaceContent(ctx, tx, userID, sheetID, content, restored)
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/assert"
+)
+
+func TestSnapshotsAgainstDatabase(t *testing.T) {
+	const (
+		initial   = `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":30}},"gear":{"items":{},"layouts":{}}}`
+		ws35      = `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":35}},"gear":{"items":{},"layouts":{}}}`
+		withKnife = `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":40}},"gear":{"items":{"a":{"name":"Knife"}},"layouts":{"a":{"x":0}}}}`
+	)
+	m, userID, sheetID := newTestSheet(t, initial)
+	ctx := context.Background()
+
+	ws := []string{"characteristics", "WS", "value"}
+	if _, err := m.ChangeField(ctx, userID, sheetID, 0, ws, []byte(`35`)); err != nil {
+		t.Fatal(err)
+	}
+	snapshotID, err := m.CreateSnapshot(ctx, userID, sheetID, "Before the fight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ChangeField(ctx, userID, sheetID, 0, ws, []byte(`40`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateItem(ctx, userID, sheetID, []string{"gear", "items"}, "a", json.RawMessage(`{"x":0}`), json.RawMessage(`{"name":"Knife"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := m.GetSnapshot(ctx, userID, sheetID, snapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, snapshot.Label, "Before the fight")
+	assert.Equal(t, snapshot.Version, 2)
+	assert.Equal(t, compactJSON(t, snapshot.Content), ws35)
+
+	snapshots, err := m.ListSnapshots(ctx, userID, sheetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(snapshots), 1)
+
+	version, err := m.RestoreSnapshot(ctx, userID, sheetID, snapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, version, 5)
+	content, current := sheetState(t, m, sheetID)
+	assert.Equal(t, content, ws35)
+	assert.Equal(t, current, 5)
+
+	// The restore is logged, so the sheet from before it can be brought back
+	before, _, err := m.ContentAt(ctx, userID, sheetID, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, compactJSON(t, before), withKnife)
+	if _, err := m.RestoreSheet(ctx, userID, sheetID, 4); err != nil {
+		t.Fatal(err)
+	}
+	content, current = sheetState(t, m, sheetID)
+	assert.Equal(t, content, withKnife)
+	assert.Equal(t, current, 6)
+
+	_, err = m.RestoreSnapshot(ctx, userID, sheetID, snapshotID+1)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
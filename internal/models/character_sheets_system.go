@@ -0,0 +1,554 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The rules below mirror ui/static/js/sheet/system.js and computed.js, so
+// the server arrives at the same numbers the sheet shows.
+
+// CharacteristicKeys are the keys of CharacterSheetContent.Characteristics
+// in the order the sheet shows them.
+var CharacteristicKeys = []string{"WS", "BS", "S", "T", "A", "I", "P", "W", "F", "Inf", "Cor"}
+
+// standardSkills maps the keys of the fixed skill rows to the
+// characteristic used when the row has none selected.
+var standardSkills = map[string]string{
+	"acrobatics":          "A",
+	"athletics":           "S",
+	"awareness":           "P",
+	"charm":               "F",
+	"command":             "F",
+	"commerce":            "I",
+	"deceive":             "I",
+	"dodge":               "A",
+	"inquiry":             "F",
+	"interrogation":       "W",
+	"intimidate":          "W",
+	"logic":               "I",
+	"medicae":             "I",
+	"navigate_surface":    "I",
+	"navigate_stellar":    "I",
+	"navigate_warp":       "I",
+	"operate_surface":     "A",
+	"operate_aeronautica": "A",
+	"operate_void":        "I",
+	"parry":               "WS",
+	"psyniscience":        "P",
+	"scrutiny":            "P",
+	"security":            "I",
+	"sleight_of_hand":     "A",
+	"stealth":             "A",
+	"survival":            "P",
+	"tech-use":            "I",
+}
+
+// SkillAdvancement is the difficulty modifier for a skill trained count
+// times: -20 untrained, +0 for the first step and +10 for each further one.
+func SkillAdvancement(count int) int {
+	if count == 0 {
+		return -20
+	}
+	return (count - 1) * 10
+}
+
+// TestDifficulty is the target of a test: the characteristic, capped at
+// 100, plus the skill advancement.
+func TestDifficulty(characteristicValue, skillAdvancement int) int {
+	return min(characteristicValue, 100) + skillAdvancement
+}
+
+// CharacteristicBase is the characteristic bonus: the tens digit of the
+// characteristic, capped at 100, plus the unnatural rating.
+func CharacteristicBase(characteristicValue, unnaturalValue int) int {
+	return min(characteristicValue, 100)/10 + unnaturalValue
+}
+
+// BonusSuccesses is the number of extra degrees of success granted by an
+// unnatural characteristic.
+func BonusSuccesses(unnaturalValue int) int {
+	return unnaturalValue / 2
+}
+
+// sheetNumber reads a number typed into a sheet field, treating anything
+// that is not a whole number as 0 like the sheet does.
+func sheetNumber(s string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// CharacteristicValue is the characteristic including an enabled
+// temporary modifier. ok is false when key is not a characteristic.
+func (c *CharacterSheetContent) CharacteristicValue(key string) (value int, ok bool) {
+	key, ok = characteristicKey(key)
+	if !ok {
+		return 0, false
+	}
+	ch := c.Characteristics[key]
+	value = sheetNumber(ch.Value)
+	if ch.TempEnabled {
+		value += sheetNumber(ch.TempValue)
+	}
+	return value, true
+}
+
+// CharacteristicUnnatural is the unnatural rating including an enabled
+// temporary modifier.
+func (c *CharacterSheetContent) CharacteristicUnnatural(key string) (value int, ok bool) {
+	key, ok = characteristicKey(key)
+	if !ok {
+		return 0, false
+	}
+	ch := c.Characteristics[key]
+	value = sheetNumber(ch.Unnatural)
+	if ch.TempEnabled {
+		value += sheetNumber(ch.TempUnnatural)
+	}
+	return value, true
+}
+
+// CharacteristicBonus is the bonus of a characteristic, e.g. the Strength
+// Bonus for "S".
+func (c *CharacterSheetContent) CharacteristicBonus(key string) (int, bool) {
+	value, ok := c.CharacteristicValue(key)
+	if !ok {
+		return 0, false
+	}
+	unnatural, _ := c.CharacteristicUnnatural(key)
+	return CharacteristicBase(value, unnatural), true
+}
+
+// SkillDifficulty is the test difficulty of a skill. name is matched
+// ignoring case, spaces and punctuation against the skill's key and any
+// name the player gave it, so "Sleight of Hand", "sleight_of_hand"
+// and "SleightOfHand" all work. Custom skills are searched last.
+func (c *CharacterSheetContent) SkillDifficulty(name string) (int, bool) {
+	skill, characteristic, ok := c.findSkill(name)
+	if !ok {
+		return 0, false
+	}
+	return c.skillDifficulty(skill, characteristic), true
+}
+
+// findSkill returns the skill called name and the characteristic it is
+// tested with.
+func (c *CharacterSheetContent) findSkill(name string) (Skill, string, bool) {
+	want := normalizeSkillName(name)
+	if want == "" {
+		return Skill{}, "", false
+	}
+
+	withDefault := func(skill Skill, characteristic string) (Skill, string, bool) {
+		if skill.Characteristic != "" {
+			characteristic = skill.Characteristic
+		}
+		return skill, characteristic, true
+	}
+
+	for key, characteristic := range standardSkills {
+		if want == normalizeSkillName(key) {
+			return withDefault(c.SkillsLeft[key], characteristic)
+		}
+	}
+	for key, skill := range c.SkillsLeft {
+		if skill.Name != "" && want == normalizeSkillName(skill.Name) {
+			return withDefault(skill, standardSkills[key])
+		}
+	}
+	// The right column holds the named lore, trade and linguistics rows,
+	// which all default to Intelligence
+	for _, skill := range c.SkillsRight {
+		if skill.Name != "" && want == normalizeSkillName(skill.Name) {
+			return withDefault(skill, "I")
+		}
+	}
+	for _, skill := range c.CustomSkills.List.Items {
+		if skill.Name != "" && want == normalizeSkillName(skill.Name) {
+			return withDefault(skill, "WS")
+		}
+	}
+	return Skill{}, "", false
+}
+
+func (c *CharacterSheetContent) skillDifficulty(skill Skill, characteristic string) int {
+	value, _ := c.CharacteristicValue(characteristic)
+
+	count := 0
+	for _, trained := range []bool{skill.Plus0, skill.Plus10, skill.Plus20, skill.Plus30} {
+		if trained {
+			count++
+		}
+	}
+	return TestDifficulty(value, SkillAdvancement(count)) + skill.MiscBonus
+}
+
+// skillOverride matches a roll base such as "Awareness (WS)": a skill
+// tested with another characteristic than its own.
+var skillOverride = regexp.MustCompile(`^(.+?)\s*\(([A-Za-z]+)\)$`)
+
+// RollValue is the base target of a roll configured on the sheet: a
+// characteristic key, a skill name, or a skill with an overriding
+// characteristic like "Awareness (WS)". Unknown bases count as 0.
+func (c *CharacterSheetContent) RollValue(baseSelect string) int {
+	name, override := splitRollBase(baseSelect)
+	if override == "" {
+		if v, ok := c.CharacteristicValue(name); ok {
+			return v
+		}
+	}
+	skill, characteristic, ok := c.findSkill(name)
+	if !ok {
+		return 0
+	}
+	if override != "" {
+		characteristic = override
+	}
+	return c.skillDifficulty(skill, characteristic)
+}
+
+// RollBonusSuccesses is the number of extra degrees of success a roll
+// configured on the sheet earns from the unnatural rating of the
+// characteristic it is tested with.
+func (c *CharacterSheetContent) RollBonusSuccesses(baseSelect string) int {
+	name, characteristic := splitRollBase(baseSelect)
+	if characteristic == "" {
+		if _, ok := characteristicKey(name); ok {
+			characteristic = name
+		} else if _, skillCharacteristic, ok := c.findSkill(name); ok {
+			characteristic = skillCharacteristic
+		}
+	}
+	unnatural, _ := c.CharacteristicUnnatural(characteristic)
+	return BonusSuccesses(unnatural)
+}
+
+func splitRollBase(baseSelect string) (name, override string) {
+	baseSelect = strings.TrimSpace(baseSelect)
+	if m := skillOverride.FindStringSubmatch(baseSelect); m != nil {
+		return strings.TrimSpace(m[1]), m[2]
+	}
+	return baseSelect, ""
+}
+
+// characteristicKey returns the canonical spelling of a characteristic key
+// matched case-insensitively.
+func characteristicKey(key string) (string, bool) {
+	for _, k := range CharacteristicKeys {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+func normalizeSkillName(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return sb.String()
+}
+
+// Modifier is the test modifier of the selected aim.
+func (c AimColumn) Modifier() int {
+	switch c.Selected {
+	case "half":
+		return c.Half
+	case "full":
+		return c.Full
+	}
+	return c.No
+}
+
+// Modifier is the test modifier of the selected called shot.
+func (c TargetColumn) Modifier() int {
+	switch c.Selected {
+	case "torso":
+		return c.Torso
+	case "leg":
+		return c.Leg
+	case "arm":
+		return c.Arm
+	case "head":
+		return c.Head
+	case "joint":
+		return c.Joint
+	case "eyes":
+		return c.Eyes
+	}
+	return c.No
+}
+
+// Modifier is the test modifier of the selected range, combat range when
+// none is.
+func (c RangedRangeColumn) Modifier() int {
+	switch c.Selected {
+	case "melee":
+		return c.Melee
+	case "pointBlank":
+		return c.PointBlank
+	case "short":
+		return c.Short
+	case "long":
+		return c.Long
+	case "extreme":
+		return c.Extreme
+	}
+	return c.Combat
+}
+
+// Modifier is the test modifier of the selected rate of fire.
+func (c RangedRoFColumn) Modifier() int {
+	switch c.Selected {
+	case "short":
+		return c.Short
+	case "long":
+		return c.Long
+	case "suppression":
+		return c.Suppression
+	}
+	return c.Single
+}
+
+// Modifier is the test modifier of the selected attack action.
+func (c MeleeBaseColumn) Modifier() int {
+	switch c.Selected {
+	case "charge":
+		return c.Charge
+	case "full":
+		return c.Full
+	case "careful":
+		return c.Careful
+	case "mounted":
+		return c.Mounted
+	case "free":
+		return c.Free
+	}
+	return c.Standard
+}
+
+// Modifier is the test modifier of the selected stance.
+func (c MeleeStanceColumn) Modifier() int {
+	switch c.Selected {
+	case "aggressive":
+		return c.Aggressive
+	case "defensive":
+		return c.Defensive
+	}
+	return c.Standard
+}
+
+// Modifier is the test modifier of the selected melee rate of attack.
+func (c MeleeRoFColumn) Modifier() int {
+	switch c.Selected {
+	case "quick":
+		return c.Quick
+	case "lightning":
+		return c.Lightning
+	}
+	return c.Single
+}
+
+// Modifier is the value of the extra modifier when it is switched on.
+func (e RollExtra) Modifier() int {
+	if !e.Enabled {
+		return 0
+	}
+	return e.Value
+}
+
+// Modifier is the sum of every modifier selected in the roll dialog.
+func (r *RangedAttackRoll) Modifier() int {
+	return r.Aim.Modifier() + r.Target.Modifier() + r.Range.Modifier() + r.RoF.Modifier() +
+		r.Extra1.Modifier() + r.Extra2.Modifier()
+}
+
+// Modifier is the sum of every modifier selected in the roll dialog.
+func (r *MeleeAttackRoll) Modifier() int {
+	return r.Aim.Modifier() + r.Target.Modifier() + r.Base.Modifier() + r.Stance.Modifier() + r.RoF.Modifier() +
+		r.Extra1.Modifier() + r.Extra2.Modifier()
+}
+
+// PsychicPRModifier is the focus power test bonus for every point of power
+// rating used, pushed or not.
+const PsychicPRModifier = 5
+
+// TestModifier is the focus power test modifier set in the roll dialog:
+// the flat modifier, the power rating used and the enabled extras.
+func (r *PsychicPowerRoll) TestModifier() int {
+	return r.Modifier + PsychicPRModifier*(r.EffectivePR+r.KickPR) + r.Extra1.Modifier() + r.Extra2.Modifier()
+}
+
+// TestModifier is the tech power test modifier set in the roll dialog: the
+// flat modifier and the enabled extras.
+func (r *TechPowerRoll) TestModifier() int {
+	return r.Modifier + r.Extra1.Modifier() + r.Extra2.Modifier()
+}
+
+// AvailablePR is the power rating the psyker can use without pushing: the
+// base rating less what sustained powers take up.
+func (p *Psykana) AvailablePR() int {
+	return p.BasePR - p.SustainedPowers
+}
+
+// BodyPart returns the armour worn on a hit location such as "rightArm".
+func (a *Armour) BodyPart(location string) (BodyPart, bool) {
+	switch location {
+	case "head":
+		return a.Head, true
+	case "rightArm":
+		return a.RightArm, true
+	case "leftArm":
+		return a.LeftArm, true
+	case "body":
+		return a.Body, true
+	case "rightLeg":
+		return a.RightLeg, true
+	case "leftLeg":
+		return a.LeftLeg, true
+	}
+	return BodyPart{}, false
+}
+
+// Sum is the armour worn on the body part including its extras.
+func (p BodyPart) Sum() int {
+	return p.ArmourValue + p.Extra1Value + p.Extra2Value
+}
+
+// LocationArmour is what stands between a hit on one location and the
+// character's wounds.
+type LocationArmour struct {
+	Armour      int `json:"armour"`    // worn, natural, machine and other armour, reduced by penetration
+	Toughness   int `json:"toughness"` // toughness bonus and daemonic armour, which penetration ignores
+	SuperArmour int `json:"superArmour,omitempty"`
+}
+
+// ArmourAt sums the armour protecting a hit location. The toughness part is
+// the Toughness bonus, which the sheet shows as ToughnessBaseAbsorptionValue
+// but only computes in the browser, so the stored value is used only when
+// the sheet has no Toughness.
+func (c *CharacterSheetContent) ArmourAt(location string) (LocationArmour, bool) {
+	a := &c.Armour
+	part, ok := a.BodyPart(location)
+	if !ok {
+		return LocationArmour{}, false
+	}
+	toughness, _ := c.CharacteristicBonus("T")
+	if toughness == 0 {
+		toughness = a.ToughnessBaseAbsorptionValue
+	}
+	return LocationArmour{
+		Armour:      part.Sum() + a.NaturalArmourValue + a.MachineValue + a.OtherArmourValue,
+		Toughness:   toughness + a.DaemonicValue,
+		SuperArmour: part.SuperArmour,
+	}, true
+}
+
+// Halves reports whether super armour halves a hit with the given
+// penetration.
+func (a LocationArmour) Halves(pen int) bool {
+	return pen < a.SuperArmour
+}
+
+// Wounds is the damage a hit deals after armour: super armour halves hits
+// whose penetration is below it, rounding up, then the armour reduced by
+// the penetration and the toughness are taken off.
+func (a LocationArmour) Wounds(damage, pen int) int {
+	if a.Halves(pen) {
+		damage = (damage + 1) / 2
+	}
+	return max(0, damage-max(0, a.Armour-pen)-a.Toughness)
+}
+
+// ArcanaPoints is an amount of cognition and energy, what a tech power
+// costs or what a sheet has left.
+type ArcanaPoints struct {
+	Cognition int `json:"cognition"`
+	Energy    int `json:"energy"`
+}
+
+// IsZero reports whether no points are involved.
+func (p ArcanaPoints) IsZero() bool {
+	return p.Cognition == 0 && p.Energy == 0
+}
+
+// Spend takes cost from the points, reporting false and leaving them as
+// they are when there is not enough of either.
+func (p ArcanaPoints) Spend(cost ArcanaPoints) (ArcanaPoints, bool) {
+	left := ArcanaPoints{Cognition: p.Cognition - cost.Cognition, Energy: p.Energy - cost.Energy}
+	if left.Cognition < 0 || left.Energy < 0 {
+		return p, false
+	}
+	return left, true
+}
+
+// ParseTechPowerPrice reads the price of a tech power such as
+// "2 cognition, 1 energy", "Energy: 3" or "2 когниции". Each number goes
+// with the unit next to it; a price with no numbers is free.
+func ParseTechPowerPrice(price string) (ArcanaPoints, error) {
+	var points ArcanaPoints
+	var pendingNumber, pendingUnit string
+
+	add := func(number, unit string) {
+		n, _ := strconv.Atoi(number)
+		if unit == "cognition" {
+			points.Cognition += n
+		} else {
+			points.Energy += n
+		}
+	}
+
+	for _, token := range priceToken.FindAllString(price, -1) {
+		if unicode.IsDigit([]rune(token)[0]) {
+			if pendingUnit != "" {
+				add(token, pendingUnit)
+				pendingUnit = ""
+				continue
+			}
+			if pendingNumber != "" {
+				return ArcanaPoints{}, fmt.Errorf("price %q: %s has no unit", price, pendingNumber)
+			}
+			pendingNumber = token
+			continue
+		}
+
+		unit := priceUnit(token)
+		if unit == "" {
+			continue
+		}
+		if pendingNumber != "" {
+			add(pendingNumber, unit)
+			pendingNumber = ""
+			continue
+		}
+		pendingUnit = unit
+	}
+	if pendingNumber != "" {
+		return ArcanaPoints{}, fmt.Errorf("price %q: %s has no unit", price, pendingNumber)
+	}
+	return points, nil
+}
+
+var priceToken = regexp.MustCompile(`\d+|\p{L}+`)
+
+// priceUnit names the pool a word of a price refers to, or "" for words
+// that are not a unit.
+func priceUnit(word string) string {
+	word = strings.ToLower(word)
+	switch {
+	case strings.HasPrefix(word, "cog"), strings.HasPrefix(word, "ког"):
+		return "cognition"
+	case strings.HasPrefix(word, "en"), strings.HasPrefix(word, "энер"):
+		return "energy"
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const systemTestSheet = `{
+	"characterInfo": {"characterName": "Brother Marcus"},
+	"characteristics": {
+		"WS": {"value": "47"},
+		"S":  {"value": "38", "unnatural": "2", "tempValue": "10", "tempUnnatural": "1", "tempEnabled": true},
+		"P":  {"value": "41", "tempValue": "20"},
+		"A":  {"value": "not a number"},
+		"I":  {"value": "35"}
+	},
+	"skillsLeft": {
+		"awareness":       {"characteristic": "", "plus0": true, "plus10": true, "miscBonus": 5},
+		"sleight_of_hand": {"characteristic": "WS"}
+	},
+	"skillsRight": {
+		"1_trade": {"name": "Trade (Armourer)", "plus0": true}
+	},
+	"customSkills": {"list": {"items": {
+		"abc": {"name": "Blather", "plus0": true}
+	}}}
+}`
+
+func TestCharacterSheetSystem(t *testing.T) {
+	var sheet CharacterSheetContent
+	if err := json.Unmarshal([]byte(systemTestSheet), &sheet); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  func() (int, bool)
+		want int
+	}{
+		{"WS", func() (int, bool) { return sheet.CharacteristicValue("WS") }, 47},
+		{"ws", func() (int, bool) { return sheet.CharacteristicValue("ws") }, 47},
+		{"S with temp", func() (int, bool) { return sheet.CharacteristicValue("S") }, 48},
+		{"P temp disabled", func() (int, bool) { return sheet.CharacteristicValue("P") }, 41},
+		{"A unparsable", func() (int, bool) { return sheet.CharacteristicValue("A") }, 0},
+		{"SB", func() (int, bool) { return sheet.CharacteristicBonus("S") }, 4 + 3},
+		{"WSB", func() (int, bool) { return sheet.CharacteristicBonus("WS") }, 4},
+		{"Awareness", func() (int, bool) { return sheet.SkillDifficulty("Awareness") }, 41 + 10 + 5},
+		{"Sleight of Hand", func() (int, bool) { return sheet.SkillDifficulty("SleightOfHand") }, 47 - 20},
+		{"untrained Dodge", func() (int, bool) { return sheet.SkillDifficulty("dodge") }, -20},
+		{"Tech-Use", func() (int, bool) { return sheet.SkillDifficulty("tech_use") }, 35 - 20},
+		{"named trade", func() (int, bool) { return sheet.SkillDifficulty("trade armourer") }, 35},
+		{"custom skill", func() (int, bool) { return sheet.SkillDifficulty("blather") }, 47},
+	}
+	for _, tt := range tests {
+		got, ok := tt.got()
+		if !ok || got != tt.want {
+			t.Errorf("%s = %d, %v; want %d", tt.name, got, ok, tt.want)
+		}
+	}
+
+	if _, ok := sheet.CharacteristicValue("X"); ok {
+		t.Error("X is not a characteristic")
+	}
+	if _, ok := sheet.SkillDifficulty("Basket Weaving"); ok {
+		t.Error("Basket Weaving is not a skill on the sheet")
+	}
+}
+
+func TestCharacteristicMath(t *testing.T) {
+	if got := SkillAdvancement(0); got != -20 {
+		t.Errorf("SkillAdvancement(0) = %d, want -20", got)
+	}
+	if got := SkillAdvancement(4); got != 30 {
+		t.Errorf("SkillAdvancement(4) = %d, want 30", got)
+	}
+	if got := TestDifficulty(120, 10); got != 110 {
+		t.Errorf("TestDifficulty(120, 10) = %d, want 110", got)
+	}
+	if got := CharacteristicBase(109, 2); got != 12 {
+		t.Errorf("CharacteristicBase(109, 2) = %d, want 12", got)
+	}
+}
+
+func TestRollValue(t *testing.T) {
+	var sheet CharacterSheetContent
+	if err := json.Unmarshal([]byte(systemTestSheet), &sheet); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		base  string
+		want  int
+		bonus int
+	}{
+		{"WS", 47, 0},
+		{"S", 48, 1},
+		{"Awareness", 56, 0},
+		{"Awareness (S)", 48 + 10 + 5, 1},
+		{"Sleight of Hand", 27, 0},
+		{"Basket Weaving", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := sheet.RollValue(tt.base); got != tt.want {
+			t.Errorf("RollValue(%q) = %d, want %d", tt.base, got, tt.want)
+		}
+		if got := sheet.RollBonusSuccesses(tt.base); got != tt.bonus {
+			t.Errorf("RollBonusSuccesses(%q) = %d, want %d", tt.base, got, tt.bonus)
+		}
+	}
+}
+
+func TestAttackRollModifier(t *testing.T) {
+	ranged := NewDefaultRangedAttackRoll()
+	if got := ranged.Modifier(); got != 10 {
+		t.Errorf("default ranged modifier = %d, want 10", got)
+	}
+	ranged.Aim.Selected = "full"
+	ranged.Range.Selected = "pointBlank"
+	ranged.RoF.Selected = "long"
+	ranged.Extra1 = RollExtra{Enabled: true, Value: -5}
+	ranged.Extra2 = RollExtra{Enabled: false, Value: 30}
+	if got := ranged.Modifier(); got != 20+30-10-5 {
+		t.Errorf("ranged modifier = %d, want %d", got, 20+30-10-5)
+	}
+
+	melee := NewDefaultMeleeAttackRoll()
+	melee.Target.Selected = "arm"
+	melee.Stance.Selected = "aggressive"
+	want := -20 + DefaultMeleeBaseColumn.Standard + DefaultMeleeStanceColumn.Aggressive
+	if got := melee.Modifier(); got != want {
+		t.Errorf("melee modifier = %d, want %d", got, want)
+	}
+}
+
+func TestLocationArmourWounds(t *testing.T) {
+	a := LocationArmour{Armour: 6, Toughness: 4, SuperArmour: 5}
+	tests := []struct {
+		damage, pen, want int
+	}{
+		{20, 0, (20+1)/2 - 6 - 4},
+		{20, 5, 20 - 1 - 4},
+		{21, 10, 21 - 0 - 4},
+		{11, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := a.Wounds(tt.damage, tt.pen); got != tt.want {
+			t.Errorf("Wounds(%d, pen %d) = %d, want %d", tt.damage, tt.pen, got, tt.want)
+		}
+	}
+}
+
+func TestParseTechPowerPrice(t *testing.T) {
+	tests := []struct {
+		price string
+		want  ArcanaPoints
+	}{
+		{"", ArcanaPoints{}},
+		{"—", ArcanaPoints{}},
+		{"2 cognition, 1 energy", ArcanaPoints{Cognition: 2, Energy: 1}},
+		{"Energy: 3", ArcanaPoints{Energy: 3}},
+		{"1 Cog + 2 En", ArcanaPoints{Cognition: 1, Energy: 2}},
+		{"2 когниции, 3 энергии", ArcanaPoints{Cognition: 2, Energy: 3}},
+	}
+	for _, tt := range tests {
+		got, err := ParseTechPowerPrice(tt.price)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseTechPowerPrice(%q) = %+v, %v, want %+v", tt.price, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"3", "2 per turn", "1 2 energy"} {
+		if _, err := ParseTechPowerPrice(bad); err == nil {
+			t.Errorf("ParseTechPowerPrice(%q): expected an error", bad)
+		}
+	}
+
+	left, ok := ArcanaPoints{Cognition: 3, Energy: 1}.Spend(ArcanaPoints{Cognition: 2, Energy: 2})
+	if ok || left != (ArcanaPoints{Cognition: 3, Energy: 1}) {
+		t.Errorf("overspending = %+v, %v", left, ok)
+	}
+}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// undoDepth is how many of a user's latest writes to a sheet undo and redo
+// reach back over.
+const undoDepth = 100
+
+// SheetEdit is an undo or redo as applied: the value each path was set to
+// and the sheet version that made.
+type SheetEdit struct {
+	Version int
+	Values  []PathValue
+}
+
+type loggedWrite struct {
+	Version int
+	Action  changeAction
+}
+
+// undoStacks replays a user's writes to a sheet, oldest first, into the
+// versions they can undo and the undo writes they can redo, latest last.
+// Undoing reverts a write; redoing reverts the undo. A new edit ends what
+// could be redone.
+func undoStacks(writes []loggedWrite) (undo, redo []int) {
+	for _, w := range writes {
+		switch w.Action.Kind {
+		case actionUndo:
+			if i := slices.Index(undo, w.Action.Target); i >= 0 {
+				undo = slices.Delete(undo, i, i+1)
+			}
+			redo = append(redo, w.Version)
+		case actionRedo:
+			if i := slices.Index(redo, w.Action.Target); i >= 0 {
+				redo = slices.Delete(redo, i, i+1)
+			}
+			undo = append(undo, w.Version)
+		default:
+			undo = append(undo, w.Version)
+			redo = nil
+		}
+	}
+	return undo, redo
+}
+
+// Undo reverts the user's latest write to the sheet that is not undone yet.
+// It fails with a *ConflictError when someone else has since changed what
+// that write did.
+func (m *CharacterSheetModel) Undo(ctx context.Context, userID, sheetID int) (*SheetEdit, error) {
+	return m.revert(ctx, userID, sheetID, actionUndo)
+}
+
+// Redo reverts the user's latest undo on the sheet, as long as they have
+// not made a new edit since.
+func (m *CharacterSheetModel) Redo(ctx context.Context, userID, sheetID int) (*SheetEdit, error) {
+	return m.revert(ctx, userID, sheetID, actionRedo)
+}
+
+func (m *CharacterSheetModel) revert(ctx context.Context, userID, sheetID int, kind string) (*SheetEdit, error) {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock before reading the change log, so a concurrent undo waits for
+	// this one and then finds the next write on the stack, not this one.
+	lock, err := lockSheet(ctx, tx, userID, sheetID)
+	if err != nil {
+		return nil, err
+	}
+
+	const writesStmt = `
+		SELECT version, action, coalesce(target_version, 0)
+		FROM character_sheet_changes
+		WHERE sheet_id = $1 AND user_id = $2
+		GROUP BY version, action, target_version
+		ORDER BY version DESC
+		LIMIT $3
+	`
+	rows, err := tx.Query(ctx, writesStmt, sheetID, userID, undoDepth)
+	if err != nil {
+		return nil, err
+	}
+	writes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (loggedWrite, error) {
+		var w loggedWrite
+		err := row.Scan(&w.Version, &w.Action.Kind, &w.Action.Target)
+		return w, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get logged writes: %w", err)
+	}
+	slices.Reverse(writes)
+
+	undo, redo := undoStacks(writes)
+	stack, empty := undo, ErrNothingToUndo
+	if kind == actionRedo {
+		stack, empty = redo, ErrNothingToRedo
+	}
+	if len(stack) == 0 {
+		return nil, empty
+	}
+	target := stack[len(stack)-1]
+
+	const changesStmt = `
+		SELECT path, old_value, new_value
+		FROM character_sheet_changes
+		WHERE sheet_id = $1 AND user_id = $2 AND version = $3
+		ORDER BY id
+	`
+	rows, err = tx.Query(ctx, changesStmt, sheetID, userID, target)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*SheetChange, error) {
+		c := &SheetChange{}
+		err := row.Scan(&c.Path, &c.OldValue, &c.NewValue)
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get changes of version %d: %w", target, err)
+	}
+	paths := make([][]string, len(changes))
+	values := make([]PathValue, len(changes))
+	for i, c := range changes {
+		paths[i] = c.Path
+		values[i] = PathValue{Path: c.Path, Value: c.OldValue}
+	}
+
+	steps := inverseSteps(changes)
+	version, err := lock.write(ctx, tx, userID, target, paths, changeAction{Kind: kind, Target: target}, func(tx pgx.Tx) (int, error) {
+		var version int
+		for _, step := range steps {
+			v, err := step.apply(ctx, tx, userID, sheetID)
+			if err != nil {
+				return 0, err
+			}
+			version = v
+		}
+		return version, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return &SheetEdit{Version: version, Values: values}, nil
+}
+
+// revertStep is one write of an undo or redo, made with the same statement
+// as the edit method it mirrors.
+type revertStep struct {
+	kind   string // "change", "create" or "delete"
+	path   []string
+	layout []string        // for items, the layout entry created or deleted along with them
+	value  json.RawMessage // the value to change to, or the item to create
+	pos    json.RawMessage // the layout position of a created item
+}
+
+func (s revertStep) apply(ctx context.Context, tx pgx.Tx, userID, sheetID int) (int, error) {
+	switch s.kind {
+	case "create":
+		return createItem(ctx, tx, userID, sheetID, s.path, s.layout, s.pos, s.value)
+	case "delete":
+		return deleteItem(ctx, tx, userID, sheetID, s.path, s.layout)
+	}
+	return changeField(ctx, tx, userID, sheetID, s.path, s.value)
+}
+
+// inverseSteps works out the writes that put back the old value of every
+// change a version made. An item created together with its layout entry is
+// deleted as DeleteItem would, one deleted together with it is recreated as
+// CreateItem would; anything else is changed back, or removed when it did
+// not exist before.
+func inverseSteps(changes []*SheetChange) []revertStep {
+	byPath := make(map[string]*SheetChange, len(changes))
+	for _, c := range changes {
+		byPath[pathKey(c.Path)] = c
+	}
+
+	// Items first, so their layout entries are taken whatever order they
+	// were logged in
+	items := make(map[string]revertStep)
+	taken := make(map[string]bool)
+	for _, c := range changes {
+		if len(c.Path) < 2 || c.Path[len(c.Path)-2] != "items" {
+			continue
+		}
+		layout, err := replaceLastSegment(c.Path, "items", "layouts")
+		if err != nil {
+			continue
+		}
+		l, ok := byPath[pathKey(layout)]
+		switch {
+		case !ok:
+		case c.OldValue == nil && l.OldValue == nil:
+			items[pathKey(c.Path)] = revertStep{kind: "delete", path: c.Path, layout: layout}
+			taken[pathKey(layout)] = true
+		case c.NewValue == nil && l.NewValue == nil && l.OldValue != nil:
+			items[pathKey(c.Path)] = revertStep{kind: "create", path: c.Path, layout: layout, value: c.OldValue, pos: l.OldValue}
+			taken[pathKey(layout)] = true
+		}
+	}
+
+	var steps []revertStep
+	for _, c := range changes {
+		key := pathKey(c.Path)
+		switch step, ok := items[key]; {
+		case taken[key]:
+		case ok:
+			steps = append(steps, step)
+		case c.OldValue == nil:
+			steps = append(steps, revertStep{kind: "delete", path: c.Path})
+		default:
+			steps = append(steps, revertStep{kind: "change", path: c.Path, value: c.OldValue})
+		}
+	}
+	return steps
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"charactersheet.iociveteres.net/internal/assert"
+)
+
+func TestUndoStacks(t *testing.T) {
+	edit := func(v int) loggedWrite { return loggedWrite{Version: v, Action: changeAction{Kind: actionEdit}} }
+	undo := func(v, target int) loggedWrite {
+		return loggedWrite{Version: v, Action: changeAction{Kind: actionUndo, Target: target}}
+	}
+	redo := func(v, target int) loggedWrite {
+		return loggedWrite{Version: v, Action: changeAction{Kind: actionRedo, Target: target}}
+	}
+
+	tests := []struct {
+		name     string
+		writes   []loggedWrite
+		wantUndo []int
+		wantRedo []int
+	}{
+		{"edits", []loggedWrite{edit(2), edit(5)}, []int{2, 5}, nil},
+		{"undo", []loggedWrite{edit(2), edit(5), undo(7, 5)}, []int{2}, []int{7}},
+		{"undo twice", []loggedWrite{edit(2), edit(5), undo(7, 5), undo(8, 2)}, nil, []int{7, 8}},
+		{"redo", []loggedWrite{edit(2), edit(5), undo(7, 5), undo(8, 2), redo(9, 8)}, []int{9}, []int{7}},
+		{"undo a redo", []loggedWrite{edit(2), undo(3, 2), redo(4, 3), undo(5, 4)}, nil, []int{5}},
+		{"edit ends redo", []loggedWrite{edit(2), edit(5), undo(7, 5), edit(9)}, []int{2, 9}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUndo, gotRedo := undoStacks(tt.writes)
+			if !slices.Equal(gotUndo, tt.wantUndo) {
+				t.Errorf("undo = %v, want %v", gotUndo, tt.wantUndo)
+			}
+			if !slices.Equal(gotRedo, tt.wantRedo) {
+				t.Errorf("redo = %v, want %v", gotRedo, tt.wantRedo)
+			}
+		})
+	}
+}
+
+func TestInverseSteps(t *testing.T) {
+	change := func(path, old, new string) *SheetChange {
+		c := &SheetChange{Path: strings.Split(path, ".")}
+		if old != "" {
+			c.OldValue = json.RawMessage(old)
+		}
+		if new != "" {
+			c.NewValue = json.RawMessage(new)
+		}
+		return c
+	}
+	describe := func(steps []revertStep) []string {
+		var got []string
+		for _, s := range steps {
+			d := s.kind + " " + pathKey(s.path)
+			if s.layout != nil {
+				d += " with " + pathKey(s.layout)
+			}
+			if s.value != nil {
+				d += " = " + string(s.value)
+			}
+			if s.pos != nil {
+				d += " at " + string(s.pos)
+			}
+			got = append(got, d)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name    string
+		changes []*SheetChange
+		want    []string
+	}{
+		{
+			"field",
+			[]*SheetChange{change("characteristics.WS.value", `"40"`, `"45"`)},
+			[]string{`change characteristics.WS.value = "40"`},
+		},
+		{
+			"new field",
+			[]*SheetChange{change("notes", "", `"x"`)},
+			[]string{"delete notes"},
+		},
+		{
+			"created item",
+			[]*SheetChange{change("gear.items.a", "", `{"name":"rope"}`), change("gear.layouts.a", "", `{"colIndex":0}`)},
+			[]string{"delete gear.items.a with gear.layouts.a"},
+		},
+		{
+			"deleted item, layout logged first",
+			[]*SheetChange{change("gear.layouts.a", `{"colIndex":1}`, ""), change("gear.items.a", `{"name":"rope"}`, "")},
+			[]string{`create gear.items.a with gear.layouts.a = {"name":"rope"} at {"colIndex":1}`},
+		},
+		{
+			"moved item",
+			[]*SheetChange{
+				change("gear.items.a", `{"name":"rope"}`, ""),
+				change("gear.layouts.a", `{"colIndex":1}`, ""),
+				change("pack.items.a", "", `{"name":"rope"}`),
+				change("pack.layouts.a", "", `{"colIndex":0}`),
+			},
+			[]string{
+				`create gear.items.a with gear.layouts.a = {"name":"rope"} at {"colIndex":1}`,
+				"delete pack.items.a with pack.layouts.a",
+			},
+		},
+		{
+			"item changed in place",
+			[]*SheetChange{change("gear.items.a", `{"name":"rope"}`, `{"name":"chain"}`)},
+			[]string{`change gear.items.a = {"name":"rope"}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describe(inverseSteps(tt.changes)); !slices.Equal(got, tt.want) {
+				t.Errorf("inverseSteps = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUndoRedoAgainstDatabase(t *testing.T) {
+	const initial = `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":30}},"gear":{"items":{},"layouts":{}}}`
+	m, userID, sheetID := newTestSheet(t, initial)
+	ctx := context.Background()
+
+	ws := []string{"characteristics", "WS", "value"}
+	state := func(wantVersion int, want string) {
+		t.Helper()
+		content, version := sheetState(t, m, sheetID)
+		assert.Equal(t, content, compactJSON(t, []byte(want)))
+		assert.Equal(t, version, wantVersion)
+	}
+	const (
+		ws30      = `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":30}},"gear":{"items":{},"layouts":{}}}`
+		ws35      = `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":35}},"gear":{"items":{},"layouts":{}}}`
+		ws40      = `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":40}},"gear":{"items":{},"layouts":{}}}`
+		withKnife = `{"characterInfo":{"characterName":"Ada"},"characteristics":{"WS":{"value":40}},"gear":{"items":{"a":{"name":"Knife"}},"layouts":{"a":{"x":0}}}}`
+	)
+
+	for _, value := range []string{`35`, `40`} {
+		if _, err := m.ChangeField(ctx, userID, sheetID, 0, ws, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.CreateItem(ctx, userID, sheetID, []string{"gear", "items"}, "a", json.RawMessage(`{"x":0}`), json.RawMessage(`{"name":"Knife"}`)); err != nil {
+		t.Fatal(err)
+	}
+	state(4, withKnife)
+
+	// Undoing the created item deletes it with its layout entry
+	edit, err := m.Undo(ctx, userID, sheetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, edit.Version, 5)
+	state(5, ws40)
+
+	// Two undos at once each take the next write off the stack: one
+	// reverts WS 35 -> 40, the other WS 30 -> 35.
+	var wg sync.WaitGroup
+	edits := make([]*SheetEdit, 2)
+	errs := make([]error, 2)
+	for i := range edits {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			edits[i], errs[i] = m.Undo(ctx, userID, sheetID)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := []string{string(edits[0].Values[0].Value), string(edits[1].Values[0].Value)}
+	slices.Sort(got)
+	assert.Equal(t, strings.Join(got, " "), "30 35")
+	state(7, ws30)
+
+	_, err = m.Undo(ctx, userID, sheetID)
+	assert.Equal(t, errors.Is(err, ErrNothingToUndo), true)
+
+	// Redo reverts the undos, latest first
+	for _, want := range []struct {
+		version int
+		content string
+	}{{8, ws35}, {9, ws40}, {10, withKnife}} {
+		if _, err := m.Redo(ctx, userID, sheetID); err != nil {
+			t.Fatal(err)
+		}
+		state(want.version, want.content)
+	}
+	_, err = m.Redo(ctx, userID, sheetID)
+	assert.Equal(t, errors.Is(err, ErrNothingToRedo), true)
+
+	// A new edit ends what could be redone, and is the next to undo
+	if _, err := m.Undo(ctx, userID, sheetID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ChangeField(ctx, userID, sheetID, 0, ws, []byte(`50`)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Redo(ctx, userID, sheetID)
+	assert.Equal(t, errors.Is(err, ErrNothingToRedo), true)
+	if _, err := m.Undo(ctx, userID, sheetID); err != nil {
+		t.Fatal(err)
+	}
+	state(13, ws40)
+}
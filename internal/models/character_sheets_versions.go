@@ -0,0 +1,190 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ConflictError is returned by a version-checked write when part of what it
+// would overwrite was changed by someone else after the version the edit
+// was based on. It carries what the client needs to catch up.
+type ConflictError struct {
+	SheetID int
+	Path    string          // the path the rejected write was for
+	Version int             // the sheet's current version
+	Value   json.RawMessage // the current value at Path, null when there is none
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("models: %s changed since the edit was made (now version %d)", e.Path, e.Version)
+}
+
+// pathWrite is the last write to a path: the sheet version it made and the
+// user who made it.
+type pathWrite struct {
+	Version int `json:"v"`
+	UserID  int `json:"u"`
+}
+
+// pathVersions records the last write to every path written to a sheet. A
+// write to a path drops the entries below it, which it supersedes, so the
+// map stays about as large as the sheet.
+type pathVersions map[string]pathWrite
+
+func pathKey(path []string) string {
+	return strings.Join(path, ".")
+}
+
+// overlap reports whether writes to a and b can affect each other: they are
+// the same path or one contains the other.
+func overlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
+
+// conflict returns the first of paths that overlaps a path someone other
+// than userID wrote after baseVersion. A user's own writes never conflict:
+// their next edit is usually sent before the previous one is acknowledged.
+func (pv pathVersions) conflict(userID, baseVersion int, paths [][]string) ([]string, bool) {
+	for _, path := range paths {
+		key := pathKey(path)
+		for written, w := range pv {
+			if w.Version > baseVersion && w.UserID != userID && overlap(key, written) {
+				return path, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// record notes that userID wrote paths at version.
+func (pv pathVersions) record(userID, version int, paths [][]string) {
+	for _, path := range paths {
+		key := pathKey(path)
+		for written := range pv {
+			if strings.HasPrefix(written, key+".") {
+				delete(pv, written)
+			}
+		}
+		pv[key] = pathWrite{Version: version, UserID: userID}
+	}
+}
+
+// checkedWrite runs write in a transaction, rejecting it with a
+// *ConflictError when any of paths was changed after baseVersion, and
+// records that paths changed at the version write returns, in the change
+// log as well. A baseVersion of 0 skips the check, for writes the server
+// makes on its own.
+func (m *CharacterSheetModel) checkedWrite(ctx context.Context, userID, sheetID, baseVersion int, paths [][]string, write func(tx pgx.Tx) (int, error)) (int, error) {
+	return m.checkedWriteAs(ctx, userID, sheetID, baseVersion, paths, changeAction{Kind: actionEdit}, write)
+}
+
+// checkedWriteAs is checkedWrite for writes logged as something other than a
+// plain edit.
+func (m *CharacterSheetModel) checkedWriteAs(ctx context.Context, userID, sheetID, baseVersion int, paths [][]string, action changeAction, write func(tx pgx.Tx) (int, error)) (int, error) {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	lock, err := lockSheet(ctx, tx, userID, sheetID)
+	if err != nil {
+		return 0, err
+	}
+	version, err := lock.write(ctx, tx, userID, baseVersion, paths, action, write)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit transaction: %w", err)
+	}
+	return version, nil
+}
+
+// sheetLock is a character sheet row locked for update in a transaction.
+type sheetLock struct {
+	sheetID int
+	version int
+	pv      pathVersions
+}
+
+// lockSheet locks the sheet for the rest of tx, failing with
+// ErrPermissionDenied when userID may not edit it.
+func lockSheet(ctx context.Context, tx pgx.Tx, userID, sheetID int) (*sheetLock, error) {
+	const lockStmt = `
+		SELECT version, path_versions
+		FROM character_sheets
+		WHERE id = $1 AND can_edit_character_sheet($2, $1)
+		FOR UPDATE
+	`
+	l := &sheetLock{sheetID: sheetID}
+	err := tx.QueryRow(ctx, lockStmt, sheetID, userID).Scan(&l.version, &l.pv)
+	if err == pgx.ErrNoRows {
+		return nil, ErrPermissionDenied
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock character sheet: %w", err)
+	}
+	if l.pv == nil {
+		l.pv = pathVersions{}
+	}
+	return l, nil
+}
+
+// write is the body of checkedWriteAs, run in the transaction holding the
+// lock.
+func (l *sheetLock) write(ctx context.Context, tx pgx.Tx, userID, baseVersion int, paths [][]string, action changeAction, write func(tx pgx.Tx) (int, error)) (int, error) {
+	if baseVersion > 0 && baseVersion < l.version {
+		if path, ok := l.pv.conflict(userID, baseVersion, paths); ok {
+			conflict := &ConflictError{SheetID: l.sheetID, Path: pathKey(path), Version: l.version}
+			const valueStmt = `SELECT coalesce(content #> $1::text[], 'null'::jsonb) FROM character_sheets WHERE id = $2`
+			if err := tx.QueryRow(ctx, valueStmt, path, l.sheetID).Scan(&conflict.Value); err != nil {
+				return 0, fmt.Errorf("get conflicting value: %w", err)
+			}
+			return 0, conflict
+		}
+	}
+
+	changes, err := captureChanges(ctx, tx, l.sheetID, paths)
+	if err != nil {
+		return 0, err
+	}
+	changes.action = action
+	version, err := write(tx)
+	if err != nil {
+		return 0, err
+	}
+	if err := changes.log(ctx, tx, userID, version); err != nil {
+		return 0, err
+	}
+	if err := recordPathVersions(ctx, tx, userID, l.sheetID, version, l.pv, paths); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// recordPathVersions saves that userID wrote paths at version, on top of pv
+// as read earlier in the same transaction; a nil pv is read first.
+func recordPathVersions(ctx context.Context, tx pgx.Tx, userID, sheetID, version int, pv pathVersions, paths [][]string) error {
+	if pv == nil {
+		const getStmt = `SELECT path_versions FROM character_sheets WHERE id = $1`
+		if err := tx.QueryRow(ctx, getStmt, sheetID).Scan(&pv); err != nil {
+			return fmt.Errorf("get path versions: %w", err)
+		}
+		if pv == nil {
+			pv = pathVersions{}
+		}
+	}
+	pv.record(userID, version, paths)
+
+	const saveStmt = `UPDATE character_sheets SET path_versions = $2 WHERE id = $1`
+	if _, err := tx.Exec(ctx, saveStmt, sheetID, pv); err != nil {
+		return fmt.Errorf("save path versions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPathVersionsConflict(t *testing.T) {
+	pv := pathVersions{}
+	pv.record(1, 10, [][]string{{"characteristics", "WS", "value"}})
+	pv.record(2, 11, [][]string{{"gear", "items", "abc"}})
+
+	tests := []struct {
+		name        string
+		userID      int
+		baseVersion int
+		path        []string
+		want        bool
+	}{
+		{"same path", 2, 9, []string{"characteristics", "WS", "value"}, true},
+		{"ancestor", 2, 9, []string{"characteristics"}, true},
+		{"descendant", 1, 10, []string{"gear", "items", "abc", "name"}, true},
+		{"sibling", 2, 9, []string{"characteristics", "BS", "value"}, false},
+		{"shared prefix", 2, 9, []string{"characteristics", "WS", "valueUnnatural"}, false},
+		{"seen already", 2, 10, []string{"characteristics", "WS", "value"}, false},
+		{"own write", 1, 9, []string{"characteristics", "WS", "value"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, got := pv.conflict(tt.userID, tt.baseVersion, [][]string{tt.path})
+			if got != tt.want {
+				t.Fatalf("conflict = %v, want %v", got, tt.want)
+			}
+			if got && !slices.Equal(path, tt.path) {
+				t.Errorf("path = %v, want %v", path, tt.path)
+			}
+		})
+	}
+}
+
+func TestPathVersionsRecordSupersedes(t *testing.T) {
+	pv := pathVersions{}
+	pv.record(1, 10, [][]string{{"gear", "items", "abc", "name"}, {"gear", "items", "abd"}})
+	pv.record(1, 11, [][]string{{"gear", "items", "abc"}})
+
+	want := pathVersions{
+		"gear.items.abc": {Version: 11, UserID: 1},
+		"gear.items.abd": {Version: 10, UserID: 1},
+	}
+	if len(pv) != len(want) {
+		t.Fatalf("pathVersions = %v, want %v", pv, want)
+	}
+	for k, w := range want {
+		if pv[k] != w {
+			t.Errorf("pathVersions[%s] = %v, want %v", k, pv[k], w)
+		}
+	}
+}
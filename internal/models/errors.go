@@ -5,12 +5,18 @@ import (
 )
 
 var (
-	ErrNoRecord           = errors.New("models: no matching record found")
-	ErrInvalidCredentials = errors.New("models: invalid credentials")
-	ErrUserNotActivated   = errors.New("models: email is not verified")
-	ErrDuplicateEmail     = errors.New("models: duplicate email")
-	ErrNoContent          = errors.New("models: character sheet has no content")
-	ErrBadType            = errors.New("models: incoming value has wrong JSON type for path")
-	ErrLinkInvalid        = errors.New("models: invite link is invalid or expired")
-	ErrPermissionDenied   = errors.New("models: permission denied")
+	ErrNoRecord             = errors.New("models: no matching record found")
+	ErrInvalidCredentials   = errors.New("models: invalid credentials")
+	ErrUserNotActivated     = errors.New("models: email is not verified")
+	ErrDuplicateEmail       = errors.New("models: duplicate email")
+	ErrNoContent            = errors.New("models: character sheet has no content")
+	ErrBadType              = errors.New("models: incoming value has wrong JSON type for path")
+	ErrLinkInvalid          = errors.New("models: invite link is invalid or expired")
+	ErrPermissionDenied     = errors.New("models: permission denied")
+	ErrInsufficientArcana   = errors.New("models: not enough cognition or energy")
+	ErrInitiativeEmpty      = errors.New("models: no one is in the initiative order")
+	ErrInitiativeNotDelayed = errors.New("models: initiative entry is not delaying")
+	ErrNothingToUndo        = errors.New("models: no edit to undo")
+	ErrNothingToRedo        = errors.New("models: no undone edit to redo")
+	ErrAttackResolved       = errors.New("models: damage was already rolled for this attack")
 )
@@ -0,0 +1,55 @@
+package mocks
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+// Sheet 1 belongs to user 1 in room 1. Sheet 2 is in room 2, which user 1
+// cannot view. No other sheet exists.
+//
+// Methods the handler tests do not reach are left to the embedded
+// interface and panic if called.
+type CharacterSheetModel struct {
+	models.CharacterSheetModelInterface
+}
+
+var mockCharacterSheet = &models.CharacterSheet{
+	ID:            1,
+	OwnerID:       1,
+	RoomID:        1,
+	CharacterName: "Vex",
+	Content:       json.RawMessage(`{"characterInfo": {"characterName": "Vex"}}`),
+	Version:       1,
+	CreatedAt:     time.Now(),
+	UpdatedAt:     time.Now(),
+}
+
+func (m *CharacterSheetModel) Get(ctx context.Context, id int) (*models.CharacterSheet, error) {
+	switch id {
+	case 1:
+		return mockCharacterSheet, nil
+	case 2:
+		return &models.CharacterSheet{ID: 2, OwnerID: 2, RoomID: 2, Content: json.RawMessage(`{}`)}, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *CharacterSheetModel) GetWithPermission(ctx context.Context, userID, sheetID int) (*models.CharacterSheetView, error) {
+	switch {
+	case sheetID == 1 && userID == 1:
+		return &models.CharacterSheetView{CharacterSheet: mockCharacterSheet, CanView: true, CanEdit: true}, nil
+	case sheetID == 1 || sheetID == 2:
+		return nil, models.ErrPermissionDenied
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *CharacterSheetModel) InsertWithContent(ctx context.Context, ownerID, roomID int, content json.RawMessage) (int, error) {
+	return 3, nil
+}
@@ -0,0 +1,45 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+// Room 1 has user 1 as its gamemaster. Room 2 exists but user 1 is not in
+// it. No other room exists.
+type RoomModel struct{}
+
+func (m *RoomModel) Create(ctx context.Context, userID int, name string) (int, error) {
+	return 1, nil
+}
+
+func (m *RoomModel) Get(ctx context.Context, id int) (*models.Room, error) {
+	switch id {
+	case 1, 2:
+		return &models.Room{ID: id, OwnerID: id, Name: "Room", CreatedAt: time.Now()}, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *RoomModel) Remove(ctx context.Context, roomID int, requestingUserID int) error {
+	return nil
+}
+
+func (m *RoomModel) ByUser(ctx context.Context, userID int) ([]*models.Room, error) {
+	return nil, nil
+}
+
+func (m *RoomModel) ByUserWithRole(ctx context.Context, userID int) ([]*models.RoomWithRole, error) {
+	return nil, nil
+}
+
+func (m *RoomModel) HasUser(ctx context.Context, roomID int, userID int) (bool, error) {
+	return roomID == 1 && userID == 1, nil
+}
+
+func (m *RoomModel) PlayersWithSheets(ctx context.Context, roomID int) ([]*models.PlayerView, error) {
+	return nil, nil
+}
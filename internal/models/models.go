@@ -15,6 +15,7 @@ type Models struct {
 	RoomInvites           RoomInvitesInterface
 	RoomMessages          RoomMessagesModelInterface
 	RoomDicePresets       RoomDicePresetsModelInterface
+	RoomInitiative        RoomInitiativeModelInterface
 	Tokens                TokenModelInterface
 	db                    *pgxpool.Pool
 }
@@ -29,6 +30,7 @@ func NewModels(db *pgxpool.Pool) Models {
 		RoomInvites:           &RoomInviteModel{DB: db},
 		RoomMessages:          &RoomMessagesModel{DB: db},
 		RoomDicePresets:       &RoomDicePresetsModel{DB: db},
+		RoomInitiative:        &RoomInitiativeModel{DB: db},
 		Tokens:                &TokenModel{DB: db},
 	}
 }
@@ -0,0 +1,258 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// InitiativeEntry is one combatant in a room's turn order: a character
+// sheet of the room, or an NPC the gamemaster typed in.
+type InitiativeEntry struct {
+	ID         string `json:"id"`
+	SheetID    int    `json:"sheetId,omitempty"`
+	Name       string `json:"name"`
+	Expression string `json:"expression"`           // what initiative is rolled with, e.g. "d10+4"
+	Initiative *int   `json:"initiative,omitempty"` // nil until rolled
+	Roll       string `json:"roll,omitempty"`       // the breakdown of the last roll
+	Delayed    bool   `json:"delayed,omitempty"`    // holding their action this round
+}
+
+// InitiativeTracker is the turn order of a room's encounter. Round is 0
+// until the first turn is taken.
+type InitiativeTracker struct {
+	RoomID    int               `json:"roomId"`
+	Round     int               `json:"round"`
+	Current   string            `json:"current,omitempty"` // ID of the entry whose turn it is
+	Entries   []InitiativeEntry `json:"entries"`
+	Version   int               `json:"version"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+type RoomInitiativeModelInterface interface {
+	Get(ctx context.Context, roomID int) (*InitiativeTracker, error)
+	Update(ctx context.Context, callerID, roomID int, update func(*InitiativeTracker) error) (*InitiativeTracker, error)
+}
+
+type RoomInitiativeModel struct {
+	DB *pgxpool.Pool
+}
+
+// Get returns the room's tracker, or an empty one when the room has never
+// had an encounter.
+func (m *RoomInitiativeModel) Get(ctx context.Context, roomID int) (*InitiativeTracker, error) {
+	const stmt = `
+SELECT round, coalesce(current_entry, ''), entries, version, updated_at
+FROM initiative_trackers
+WHERE room_id = $1;
+`
+	rows, err := m.DB.Query(ctx, stmt, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	t := &InitiativeTracker{RoomID: roomID, Entries: []InitiativeEntry{}}
+	if rows.Next() {
+		var entries []byte
+		if err := rows.Scan(&t.Round, &t.Current, &entries, &t.Version, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(entries, &t.Entries); err != nil {
+			return nil, fmt.Errorf("unmarshal initiative entries: %w", err)
+		}
+	}
+	return t, rows.Err()
+}
+
+// Update applies update to the room's tracker and saves the result. Only a
+// gamemaster of the room may change it; the tracker stays locked while
+// update runs, so update should not do any slow work of its own.
+func (m *RoomInitiativeModel) Update(ctx context.Context, callerID, roomID int, update func(*InitiativeTracker) error) (*InitiativeTracker, error) {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var isGM bool
+	err = tx.QueryRow(ctx, `SELECT has_sufficient_role($1, $2, 'gamemaster')`, callerID, roomID).Scan(&isGM)
+	if err != nil {
+		return nil, err
+	}
+	if !isGM {
+		return nil, ErrPermissionDenied
+	}
+
+	const lockStmt = `
+INSERT INTO initiative_trackers (room_id) VALUES ($1)
+ON CONFLICT (room_id) DO UPDATE SET room_id = EXCLUDED.room_id
+RETURNING round, coalesce(current_entry, ''), entries, version;
+`
+	t := &InitiativeTracker{RoomID: roomID}
+	var entries []byte
+	if err := tx.QueryRow(ctx, lockStmt, roomID).Scan(&t.Round, &t.Current, &entries, &t.Version); err != nil {
+		return nil, fmt.Errorf("lock initiative tracker: %w", err)
+	}
+	if err := json.Unmarshal(entries, &t.Entries); err != nil {
+		return nil, fmt.Errorf("unmarshal initiative entries: %w", err)
+	}
+
+	if err := update(t); err != nil {
+		return nil, err
+	}
+	if t.Entries == nil {
+		t.Entries = []InitiativeEntry{}
+	}
+
+	entries, err = json.Marshal(t.Entries)
+	if err != nil {
+		return nil, err
+	}
+	const saveStmt = `
+UPDATE initiative_trackers
+SET round = $2, current_entry = nullif($3, ''), entries = $4, version = version + 1, updated_at = now()
+WHERE room_id = $1
+RETURNING version, updated_at;
+`
+	if err := tx.QueryRow(ctx, saveStmt, roomID, t.Round, t.Current, entries).Scan(&t.Version, &t.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("save initiative tracker: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return t, nil
+}
+
+// Entry returns the entry with the given ID.
+func (t *InitiativeTracker) Entry(id string) (*InitiativeEntry, error) {
+	i := t.index(id)
+	if i < 0 {
+		return nil, ErrNoRecord
+	}
+	return &t.Entries[i], nil
+}
+
+func (t *InitiativeTracker) index(id string) int {
+	return slices.IndexFunc(t.Entries, func(e InitiativeEntry) bool { return e.ID == id })
+}
+
+// Sort puts the entries in turn order, highest initiative first. Ties and
+// entries not rolled yet keep their current order, the latter at the end.
+func (t *InitiativeTracker) Sort() {
+	slices.SortStableFunc(t.Entries, func(a, b InitiativeEntry) int {
+		switch {
+		case a.Initiative == nil && b.Initiative == nil:
+			return 0
+		case a.Initiative == nil:
+			return 1
+		case b.Initiative == nil:
+			return -1
+		}
+		return *b.Initiative - *a.Initiative
+	})
+}
+
+// Next passes the turn to the next entry that is not delayed, starting the
+// first round or the next one as needed. A new round ends every delay.
+func (t *InitiativeTracker) Next() error {
+	if len(t.Entries) == 0 {
+		return ErrInitiativeEmpty
+	}
+
+	i := -1
+	if t.Round == 0 {
+		t.Round = 1
+	} else {
+		i = t.index(t.Current)
+	}
+	for {
+		i++
+		if i == len(t.Entries) {
+			t.Round++
+			for j := range t.Entries {
+				t.Entries[j].Delayed = false
+			}
+			i = 0
+		}
+		if !t.Entries[i].Delayed {
+			t.Current = t.Entries[i].ID
+			return nil
+		}
+	}
+}
+
+// Delay has the entry hold its action; when it is their turn the turn
+// passes on.
+func (t *InitiativeTracker) Delay(id string) error {
+	e, err := t.Entry(id)
+	if err != nil {
+		return err
+	}
+	e.Delayed = true
+	if t.Current == id {
+		return t.Next()
+	}
+	return nil
+}
+
+// Act has a delayed entry take its action now: it moves in front of the
+// entry whose turn it is and takes the turn. Entries that are not holding
+// their action get ErrInitiativeNotDelayed.
+func (t *InitiativeTracker) Act(id string) error {
+	from := t.index(id)
+	if from < 0 {
+		return ErrNoRecord
+	}
+	e := t.Entries[from]
+	if !e.Delayed {
+		return ErrInitiativeNotDelayed
+	}
+	e.Delayed = false
+
+	if t.Round == 0 || id == t.Current || t.index(t.Current) < 0 {
+		t.Entries[from] = e
+		return nil
+	}
+	t.Entries = slices.Delete(t.Entries, from, from+1)
+	to := t.index(t.Current)
+	t.Entries = slices.Insert(t.Entries, to, e)
+	t.Current = id
+	return nil
+}
+
+// Remove takes the entry out of the turn order, passing the turn on when
+// it was theirs. Removing the last entry ends the encounter.
+func (t *InitiativeTracker) Remove(id string) error {
+	if t.index(id) < 0 {
+		return ErrNoRecord
+	}
+	if t.Current == id && len(t.Entries) > 1 {
+		if err := t.Next(); err != nil {
+			return err
+		}
+	}
+	i := t.index(id)
+	t.Entries = slices.Delete(t.Entries, i, i+1)
+
+	switch {
+	case len(t.Entries) == 0:
+		t.Clear()
+	case t.Current == id:
+		// Everyone else was delayed, so the new round came back round to them
+		t.Current = t.Entries[0].ID
+	}
+	return nil
+}
+
+// Clear ends the encounter, removing every entry.
+func (t *InitiativeTracker) Clear() {
+	t.Round = 0
+	t.Current = ""
+	t.Entries = []InitiativeEntry{}
+}
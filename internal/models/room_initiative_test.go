@@ -0,0 +1,113 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func newTestTracker(initiatives ...int) *InitiativeTracker {
+	t := &InitiativeTracker{}
+	for i, v := range initiatives {
+		t.Entries = append(t.Entries, InitiativeEntry{ID: string(rune('a' + i)), Initiative: &v})
+	}
+	return t
+}
+
+func trackerOrder(t *InitiativeTracker) string {
+	var ids []byte
+	for _, e := range t.Entries {
+		ids = append(ids, e.ID...)
+	}
+	return string(ids)
+}
+
+func TestInitiativeTrackerSort(t *testing.T) {
+	tracker := newTestTracker(5, 12, 5, 20)
+	tracker.Entries = append(tracker.Entries, InitiativeEntry{ID: "e"})
+	tracker.Entries = slices.Insert(tracker.Entries, 0, InitiativeEntry{ID: "f"})
+	tracker.Sort()
+	if got := trackerOrder(tracker); got != "dbacfe" {
+		t.Errorf("order = %s, want dbacfe", got)
+	}
+}
+
+func TestInitiativeTrackerTurns(t *testing.T) {
+	tracker := newTestTracker(20, 15, 10)
+
+	var turns []string
+	for range 4 {
+		if err := tracker.Next(); err != nil {
+			t.Fatal(err)
+		}
+		turns = append(turns, tracker.Current)
+	}
+	if !slices.Equal(turns, []string{"a", "b", "c", "a"}) || tracker.Round != 2 {
+		t.Errorf("turns = %v, round %d", turns, tracker.Round)
+	}
+
+	// b holds their action, then acts in front of c
+	if err := tracker.Delay("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Next(); err != nil || tracker.Current != "c" {
+		t.Fatalf("after a came %s, %v", tracker.Current, err)
+	}
+	if err := tracker.Act("b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := trackerOrder(tracker); got != "abc" || tracker.Current != "b" {
+		t.Errorf("order = %s, current %s", got, tracker.Current)
+	}
+
+	// Delaying on their own turn passes it on; a new round ends the delay
+	if err := tracker.Delay("b"); err != nil || tracker.Current != "c" {
+		t.Fatalf("current = %s, %v", tracker.Current, err)
+	}
+	if err := tracker.Next(); err != nil || tracker.Current != "a" || tracker.Round != 3 || tracker.Entries[1].Delayed {
+		t.Errorf("new round: current %s, round %d, entries %+v, %v", tracker.Current, tracker.Round, tracker.Entries, err)
+	}
+}
+
+func TestInitiativeTrackerActRequiresDelay(t *testing.T) {
+	tracker := newTestTracker(20, 15, 10)
+	for range 3 {
+		if err := tracker.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a and b have acted this round; neither may jump in front of c again
+	for _, id := range []string{"a", "b", "c"} {
+		if err := tracker.Act(id); !errors.Is(err, ErrInitiativeNotDelayed) {
+			t.Errorf("Act(%s) = %v, want ErrInitiativeNotDelayed", id, err)
+		}
+	}
+	if got := trackerOrder(tracker); got != "abc" || tracker.Current != "c" {
+		t.Errorf("order = %s, current %s, want abc with c current", got, tracker.Current)
+	}
+	if err := tracker.Act("z"); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Act(z) = %v, want ErrNoRecord", err)
+	}
+}
+
+func TestInitiativeTrackerRemove(t *testing.T) {
+	tracker := newTestTracker(20, 15, 10)
+	if err := tracker.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Remove("a"); err != nil || tracker.Current != "b" || trackerOrder(tracker) != "bc" {
+		t.Errorf("current = %s, order %s, %v", tracker.Current, trackerOrder(tracker), err)
+	}
+	if err := tracker.Remove("missing"); err != ErrNoRecord {
+		t.Errorf("removing a missing entry = %v", err)
+	}
+	tracker.Remove("b")
+	tracker.Remove("c")
+	if tracker.Round != 0 || tracker.Current != "" || len(tracker.Entries) != 0 {
+		t.Errorf("empty tracker = %+v", tracker)
+	}
+	if err := tracker.Next(); err != ErrInitiativeEmpty {
+		t.Errorf("next on an empty tracker = %v", err)
+	}
+}
@@ -3,9 +3,11 @@ package models
 import (
 	"context"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -14,6 +16,7 @@ type RoomMembersInterface interface {
 	Remove(ctx context.Context, callerID, roomID, userID int) error
 	GetRole(ctx context.Context, roomID, userID int) (RoomRole, error)
 	ChangeRole(ctx context.Context, callerID, roomID, userID int, role RoomRole) error
+	ListWithNames(ctx context.Context, roomID int) ([]*NamedRoomMember, error)
 }
 
 type RoomMember struct {
@@ -23,6 +26,12 @@ type RoomMember struct {
 	JoinedAt time.Time `db:"joined_at"`
 }
 
+// NamedRoomMember is a room member together with their user name.
+type NamedRoomMember struct {
+	RoomMember
+	UserName string
+}
+
 type RoomMembersModel struct {
 	DB *pgxpool.Pool
 }
@@ -35,6 +44,19 @@ const (
 	RolePlayer     RoomRole = "player"
 )
 
+// roleRanks orders roles the way has_sufficient_role does.
+var roleRanks = map[RoomRole]int{
+	RolePlayer:     1,
+	RoleModerator:  2,
+	RoleGamemaster: 3,
+}
+
+// AtLeast reports whether r is the required role or a higher one.
+func (r RoomRole) AtLeast(required RoomRole) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[required]
+}
+
 func (r *RoomRole) Scan(src interface{}) error {
 	if src == nil {
 		*r = ""
@@ -98,6 +120,9 @@ WHERE room_id = $1 AND user_id = $2;
 	var role RoomRole
 	row := m.DB.QueryRow(ctx, stmt, roomID, userID)
 	if err := row.Scan(&role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNoRecord
+		}
 		return "", err
 	}
 	return role, nil
@@ -120,3 +145,34 @@ WHERE room_id = $1
 	}
 	return nil
 }
+
+// ListWithNames returns every member of the room with their user name,
+// in the order they joined.
+func (m *RoomMembersModel) ListWithNames(ctx context.Context, roomID int) ([]*NamedRoomMember, error) {
+	const stmt = `
+SELECT rm.room_id, rm.user_id, rm.role, rm.joined_at, u.name
+FROM room_members rm
+JOIN users u ON u.id = rm.user_id
+WHERE rm.room_id = $1
+ORDER BY rm.joined_at ASC;
+`
+	rows, err := m.DB.Query(ctx, stmt, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*NamedRoomMember
+	for rows.Next() {
+		rm := &NamedRoomMember{}
+		if err := rows.Scan(&rm.RoomID, &rm.UserID, &rm.Role, &rm.JoinedAt, &rm.UserName); err != nil {
+			return nil, err
+		}
+		members = append(members, rm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
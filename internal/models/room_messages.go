@@ -12,26 +12,132 @@ import (
 )
 
 type RoomMessagesModelInterface interface {
-	Create(ctx context.Context, userID, roomID int, messageBody string, commandResult *string) (int, time.Time, error)
+	Create(ctx context.Context, userID, roomID int, msg NewMessage) (int, time.Time, error)
 	Get(ctx context.Context, id int) (*Message, error)
 	Remove(ctx context.Context, callerID, roomID, messageID int) error
 
 	// DTO
 	// is this even ok? it's convenient
-	CreateWithUsername(ctx context.Context, userID, roomID int, messageBody string, commandResult *string) (MessageWithName, error)
+	CreateWithUsername(ctx context.Context, userID, roomID int, msg NewMessage) (MessageWithName, error)
 	// GetPage returns messages for a room using offset pagination: from..to (inclusive)
 	// The returned messages are ordered from newest -> oldest
 	// The maximum number of messages returned is 50 (clamped)
-	GetMessagePage(ctx context.Context, roomID int, offset int, limit int) (*MessagePage, error)
+	// Whispers are only included when viewerID sent or received them
+	GetMessagePage(ctx context.Context, roomID, viewerID int, offset int, limit int) (*MessagePage, error)
+	// GetRollAudit returns a message with the inputs its roll was made from.
+	// Only gamemasters of the room may read it.
+	GetRollAudit(ctx context.Context, callerID, roomID, messageID int) (*MessageRollAudit, error)
+	// ResolveAttack marks an attack roll as resolved once its damage is rolled.
+	ResolveAttack(ctx context.Context, userID, roomID, messageID int) error
+	// RollStats aggregates the rolls made in a room between from and to,
+	// counting only the secret rolls the viewer may see.
+	RollStats(ctx context.Context, roomID, viewerID int, viewerRole RoomRole, from, to time.Time) (*RoomRollStats, error)
 }
 
 type Message struct {
-	ID            int       `json:"id"`
-	RoomID        int       `json:"roomId"`
-	UserID        int       `json:"userId"`
-	MessageBody   string    `json:"messageBody"`
-	CommandResult *string   `json:"commandResult,omitempty"`
-	CreatedAt     time.Time `json:"createdAt"`
+	ID            int               `json:"id"`
+	RoomID        int               `json:"roomId"`
+	UserID        int               `json:"userId"`
+	MessageBody   string            `json:"messageBody"`
+	CommandResult *string           `json:"commandResult,omitempty"`
+	CommandData   json.RawMessage   `json:"commandData,omitempty"` // structured result, nil for older messages
+	Recipients    []int             `json:"recipients,omitempty"`  // whisper recipients, nil for public messages
+	Visibility    MessageVisibility `json:"visibility"`
+	Redacted      bool              `json:"redacted,omitempty"` // set on copies hidden from the viewer, never stored
+	CreatedAt     time.Time         `json:"createdAt"`
+}
+
+// MessageVisibility controls who sees the content of a message, usually a roll.
+type MessageVisibility string
+
+const (
+	// MessagePublic messages are seen by the whole room.
+	MessagePublic MessageVisibility = "public"
+	// MessageGMOnly messages are seen by the sender and the gamemasters.
+	MessageGMOnly MessageVisibility = "gm"
+	// MessageBlind messages are seen by the gamemasters only, not even the sender.
+	MessageBlind MessageVisibility = "blind"
+	// MessageSelf messages are seen by the sender only.
+	MessageSelf MessageVisibility = "self"
+)
+
+func (v MessageVisibility) IsValid() bool {
+	switch v {
+	case MessagePublic, MessageGMOnly, MessageBlind, MessageSelf:
+		return true
+	}
+	return false
+}
+
+// VisibleTo reports whether a viewer with the given role may see the content
+// of the message. Everyone else gets the Redacted copy.
+func (m *Message) VisibleTo(viewerID int, role RoomRole) bool {
+	switch m.Visibility {
+	case MessageGMOnly:
+		return viewerID == m.UserID || role == RoleGamemaster
+	case MessageBlind:
+		return role == RoleGamemaster
+	case MessageSelf:
+		return viewerID == m.UserID
+	}
+	return true
+}
+
+// Redacted returns a copy of the message with its content replaced by a
+// "X rolled secretly" placeholder.
+func (m MessageWithName) Redacted() MessageWithName {
+	m.Message.MessageBody = m.Username + " rolled secretly"
+	m.Message.CommandResult = nil
+	m.Message.CommandData = nil
+	m.Message.Redacted = true
+	return m
+}
+
+// RedactFor replaces every message of the page the viewer may not see with
+// its redacted copy.
+func (p *MessagePage) RedactFor(viewerID int, role RoomRole) {
+	for i := range p.Messages {
+		if !p.Messages[i].Message.VisibleTo(viewerID, role) {
+			p.Messages[i] = p.Messages[i].Redacted()
+		}
+	}
+}
+
+// NewMessage is what gets stored for a new chat message.
+type NewMessage struct {
+	MessageBody   string
+	CommandResult *string
+	CommandData   json.RawMessage
+	Recipients    []int             // nil for messages visible to the whole room
+	Visibility    MessageVisibility // empty means MessagePublic
+	Audit         *RollAudit        // nil for messages without a roll
+}
+
+// RollAudit is what a roll was made from, kept so a gamemaster can replay a
+// disputed result.
+type RollAudit struct {
+	Seed []byte `json:"seed"`
+	Dice []int  `json:"dice"` // every die value drawn, in order
+}
+
+// MessageRollAudit is a stored roll message together with its audit trail.
+type MessageRollAudit struct {
+	Message Message   `json:"message"`
+	Audit   RollAudit `json:"audit"`
+}
+
+func (msg NewMessage) auditColumns() (seed []byte, dice []int) {
+	if msg.Audit == nil {
+		return nil, nil
+	}
+	return msg.Audit.Seed, msg.Audit.Dice
+}
+
+func (msg NewMessage) visibility() MessageVisibility {
+	if msg.Visibility == "" {
+		return MessagePublic
+	}
+	return msg.Visibility
 }
 
 type MessageWithName struct {
@@ -61,19 +167,22 @@ func (m Message) MarshalJSON() ([]byte, error) {
 	})
 }
 
-func (m *RoomMessagesModel) Create(ctx context.Context, userID, roomID int, messageBody string, commandResult *string) (int, time.Time, error) {
+func (m *RoomMessagesModel) Create(ctx context.Context, userID, roomID int, msg NewMessage) (int, time.Time, error) {
 	const stmt = `
-INSERT INTO room_messages (room_id, user_id, message_body, command_result)
-VALUES ($1, $2, $3, $4)
+INSERT INTO room_messages (room_id, user_id, message_body, command_result, command_data, recipients, visibility,
+                           roll_seed, roll_dice)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 RETURNING id, created_at;
 `
 
 	var cmd sql.NullString
-	if commandResult != nil {
-		cmd = sql.NullString{String: *commandResult, Valid: true}
+	if msg.CommandResult != nil {
+		cmd = sql.NullString{String: *msg.CommandResult, Valid: true}
 	}
 
-	row := m.DB.QueryRow(ctx, stmt, roomID, userID, messageBody, cmd)
+	seed, dice := msg.auditColumns()
+	row := m.DB.QueryRow(ctx, stmt, roomID, userID, msg.MessageBody, cmd, msg.CommandData, msg.Recipients, msg.visibility(),
+		seed, dice)
 
 	var id int64
 	var createdAt time.Time
@@ -84,19 +193,22 @@ RETURNING id, created_at;
 	return int(id), createdAt, nil
 }
 
-func (m *RoomMessagesModel) CreateWithUsername(ctx context.Context, userID, roomID int, messageBody string, commandResult *string) (MessageWithName, error) {
+func (m *RoomMessagesModel) CreateWithUsername(ctx context.Context, userID, roomID int, msg NewMessage) (MessageWithName, error) {
 	const stmt = `
 WITH inserted AS (
-    INSERT INTO room_messages (room_id, user_id, message_body, command_result)
-    VALUES ($1, $2, $3, $4)
-    RETURNING id, room_id, user_id, message_body, command_result, created_at
+    INSERT INTO room_messages (room_id, user_id, message_body, command_result, command_data, recipients, visibility,
+                               roll_seed, roll_dice)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+    RETURNING id, room_id, user_id, message_body, command_result, command_data, recipients, visibility, created_at
 )
-SELECT i.id, i.room_id, i.user_id, i.message_body, i.command_result, i.created_at, u.name
+SELECT i.id, i.room_id, i.user_id, i.message_body, i.command_result, i.command_data, i.recipients, i.visibility, i.created_at, u.name
 FROM inserted i
 JOIN users u ON u.id = i.user_id;
 `
 
-	row := m.DB.QueryRow(ctx, stmt, roomID, userID, messageBody, commandResult)
+	seed, dice := msg.auditColumns()
+	row := m.DB.QueryRow(ctx, stmt, roomID, userID, msg.MessageBody, msg.CommandResult, msg.CommandData, msg.Recipients, msg.visibility(),
+		seed, dice)
 
 	var (
 		id                int64
@@ -106,9 +218,12 @@ JOIN users u ON u.id = i.user_id;
 		createdAt         time.Time
 		username          string
 		commandResultNull sql.NullString
+		commandDataOut    []byte
+		recipients        []int
+		visibility        MessageVisibility
 	)
 
-	if err := row.Scan(&id, &roomIDOut, &userIDOut, &body, &commandResultNull, &createdAt, &username); err != nil {
+	if err := row.Scan(&id, &roomIDOut, &userIDOut, &body, &commandResultNull, &commandDataOut, &recipients, &visibility, &createdAt, &username); err != nil {
 		return MessageWithName{}, err
 	}
 
@@ -120,24 +235,27 @@ JOIN users u ON u.id = i.user_id;
 		cmdResult = nil
 	}
 
-	msg := Message{
+	created := Message{
 		ID:            int(id),
 		RoomID:        roomIDOut,
 		UserID:        userIDOut,
 		MessageBody:   body,
 		CommandResult: cmdResult,
+		CommandData:   commandDataOut,
+		Recipients:    recipients,
+		Visibility:    visibility,
 		CreatedAt:     createdAt,
 	}
 
 	return MessageWithName{
-		Message:  msg,
+		Message:  created,
 		Username: username,
 	}, nil
 }
 
 func (m *RoomMessagesModel) Get(ctx context.Context, id int) (*Message, error) {
 	const stmt = `
-SELECT id, room_id, user_id, message_body, created_at
+SELECT id, room_id, user_id, message_body, command_result, command_data, recipients, visibility, created_at
 FROM room_messages
 WHERE id = $1;
 `
@@ -150,6 +268,10 @@ WHERE id = $1;
 		&msg.RoomID,
 		&msg.UserID,
 		&msg.MessageBody,
+		&msg.CommandResult,
+		&msg.CommandData,
+		&msg.Recipients,
+		&msg.Visibility,
 		&msg.CreatedAt,
 	); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -161,6 +283,64 @@ WHERE id = $1;
 	return msg, nil
 }
 
+// ResolveAttack marks the attack roll messageID, posted by userID in roomID,
+// as resolved so damage is rolled for it only once. It returns
+// ErrAttackResolved when it already was.
+func (m *RoomMessagesModel) ResolveAttack(ctx context.Context, userID, roomID, messageID int) error {
+	const stmt = `
+UPDATE room_messages
+SET command_data = jsonb_set(command_data, '{attack,resolved}', 'true'::jsonb)
+WHERE id = $1
+  AND room_id = $2
+  AND user_id = $3
+  AND command_data ? 'attack'
+  AND NOT coalesce((command_data #>> '{attack,resolved}')::boolean, false);
+`
+	ct, err := m.DB.Exec(ctx, stmt, messageID, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrAttackResolved
+	}
+	return nil
+}
+
+func (m *RoomMessagesModel) GetRollAudit(ctx context.Context, callerID, roomID, messageID int) (*MessageRollAudit, error) {
+	const stmt = `
+SELECT id, room_id, user_id, message_body, command_result, command_data, recipients, visibility, created_at,
+       roll_seed, roll_dice
+FROM room_messages
+WHERE room_id = $1
+  AND id = $2
+  AND roll_seed IS NOT NULL
+  AND has_sufficient_role($3, $1, 'gamemaster');
+`
+	row := m.DB.QueryRow(ctx, stmt, roomID, messageID, callerID)
+
+	a := &MessageRollAudit{}
+	if err := row.Scan(
+		&a.Message.ID,
+		&a.Message.RoomID,
+		&a.Message.UserID,
+		&a.Message.MessageBody,
+		&a.Message.CommandResult,
+		&a.Message.CommandData,
+		&a.Message.Recipients,
+		&a.Message.Visibility,
+		&a.Message.CreatedAt,
+		&a.Audit.Seed,
+		&a.Audit.Dice,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return a, nil
+}
+
 func (m *RoomMessagesModel) Remove(ctx context.Context, callerID, roomID, messageID int) error {
 	const stmt = `
 DELETE FROM room_messages
@@ -179,9 +359,10 @@ WHERE room_id = $1
 }
 
 // GetMessagePage returns messages for a room using offset-based pagination
+// viewerID: user the page is for; whispers they are not part of are skipped
 // offset: number of messages to skip from the most recent
 // limit: maximum number of messages to return
-func (m *RoomMessagesModel) GetMessagePage(ctx context.Context, roomID int, offset int, limit int) (*MessagePage, error) {
+func (m *RoomMessagesModel) GetMessagePage(ctx context.Context, roomID, viewerID int, offset int, limit int) (*MessagePage, error) {
 	page := MessagePage{
 		Messages: []MessageWithName{},
 		HasMore:  false,
@@ -200,15 +381,16 @@ func (m *RoomMessagesModel) GetMessagePage(ctx context.Context, roomID int, offs
 
 	// Query messages using offset, ordered by most recent first
 	const stmt = `
-SELECT m.id, m.room_id, m.user_id, m.message_body, m.command_result, m.created_at, u.name
+SELECT m.id, m.room_id, m.user_id, m.message_body, m.command_result, m.command_data, m.recipients, m.visibility, m.created_at, u.name
 FROM room_messages m
 JOIN users u ON u.id = m.user_id
 WHERE m.room_id = $1
+  AND (m.recipients IS NULL OR m.user_id = $4 OR $4 = ANY(m.recipients))
 ORDER BY m.created_at DESC, m.id DESC
 OFFSET $2
 LIMIT $3;
 `
-	rows, err := m.DB.Query(ctx, stmt, roomID, offset, limitPlusOne)
+	rows, err := m.DB.Query(ctx, stmt, roomID, offset, limitPlusOne, viewerID)
 	if err != nil {
 		return &page, err
 	}
@@ -217,15 +399,18 @@ LIMIT $3;
 	results := make([]MessageWithName, 0, limitPlusOne)
 	for rows.Next() {
 		var (
-			id        int64
-			roomIDOut int
-			userIDOut int
-			body      string
-			cmd       sql.NullString
-			createdAt time.Time
-			username  string
+			id         int64
+			roomIDOut  int
+			userIDOut  int
+			body       string
+			cmd        sql.NullString
+			cmdData    []byte
+			recipients []int
+			visibility MessageVisibility
+			createdAt  time.Time
+			username   string
 		)
-		if err := rows.Scan(&id, &roomIDOut, &userIDOut, &body, &cmd, &createdAt, &username); err != nil {
+		if err := rows.Scan(&id, &roomIDOut, &userIDOut, &body, &cmd, &cmdData, &recipients, &visibility, &createdAt, &username); err != nil {
 			return &page, err
 		}
 
@@ -242,6 +427,9 @@ LIMIT $3;
 			UserID:        userIDOut,
 			MessageBody:   body,
 			CommandResult: commandResult,
+			CommandData:   cmdData,
+			Recipients:    recipients,
+			Visibility:    visibility,
 			CreatedAt:     createdAt,
 		}
 
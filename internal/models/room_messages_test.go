@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestMessageVisibleTo(t *testing.T) {
+	const sender, player, gm = 1, 2, 3
+
+	tests := []struct {
+		visibility MessageVisibility
+		want       map[int]bool
+	}{
+		{MessagePublic, map[int]bool{sender: true, player: true, gm: true}},
+		{MessageGMOnly, map[int]bool{sender: true, player: false, gm: true}},
+		{MessageBlind, map[int]bool{sender: false, player: false, gm: true}},
+		{MessageSelf, map[int]bool{sender: true, player: false, gm: false}},
+	}
+
+	roles := map[int]RoomRole{sender: RolePlayer, player: RolePlayer, gm: RoleGamemaster}
+	for _, tt := range tests {
+		m := &Message{UserID: sender, Visibility: tt.visibility}
+		for viewer, want := range tt.want {
+			if got := m.VisibleTo(viewer, roles[viewer]); got != want {
+				t.Errorf("%s message VisibleTo(%d) = %v, want %v", tt.visibility, viewer, got, want)
+			}
+		}
+	}
+}
+
+func TestMessagePageRedactFor(t *testing.T) {
+	result := "d100 = 42"
+	page := &MessagePage{Messages: []MessageWithName{
+		{Message: Message{UserID: 1, MessageBody: "/r d100", CommandResult: &result, Visibility: MessagePublic}, Username: "Ada"},
+		{Message: Message{UserID: 1, MessageBody: "/gr d100", CommandResult: &result, Visibility: MessageGMOnly}, Username: "Ada"},
+	}}
+
+	page.RedactFor(2, RolePlayer)
+
+	if page.Messages[0].Message.Redacted || page.Messages[0].Message.CommandResult == nil {
+		t.Errorf("public message was redacted: %+v", page.Messages[0].Message)
+	}
+	hidden := page.Messages[1].Message
+	if !hidden.Redacted || hidden.CommandResult != nil || hidden.MessageBody != "Ada rolled secretly" {
+		t.Errorf("gm roll was not redacted: %+v", hidden)
+	}
+}
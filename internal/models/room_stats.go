@@ -0,0 +1,253 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RollStats summarises the rolls of one player, or of the whole room.
+type RollStats struct {
+	UserID   int
+	UserName string
+
+	Rolls int // roll messages, a repeated roll counts once
+
+	// D100 buckets every d100 rolled: D100[0] counts 1-10, D100[9] 91-100
+	D100      [10]int
+	D100Count int
+	D100Sum   int
+
+	VersusTests   int // versus lines, each repetition counts
+	Successes     int
+	CritSuccesses int
+	CritFailures  int
+	NetDegrees    int // degrees of success minus degrees of failure
+}
+
+// D100Bucket is one bar of the d100 distribution.
+type D100Bucket struct {
+	Label   string
+	Count   int
+	Percent float64 // share of all d100 results
+	Width   float64 // percentage of the fullest bucket, for drawing bars
+}
+
+// RoomRollStats holds the stats of a room over [From, To).
+type RoomRollStats struct {
+	From    time.Time
+	To      time.Time
+	Total   *RollStats
+	Players []*RollStats // ordered by number of rolls, most first
+}
+
+func (s *RollStats) Failures() int {
+	return s.VersusTests - s.Successes
+}
+
+// SuccessRate is the percentage of versus tests that succeeded.
+func (s *RollStats) SuccessRate() float64 {
+	if s.VersusTests == 0 {
+		return 0
+	}
+	return 100 * float64(s.Successes) / float64(s.VersusTests)
+}
+
+// AverageDegrees is the mean degrees of success per versus test, with
+// failures counted as negative degrees.
+func (s *RollStats) AverageDegrees() float64 {
+	if s.VersusTests == 0 {
+		return 0
+	}
+	return float64(s.NetDegrees) / float64(s.VersusTests)
+}
+
+func (s *RollStats) D100Average() float64 {
+	if s.D100Count == 0 {
+		return 0
+	}
+	return float64(s.D100Sum) / float64(s.D100Count)
+}
+
+func (s *RollStats) D100Buckets() []D100Bucket {
+	fullest := 0
+	for _, count := range s.D100 {
+		fullest = max(fullest, count)
+	}
+
+	buckets := make([]D100Bucket, len(s.D100))
+	for i, count := range s.D100 {
+		buckets[i] = D100Bucket{
+			Label: strconv.Itoa(i*10+1) + "–" + strconv.Itoa(i*10+10),
+			Count: count,
+		}
+		if s.D100Count > 0 {
+			buckets[i].Percent = 100 * float64(count) / float64(s.D100Count)
+			buckets[i].Width = 100 * float64(count) / float64(fullest)
+		}
+	}
+	return buckets
+}
+
+func (s *RollStats) addD100(v int) {
+	if v < 1 || v > 100 {
+		return
+	}
+	s.D100[(v-1)/10]++
+	s.D100Count++
+	s.D100Sum += v
+}
+
+func (s *RollStats) addVersus(success bool, degrees int, critSuccess, critFail bool) {
+	s.VersusTests++
+	if success {
+		s.Successes++
+		s.NetDegrees += degrees
+	} else {
+		s.NetDegrees -= degrees
+	}
+	if critSuccess {
+		s.CritSuccesses++
+	}
+	if critFail {
+		s.CritFailures++
+	}
+}
+
+// storedRoll mirrors the parts of the command_data JSON the stats need.
+type storedRoll struct {
+	Lines []struct {
+		Groups []struct {
+			Sides int `json:"sides"`
+			Dice  []struct {
+				Value int  `json:"value"`
+				Kept  bool `json:"kept"`
+			} `json:"dice"`
+		} `json:"groups"`
+		Success     *bool `json:"success"`
+		Degrees     int   `json:"degrees"`
+		CritSuccess bool  `json:"critSuccess"`
+		CritFail    bool  `json:"critFail"`
+	} `json:"rolls"`
+}
+
+func (s *RollStats) addStoredRoll(r *storedRoll) {
+	s.Rolls++
+	for _, line := range r.Lines {
+		for _, g := range line.Groups {
+			if g.Sides != 100 {
+				continue
+			}
+			for _, d := range g.Dice {
+				if d.Kept {
+					s.addD100(d.Value)
+				}
+			}
+		}
+		if line.Success != nil {
+			s.addVersus(*line.Success, line.Degrees, line.CritSuccess, line.CritFail)
+		}
+	}
+}
+
+// legacyVersusLine matches an outcome line of a versus roll stored before
+// command_data existed, e.g. "42, 2 success" or "57 + 3 = 60, 1 fail, crit!".
+var legacyVersusLine = regexp.MustCompile(`^(?:.* = )?(-?\d+), (\d+) (success|fail)(, crit!)?$`)
+
+// addLegacyRoll counts a roll from its chat text. Only versus rolls and
+// plain d100 rolls can be recovered this way.
+func (s *RollStats) addLegacyRoll(text string) {
+	lines := strings.Split(text, "\n")
+	header := lines[0]
+	isD100 := strings.HasPrefix(header, "d100 ") || strings.HasPrefix(header, "d100:") ||
+		strings.Contains(header, "x(d100 ")
+
+	s.Rolls++
+	for _, line := range lines[1:] {
+		m := legacyVersusLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		total, _ := strconv.Atoi(m[1])
+		degrees, _ := strconv.Atoi(m[2])
+		crit := m[4] != ""
+		success := m[3] == "success"
+		s.addVersus(success, degrees, crit && success, crit && !success)
+		if isD100 {
+			s.addD100(total)
+		}
+	}
+
+	if header == "d100:" && len(lines) == 2 {
+		if v, err := strconv.Atoi(lines[1]); err == nil {
+			s.addD100(v)
+		}
+	}
+}
+
+func (m *RoomMessagesModel) RollStats(ctx context.Context, roomID, viewerID int, viewerRole RoomRole, from, to time.Time) (*RoomRollStats, error) {
+	const stmt = `
+SELECT m.user_id, u.name, m.command_result, m.command_data, m.visibility
+FROM room_messages m
+JOIN users u ON u.id = m.user_id
+WHERE m.room_id = $1
+  AND m.created_at >= $2
+  AND m.created_at < $3
+  AND m.command_result IS NOT NULL
+  AND m.recipients IS NULL
+ORDER BY m.created_at ASC, m.id ASC;
+`
+	rows, err := m.DB.Query(ctx, stmt, roomID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &RoomRollStats{From: from, To: to, Total: &RollStats{}}
+	byUser := map[int]*RollStats{}
+	for rows.Next() {
+		var (
+			msg      Message
+			userName string
+			result   string
+		)
+		if err := rows.Scan(&msg.UserID, &userName, &result, &msg.CommandData, &msg.Visibility); err != nil {
+			return nil, err
+		}
+		// Secret rolls only count for those who may see them
+		if !msg.VisibleTo(viewerID, viewerRole) {
+			continue
+		}
+
+		player, ok := byUser[msg.UserID]
+		if !ok {
+			player = &RollStats{UserID: msg.UserID, UserName: userName}
+			byUser[msg.UserID] = player
+			stats.Players = append(stats.Players, player)
+		}
+
+		if msg.CommandData != nil {
+			var roll storedRoll
+			if err := json.Unmarshal(msg.CommandData, &roll); err != nil {
+				return nil, err
+			}
+			player.addStoredRoll(&roll)
+			stats.Total.addStoredRoll(&roll)
+		} else if strings.Contains(result, ":\n") {
+			player.addLegacyRoll(result)
+			stats.Total.addLegacyRoll(result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(stats.Players, func(i, j int) bool {
+		return stats.Players[i].Rolls > stats.Players[j].Rolls
+	})
+	return stats, nil
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRollStatsLegacyText(t *testing.T) {
+	var s RollStats
+	s.addLegacyRoll("d100 vs 50:\n42, 1 success")
+	s.addLegacyRoll("3x(d100 vs 50):\n97, 4 fail, crit!\n3, 4 success, crit!\n60, 1 fail\n-4 + 4 - 1 = -1\nTotal: -1 success")
+	s.addLegacyRoll("d100:\n73")
+	s.addLegacyRoll("2d6 + 3:\n4 + 2 + 3 = 9")
+
+	if s.Rolls != 4 || s.VersusTests != 4 || s.Successes != 2 || s.Failures() != 2 {
+		t.Errorf("counts = %+v, want 4 rolls, 4 tests, 2 successes", s)
+	}
+	if s.CritSuccesses != 1 || s.CritFailures != 1 || s.NetDegrees != 0 {
+		t.Errorf("crits/degrees = %d/%d/%d, want 1/1/0", s.CritSuccesses, s.CritFailures, s.NetDegrees)
+	}
+	if s.D100Count != 5 || s.D100[4] != 1 || s.D100[9] != 1 || s.D100[7] != 1 {
+		t.Errorf("d100 distribution = %v (%d results)", s.D100, s.D100Count)
+	}
+}
+
+func TestRollStatsStoredRoll(t *testing.T) {
+	data := `{"expression":"d100","target":40,"rolls":[
+		{"groups":[{"sides":100,"dice":[{"value":12,"kept":true}]}],"total":12,"success":true,"degrees":3},
+		{"groups":[{"sides":100,"dice":[{"value":99,"kept":true}]}],"total":99,"success":false,"degrees":6,"critFail":true}
+	]}`
+	var roll storedRoll
+	if err := json.Unmarshal([]byte(data), &roll); err != nil {
+		t.Fatal(err)
+	}
+
+	var s RollStats
+	s.addStoredRoll(&roll)
+
+	if s.Rolls != 1 || s.VersusTests != 2 || s.SuccessRate() != 50 || s.AverageDegrees() != -1.5 {
+		t.Errorf("stats = %+v, want 1 roll, 2 tests, 50%%, -1.5 degrees", s)
+	}
+	if s.D100Average() != 55.5 || s.D100[1] != 1 || s.D100[9] != 1 || s.CritFailures != 1 {
+		t.Errorf("d100 = %v avg %.1f", s.D100, s.D100Average())
+	}
+}
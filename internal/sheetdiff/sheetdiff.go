@@ -0,0 +1,403 @@
+// Package sheetdiff works out what changed between two versions of a
+// character sheet in terms a player would use: characteristics raised,
+// items gained, lost or edited in each item grid, and experience earned and
+// spent, rather than as raw JSON paths.
+package sheetdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"charactersheet.iociveteres.net/internal/models"
+)
+
+// Options tunes what Compare reports.
+type Options struct {
+	// Layout reports items that only moved within their grid, which are
+	// left out by default.
+	Layout bool
+}
+
+// Diff is what changed from one version of a sheet to another.
+type Diff struct {
+	// From and To say which versions were compared, e.g. "version 12" or
+	// "uploaded file". Compare leaves them for the caller to fill in.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	Characteristics []CharacteristicChange `json:"characteristics,omitempty"`
+	Experience      ExperienceChange       `json:"experience"`
+	Grids           []GridChange           `json:"grids,omitempty"`
+	// Fields are changes anywhere else on the sheet, e.g. notes or
+	// character info.
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// Empty reports whether nothing changed.
+func (d *Diff) Empty() bool {
+	return len(d.Characteristics) == 0 && !d.Experience.Changed() && len(d.Grids) == 0 && len(d.Fields) == 0
+}
+
+// CharacteristicChange is one property of a characteristic that changed,
+// e.g. the value of WS.
+type CharacteristicChange struct {
+	Name  string `json:"name"`
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// IntChange is a number before and after.
+type IntChange struct {
+	Old int `json:"old"`
+	New int `json:"new"`
+}
+
+// Delta is how much the number went up by.
+func (c IntChange) Delta() int {
+	return c.New - c.Old
+}
+
+// ExperienceEntry is an entry of the experience log.
+type ExperienceEntry struct {
+	ID string `json:"id"`
+	models.ExperienceItem
+}
+
+// ExperienceEntryChange is an experience log entry that was edited.
+type ExperienceEntryChange struct {
+	ID  string                `json:"id"`
+	Old models.ExperienceItem `json:"old"`
+	New models.ExperienceItem `json:"new"`
+}
+
+// ExperienceChange is the change in experience totals and the entries
+// added to, removed from or edited in the experience log.
+type ExperienceChange struct {
+	Total     IntChange               `json:"total"`
+	Spent     IntChange               `json:"spent"`
+	Remaining IntChange               `json:"remaining"`
+	Added     []ExperienceEntry       `json:"added,omitempty"`
+	Removed   []ExperienceEntry       `json:"removed,omitempty"`
+	Modified  []ExperienceEntryChange `json:"modified,omitempty"`
+}
+
+// Changed reports whether anything about experience changed.
+func (c *ExperienceChange) Changed() bool {
+	return c.Total.Delta() != 0 || c.Spent.Delta() != 0 || c.Remaining.Delta() != 0 ||
+		len(c.Added) > 0 || len(c.Removed) > 0 || len(c.Modified) > 0
+}
+
+// GridChange is what changed in one item grid, e.g. "gear.list".
+type GridChange struct {
+	Path     string       `json:"path"`
+	Added    []Item       `json:"added,omitempty"`
+	Removed  []Item       `json:"removed,omitempty"`
+	Modified []ItemChange `json:"modified,omitempty"`
+	Moved    []ItemMove   `json:"moved,omitempty"`
+}
+
+// Item is an item of a grid as a whole.
+type Item struct {
+	ID    string          `json:"id"`
+	Name  string          `json:"name,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ItemChange is an item that is in both versions of a grid but was edited.
+type ItemChange struct {
+	ID     string        `json:"id"`
+	Name   string        `json:"name,omitempty"`
+	Fields []FieldChange `json:"fields"`
+}
+
+// ItemMove is an item that changed place within its grid.
+type ItemMove struct {
+	ID   string          `json:"id"`
+	Name string          `json:"name,omitempty"`
+	From models.Position `json:"from"`
+	To   models.Position `json:"to"`
+}
+
+// FieldChange is a value that changed at Path. A nil Old or New means the
+// value is missing from that version.
+type FieldChange struct {
+	Path string          `json:"path"`
+	Old  json.RawMessage `json:"old"`
+	New  json.RawMessage `json:"new"`
+}
+
+// handled are the paths Compare reports on in their own right, which are
+// left out of the generic walk over the rest of the sheet.
+var handled = map[string]bool{
+	"characteristics":                true,
+	"experience.experienceLog":       true,
+	"experience.experienceTotal":     true,
+	"experience.experienceSpent":     true,
+	"experience.experienceRemaining": true,
+}
+
+// Compare works out what changed from before to after.
+func Compare(before, after *models.CharacterSheetContent, opts Options) (*Diff, error) {
+	d := &Diff{
+		Characteristics: compareCharacteristics(before.Characteristics, after.Characteristics),
+		Experience:      compareExperience(before.Experience, after.Experience),
+	}
+
+	a, err := toValue(before)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toValue(after)
+	if err != nil {
+		return nil, err
+	}
+	w := &walker{opts: opts, diff: d}
+	if err := w.walk(nil, a, true, b, true); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// CompareJSON is Compare for sheet content as stored or exported.
+func CompareJSON(before, after json.RawMessage, opts Options) (*Diff, error) {
+	var a, b models.CharacterSheetContent
+	if err := json.Unmarshal(before, &a); err != nil {
+		return nil, fmt.Errorf("unmarshal old content: %w", err)
+	}
+	if err := json.Unmarshal(after, &b); err != nil {
+		return nil, fmt.Errorf("unmarshal new content: %w", err)
+	}
+	return Compare(&a, &b, opts)
+}
+
+var characteristicFields = []struct {
+	name string
+	get  func(models.Characteristic) string
+}{
+	{"value", func(c models.Characteristic) string { return c.Value }},
+	{"unnatural", func(c models.Characteristic) string { return c.Unnatural }},
+	{"tempValue", func(c models.Characteristic) string { return c.TempValue }},
+	{"tempUnnatural", func(c models.Characteristic) string { return c.TempUnnatural }},
+	{"tempEnabled", func(c models.Characteristic) string { return strconv.FormatBool(c.TempEnabled) }},
+}
+
+func compareCharacteristics(before, after map[string]models.Characteristic) []CharacteristicChange {
+	var changes []CharacteristicChange
+	for _, name := range unionKeys(before, after) {
+		for _, f := range characteristicFields {
+			o, n := f.get(before[name]), f.get(after[name])
+			if o != n {
+				changes = append(changes, CharacteristicChange{Name: name, Field: f.name, Old: o, New: n})
+			}
+		}
+	}
+	return changes
+}
+
+func compareExperience(before, after models.Experience) ExperienceChange {
+	c := ExperienceChange{
+		Total:     IntChange{before.Total, after.Total},
+		Spent:     IntChange{before.Spent, after.Spent},
+		Remaining: IntChange{before.Remaining, after.Remaining},
+	}
+	for _, id := range unionKeys(before.Log.Items, after.Log.Items) {
+		o, inOld := before.Log.Items[id]
+		n, inNew := after.Log.Items[id]
+		switch {
+		case !inOld:
+			c.Added = append(c.Added, ExperienceEntry{ID: id, ExperienceItem: n})
+		case !inNew:
+			c.Removed = append(c.Removed, ExperienceEntry{ID: id, ExperienceItem: o})
+		case o != n:
+			c.Modified = append(c.Modified, ExperienceEntryChange{ID: id, Old: o, New: n})
+		}
+	}
+	return c
+}
+
+type walker struct {
+	opts Options
+	diff *Diff
+}
+
+// walk goes through everything Compare does not handle in its own right,
+// turning item grids into GridChanges and anything else into
+// FieldChanges.
+func (w *walker) walk(path []string, a any, aOK bool, b any, bOK bool) error {
+	if handled[strings.Join(path, ".")] {
+		return nil
+	}
+	aObj, aIsObj := a.(map[string]any)
+	bObj, bIsObj := b.(map[string]any)
+	if !aIsObj || !bIsObj {
+		changes, err := fieldChanges(path, a, aOK, b, bOK, w.opts)
+		w.diff.Fields = append(w.diff.Fields, changes...)
+		return err
+	}
+	if isGrid(aObj) && isGrid(bObj) {
+		return w.grid(path, aObj, bObj)
+	}
+	for _, key := range unionKeys(aObj, bObj) {
+		av, aHas := aObj[key]
+		bv, bHas := bObj[key]
+		if err := w.walk(append(slices.Clip(path), key), av, aHas, bv, bHas); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *walker) grid(path []string, a, b map[string]any) error {
+	aItems, _ := a["items"].(map[string]any)
+	bItems, _ := b["items"].(map[string]any)
+
+	g := GridChange{Path: strings.Join(path, ".")}
+	for _, id := range unionKeys(aItems, bItems) {
+		av, inA := aItems[id]
+		bv, inB := bItems[id]
+		switch {
+		case !inA:
+			item, err := newItem(id, bv)
+			if err != nil {
+				return err
+			}
+			g.Added = append(g.Added, item)
+		case !inB:
+			item, err := newItem(id, av)
+			if err != nil {
+				return err
+			}
+			g.Removed = append(g.Removed, item)
+		default:
+			fields, err := fieldChanges(nil, av, true, bv, true, w.opts)
+			if err != nil {
+				return err
+			}
+			if len(fields) > 0 {
+				g.Modified = append(g.Modified, ItemChange{ID: id, Name: itemName(bv), Fields: fields})
+			}
+		}
+	}
+
+	if w.opts.Layout {
+		aLayouts, _ := a["layouts"].(map[string]any)
+		bLayouts, _ := b["layouts"].(map[string]any)
+		for _, id := range unionKeys(aLayouts, bLayouts) {
+			from, inA := position(aLayouts[id])
+			to, inB := position(bLayouts[id])
+			if inA && inB && from != to {
+				g.Moved = append(g.Moved, ItemMove{ID: id, Name: itemName(bItems[id]), From: from, To: to})
+			}
+		}
+	}
+
+	if len(g.Added) > 0 || len(g.Removed) > 0 || len(g.Modified) > 0 || len(g.Moved) > 0 {
+		w.diff.Grids = append(w.diff.Grids, g)
+	}
+	return nil
+}
+
+// fieldChanges lists the leaf paths at or under path where a and b differ.
+// The layouts of grids nested inside are skipped unless opts.Layout is set.
+func fieldChanges(path []string, a any, aOK bool, b any, bOK bool, opts Options) ([]FieldChange, error) {
+	aObj, aIsObj := a.(map[string]any)
+	bObj, bIsObj := b.(map[string]any)
+	if aIsObj && bIsObj {
+		skipLayouts := !opts.Layout && isGrid(aObj) && isGrid(bObj)
+		var changes []FieldChange
+		for _, key := range unionKeys(aObj, bObj) {
+			if skipLayouts && key == "layouts" {
+				continue
+			}
+			av, aHas := aObj[key]
+			bv, bHas := bObj[key]
+			c, err := fieldChanges(append(slices.Clip(path), key), av, aHas, bv, bHas, opts)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, c...)
+		}
+		return changes, nil
+	}
+
+	if aOK == bOK && reflect.DeepEqual(a, b) {
+		return nil, nil
+	}
+	c := FieldChange{Path: strings.Join(path, ".")}
+	var err error
+	if aOK {
+		if c.Old, err = json.Marshal(a); err != nil {
+			return nil, err
+		}
+	}
+	if bOK {
+		if c.New, err = json.Marshal(b); err != nil {
+			return nil, err
+		}
+	}
+	return []FieldChange{c}, nil
+}
+
+// isGrid reports whether a JSON object is an ItemGrid.
+func isGrid(obj map[string]any) bool {
+	_, hasItems := obj["items"]
+	_, hasLayouts := obj["layouts"]
+	return hasItems && hasLayouts && len(obj) == 2
+}
+
+func newItem(id string, v any) (Item, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Item{}, err
+	}
+	return Item{ID: id, Name: itemName(v), Value: b}, nil
+}
+
+// itemName is the name an item is shown by, when it has one.
+func itemName(v any) string {
+	obj, _ := v.(map[string]any)
+	name, _ := obj["name"].(string)
+	return name
+}
+
+func position(v any) (models.Position, bool) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return models.Position{}, false
+	}
+	col, _ := obj["colIndex"].(float64)
+	row, _ := obj["rowIndex"].(float64)
+	return models.Position{ColIndex: int(col), RowIndex: int(row)}, true
+}
+
+func toValue(content *models.CharacterSheetContent) (any, error) {
+	b, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("marshal content: %w", err)
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("unmarshal content: %w", err)
+	}
+	return v, nil
+}
+
+// unionKeys returns the keys of a and b, sorted.
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,119 @@
+package sheetdiff
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const before = `{
+	"characterInfo": {"characterName": "Vex"},
+	"characteristics": {"WS": {"value": "40", "tempEnabled": false}, "BS": {"value": "35", "tempEnabled": false}},
+	"gear": {"list": {
+		"items": {
+			"a": {"name": "Knife", "weight": 1, "description": ""},
+			"b": {"name": "Rope", "weight": 2, "description": ""},
+			"c": {"name": "Lamp", "weight": 1, "description": ""}
+		},
+		"layouts": {"a": {"colIndex": 0, "rowIndex": 0}, "b": {"colIndex": 0, "rowIndex": 1}, "c": {"colIndex": 1, "rowIndex": 0}}
+	}},
+	"experience": {
+		"experienceTotal": 1000, "experienceSpent": 500, "experienceRemaining": 500,
+		"experienceLog": {"items": {"x": {"name": "WS +5", "experienceCost": 250}}, "layouts": {}}
+	}
+}`
+
+const after = `{
+	"characterInfo": {"characterName": "Vex the Bold"},
+	"characteristics": {"WS": {"value": "45", "tempEnabled": false}, "BS": {"value": "35", "tempEnabled": false}},
+	"gear": {"list": {
+		"items": {
+			"a": {"name": "Knife", "weight": 1, "description": "Chipped"},
+			"c": {"name": "Lamp", "weight": 1, "description": ""},
+			"d": {"name": "Lasgun", "weight": 4, "description": ""}
+		},
+		"layouts": {"a": {"colIndex": 1, "rowIndex": 0}, "c": {"colIndex": 0, "rowIndex": 0}, "d": {"colIndex": 0, "rowIndex": 1}}
+	}},
+	"experience": {
+		"experienceTotal": 1300, "experienceSpent": 700, "experienceRemaining": 600,
+		"experienceLog": {"items": {"x": {"name": "WS +5", "experienceCost": 250}, "y": {"name": "Dodge", "experienceCost": 200}}, "layouts": {}}
+	}
+}`
+
+func TestCompareJSON(t *testing.T) {
+	d, err := CompareJSON(json.RawMessage(before), json.RawMessage(after), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Characteristics) != 1 || d.Characteristics[0] != (CharacteristicChange{Name: "WS", Field: "value", Old: "40", New: "45"}) {
+		t.Errorf("characteristics = %+v, want WS value 40 -> 45", d.Characteristics)
+	}
+
+	if d.Experience.Total.Delta() != 300 || d.Experience.Spent.Delta() != 200 {
+		t.Errorf("experience total/spent delta = %d/%d, want 300/200", d.Experience.Total.Delta(), d.Experience.Spent.Delta())
+	}
+	if len(d.Experience.Added) != 1 || d.Experience.Added[0].ID != "y" || d.Experience.Added[0].ExperienceCost != 200 {
+		t.Errorf("experience added = %+v, want y costing 200", d.Experience.Added)
+	}
+	if len(d.Experience.Removed) != 0 || len(d.Experience.Modified) != 0 {
+		t.Errorf("experience removed/modified = %+v/%+v, want none", d.Experience.Removed, d.Experience.Modified)
+	}
+
+	if len(d.Grids) != 1 {
+		t.Fatalf("grids = %+v, want gear.list only", d.Grids)
+	}
+	g := d.Grids[0]
+	if g.Path != "gear.list" {
+		t.Errorf("grid path = %s, want gear.list", g.Path)
+	}
+	if len(g.Added) != 1 || g.Added[0].ID != "d" || g.Added[0].Name != "Lasgun" {
+		t.Errorf("added = %+v, want d Lasgun", g.Added)
+	}
+	if len(g.Removed) != 1 || g.Removed[0].ID != "b" {
+		t.Errorf("removed = %+v, want b", g.Removed)
+	}
+	if len(g.Modified) != 1 || g.Modified[0].ID != "a" || len(g.Modified[0].Fields) != 1 ||
+		g.Modified[0].Fields[0].Path != "description" || string(g.Modified[0].Fields[0].New) != `"Chipped"` {
+		t.Errorf("modified = %+v, want a's description", g.Modified)
+	}
+	if len(g.Moved) != 0 {
+		t.Errorf("moved = %+v, want layout ignored", g.Moved)
+	}
+
+	var infoChanged bool
+	for _, f := range d.Fields {
+		switch f.Path {
+		case "characterInfo.characterName":
+			infoChanged = string(f.Old) == `"Vex"` && string(f.New) == `"Vex the Bold"`
+		default:
+			t.Errorf("unexpected field change %s: %s -> %s", f.Path, f.Old, f.New)
+		}
+	}
+	if !infoChanged {
+		t.Error("character name change not reported")
+	}
+}
+
+func TestCompareJSONLayout(t *testing.T) {
+	d, err := CompareJSON(json.RawMessage(before), json.RawMessage(after), Options{Layout: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Grids) != 1 {
+		t.Fatalf("grids = %+v, want gear.list only", d.Grids)
+	}
+	moved := d.Grids[0].Moved
+	if len(moved) != 2 || moved[0].ID != "a" || moved[1].ID != "c" || moved[1].Name != "Lamp" || moved[1].To.ColIndex != 0 {
+		t.Errorf("moved = %+v, want a and c", moved)
+	}
+}
+
+func TestCompareUnchanged(t *testing.T) {
+	d, err := CompareJSON(json.RawMessage(before), json.RawMessage(before), Options{Layout: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Empty() {
+		t.Errorf("diff = %+v, want empty", d)
+	}
+}
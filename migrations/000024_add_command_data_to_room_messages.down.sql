@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE room_messages
+DROP COLUMN command_data;
+
+END;
\ No newline at end of file
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE room_messages
+ADD COLUMN command_data JSONB;
+
+END;
\ No newline at end of file
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE room_messages
+DROP COLUMN recipients;
+
+END;
\ No newline at end of file
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE room_messages
+DROP COLUMN visibility;
+
+END;
\ No newline at end of file
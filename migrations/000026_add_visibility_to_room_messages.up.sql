@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE room_messages
+ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public'
+CHECK (visibility IN ('public', 'gm', 'blind', 'self'));
+
+END;
\ No newline at end of file
@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE room_messages
+DROP COLUMN roll_seed,
+DROP COLUMN roll_commitment,
+DROP COLUMN roll_dice;
+
+END;
\ No newline at end of file
@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE room_messages
+ADD COLUMN roll_seed BYTEA,
+ADD COLUMN roll_commitment TEXT,
+ADD COLUMN roll_dice INTEGER[];
+
+END;
\ No newline at end of file
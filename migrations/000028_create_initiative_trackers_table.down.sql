@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS initiative_trackers;
+
+END;
\ No newline at end of file
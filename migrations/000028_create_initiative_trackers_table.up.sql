@@ -0,0 +1,14 @@
+BEGIN;
+
+-- One turn order per room. Entries are kept in turn order as a JSON array
+-- of {id, sheetId, name, expression, initiative, roll, delayed}.
+CREATE TABLE initiative_trackers (
+    room_id INT PRIMARY KEY REFERENCES rooms(id) ON DELETE CASCADE,
+    round INT NOT NULL DEFAULT 0 CHECK (round >= 0),
+    current_entry TEXT,
+    entries JSONB NOT NULL DEFAULT '[]'::jsonb,
+    version INT NOT NULL DEFAULT 1,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+END;
\ No newline at end of file
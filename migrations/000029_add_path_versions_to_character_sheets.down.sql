@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE character_sheets
+DROP COLUMN IF EXISTS path_versions;
+
+END;
\ No newline at end of file
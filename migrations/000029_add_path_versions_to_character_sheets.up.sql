@@ -0,0 +1,9 @@
+BEGIN;
+
+-- The last write to each path, as sheet version and user, e.g.
+-- {"characteristics.WS.value": {"v": 42, "u": 7}}, so concurrent edits
+-- only collide when they touch the same part of the sheet.
+ALTER TABLE character_sheets
+ADD COLUMN path_versions JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+END;
\ No newline at end of file
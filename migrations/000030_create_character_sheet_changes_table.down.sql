@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS character_sheet_changes;
+DROP FUNCTION IF EXISTS forbid_character_sheet_change_update();
+
+END;
\ No newline at end of file
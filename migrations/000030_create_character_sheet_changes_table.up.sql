@@ -0,0 +1,29 @@
+BEGIN;
+
+-- Every change made to a sheet's content, one row per path written. A NULL
+-- old_value means the path did not exist before, a NULL new_value that the
+-- change removed it. Rows are only ever added.
+CREATE TABLE character_sheet_changes (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    sheet_id INT NOT NULL REFERENCES character_sheets(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id),
+    version INT NOT NULL,
+    path TEXT[] NOT NULL,
+    old_value JSONB,
+    new_value JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_character_sheet_changes_sheet ON character_sheet_changes (sheet_id, version);
+
+CREATE OR REPLACE FUNCTION forbid_character_sheet_change_update() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'character_sheet_changes is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER character_sheet_changes_append_only
+BEFORE UPDATE ON character_sheet_changes
+FOR EACH ROW EXECUTE FUNCTION forbid_character_sheet_change_update();
+
+END;
\ No newline at end of file
@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_character_sheet_changes_user;
+
+ALTER TABLE character_sheet_changes
+DROP COLUMN IF EXISTS target_version,
+DROP COLUMN IF EXISTS action;
+
+END;
\ No newline at end of file
@@ -0,0 +1,11 @@
+BEGIN;
+
+-- Undo and redo are logged like any other change, marked with the version of
+-- the write they reverse so a user's undo and redo stacks can be replayed.
+ALTER TABLE character_sheet_changes
+ADD COLUMN action TEXT NOT NULL DEFAULT 'edit' CHECK (action IN ('edit', 'undo', 'redo')),
+ADD COLUMN target_version INT;
+
+CREATE INDEX idx_character_sheet_changes_user ON character_sheet_changes (sheet_id, user_id, version);
+
+END;
\ No newline at end of file
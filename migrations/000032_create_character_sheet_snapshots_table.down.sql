@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS character_sheet_snapshots;
+
+END;
\ No newline at end of file
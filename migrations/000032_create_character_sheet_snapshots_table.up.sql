@@ -0,0 +1,17 @@
+BEGIN;
+
+-- Named copies of a sheet's content, taken by its editors to compare against
+-- or go back to later. Restoring one writes it as a new version of the sheet.
+CREATE TABLE character_sheet_snapshots (
+    id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    sheet_id INT NOT NULL REFERENCES character_sheets(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id),
+    label TEXT NOT NULL,
+    content JSONB NOT NULL,
+    version INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_character_sheet_snapshots_sheet ON character_sheet_snapshots (sheet_id, created_at);
+
+END;
\ No newline at end of file
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE room_messages
+ADD COLUMN roll_commitment TEXT;
+
+END;
\ No newline at end of file
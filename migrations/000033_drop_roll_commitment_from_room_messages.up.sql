@@ -0,0 +1,8 @@
+BEGIN;
+
+-- The commitment was stored next to the seed and never shown before the roll,
+-- so it committed to nothing. Roll audits are replayed from the seed alone.
+ALTER TABLE room_messages
+DROP COLUMN IF EXISTS roll_commitment;
+
+END;
\ No newline at end of file
@@ -10,7 +10,15 @@
     if (!a) return;
 
     e.preventDefault();
-    const url = a.href;
+    await loadSheet(a.href);
+  });
+
+  // reload the open sheet, e.g. after someone restored an earlier version
+  document.addEventListener('sheet:reload', (e) => {
+    loadSheet(`/sheet/view/${e.detail.sheetID}`);
+  });
+
+  async function loadSheet(url) {
     const container = document.getElementById(containerSelector);
     if (!container) return;
 
@@ -33,7 +41,7 @@
     } finally {
       container.classList.remove('loading');
     }
-  });
+  }
 
   // handle browser back/forward
   window.addEventListener('popstate', (ev) => {
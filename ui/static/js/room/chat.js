@@ -12,6 +12,9 @@ export const chatMixin = {
     chatBottomObserver: null,
     unreadMessageCount: 0,
     showNewMessagesButton: false,
+    damageRollFor: null,
+    damageTargetSheetID: '',
+    damageApply: false,
 
     // Methods
     getChatGroupedMessages() {
@@ -114,6 +117,82 @@ export const chatMixin = {
         this._justSentMessage = true;
     },
 
+    // "Whisper to Ada, Marcus" for whispers, null for public messages
+    whisperLabel(msg) {
+        if (!msg.recipients || msg.recipients.length === 0) {
+            return null;
+        }
+        const names = msg.recipients.map(id => {
+            if (id === this.$store.room.currentUser.id) {
+                return 'you';
+            }
+            return this.$store.room.findPlayer(id)?.name || 'unknown player';
+        });
+        return `Whisper to ${names.join(', ')}`;
+    },
+
+    // "GM roll", "Blind roll" or "Self roll" for secret rolls the viewer
+    // can see, null otherwise
+    visibilityLabel(msg) {
+        if (msg.redacted) {
+            return null;
+        }
+        switch (msg.visibility) {
+            case 'gm': return 'GM roll';
+            case 'blind': return 'Blind roll';
+            case 'self': return 'Self roll';
+            default: return null;
+        }
+    },
+
+    // An attack of the viewer's own that hit and has no damage roll yet
+    canRollDamage(msg) {
+        const attack = msg.commandData?.attack;
+        return !!attack && attack.hits > 0 && !attack.resolved
+            && msg.userId === this.$store.room.currentUser.id;
+    },
+
+    // Sheets in the room the viewer can see, as damage targets
+    damageTargets() {
+        return this.$store.room.allPlayers.flatMap(player =>
+            (player.sheets || [])
+                .filter(sheet => this.$store.room.isSheetVisible(sheet, player.id))
+                .map(sheet => ({ id: sheet.id, name: sheet.name }))
+        );
+    },
+
+    toggleDamageRoll(messageId) {
+        if (this.damageRollFor === messageId) {
+            this.damageRollFor = null;
+            return;
+        }
+        this.damageRollFor = messageId;
+        this.damageTargetSheetID = '';
+        this.damageApply = false;
+    },
+
+    // Rolls the damage of the weapon an attack was made with against the
+    // chosen sheet. The server takes the weapon and hit locations from the
+    // stored attack and turns away a second damage roll for it.
+    rollDamage(msg) {
+        const attack = msg.commandData.attack;
+        if (!this.damageTargetSheetID) return;
+
+        const payload = {
+            type: 'damageRoll',
+            eventID: crypto.randomUUID(),
+            sheetID: String(attack.sheetId),
+            path: attack.path,
+            targetSheetID: String(this.damageTargetSheetID),
+            messageID: msg.id,
+            apply: this.damageApply
+        };
+        document.dispatchEvent(new CustomEvent('room:sendMessage', { detail: JSON.stringify(payload) }));
+
+        attack.resolved = true;
+        this.damageRollFor = null;
+    },
+
     toggleMessageMenu(messageId) {
         if (this.messageMenuOpen === messageId) {
             this.messageMenuOpen = null;
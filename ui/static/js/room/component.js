@@ -4,6 +4,7 @@ import { diceMixin } from './dice.js';
 import { foldersMixin } from './folders.js';
 import { playersMixin } from './players.js';
 import { modalsMixin } from './modals.js';
+import { initiativeMixin } from './initiative.js';
 
 document.addEventListener('alpine:init', () => {
     Alpine.store('room', createRoomStore());
@@ -15,6 +16,7 @@ document.addEventListener('alpine:init', () => {
             ...foldersMixin,
             ...playersMixin,
             ...modalsMixin,
+            ...initiativeMixin,
 
             rightPanelVisible: true,
 
@@ -0,0 +1,65 @@
+export const initiativeMixin = {
+    initiativeSheetId: '',
+    initiativeNpcName: '',
+    initiativeNpcExpression: 'd10',
+
+    // Every sheet of the room the gamemaster can add to the turn order
+    get initiativeSheets() {
+        return this.$store.room.allPlayers.flatMap(player =>
+            (player.sheets || []).map(sheet => ({ id: sheet.id, name: sheet.name }))
+        );
+    },
+
+    sendInitiative(type, fields = {}) {
+        const payload = {
+            type: type,
+            eventID: crypto.randomUUID(),
+            ...fields
+        };
+        document.dispatchEvent(new CustomEvent('room:sendMessage', { detail: JSON.stringify(payload) }));
+    },
+
+    addInitiativeSheet() {
+        if (!this.initiativeSheetId) return;
+        this.sendInitiative('initiativeAdd', { sheetID: String(this.initiativeSheetId) });
+        this.initiativeSheetId = '';
+    },
+
+    addInitiativeNpc() {
+        const name = this.initiativeNpcName.trim();
+        const expression = this.initiativeNpcExpression.trim();
+        if (!name || !expression) return;
+        this.sendInitiative('initiativeAdd', { name: name, expression: expression });
+        this.initiativeNpcName = '';
+    },
+
+    rollInitiative(entryId = '') {
+        this.sendInitiative('initiativeRoll', { entryID: entryId });
+    },
+
+    sortInitiative() {
+        this.sendInitiative('initiativeSort');
+    },
+
+    nextTurn() {
+        this.sendInitiative('initiativeNext');
+    },
+
+    delayTurn(entryId) {
+        this.sendInitiative('initiativeDelay', { entryID: entryId });
+    },
+
+    actNow(entryId) {
+        this.sendInitiative('initiativeAct', { entryID: entryId });
+    },
+
+    removeFromInitiative(entryId) {
+        this.sendInitiative('initiativeRemove', { entryID: entryId });
+    },
+
+    async clearInitiative() {
+        const confirmed = await this.$store.room.confirm('End the encounter and clear the turn order?');
+        if (!confirmed) return;
+        this.sendInitiative('initiativeClear');
+    }
+};
@@ -13,8 +13,10 @@ export const networkHandlers = {
         document.addEventListener('ws:changePlayerRole', (e) => this.handleChangePlayerRole(e.detail));
         document.addEventListener('ws:newInviteLink', (e) => this.handleNewInviteLink(e.detail));
         document.addEventListener('ws:chatMessage', (e) => this.handleChatMessage(e.detail));
+        document.addEventListener('ws:commandReply', (e) => this.handleCommandReply(e.detail));
         document.addEventListener('ws:deleteMessage', (e) => this.handleDeleteMessage(e.detail));
         document.addEventListener('ws:chatHistory', (e) => this.handleChatHistory(e.detail));
+        document.addEventListener('ws:initiativeUpdated', (e) => this.handleInitiativeUpdated(e.detail));
         window.addEventListener('ws:connectionLost', () => this.handleConnectionLost());
 
         document.addEventListener('ws:folderCreated', (e) => this.handleFolderCreated(e.detail));
@@ -206,6 +208,12 @@ export const networkHandlers = {
         this.inviteLink = msg.link;
     },
 
+    // Initiative handlers
+    handleInitiativeUpdated(msg) {
+        if (msg.tracker.version < (this.initiative.version || 0)) return;
+        this.initiative = msg.tracker;
+    },
+
     handleConnectionLost() {
         this.modals.connectionLost = true;
     },
@@ -218,6 +226,32 @@ export const networkHandlers = {
             userName: msg.userName,
             messageBody: msg.messageBody,
             commandResult: msg.commandResult || null,
+            commandData: msg.commandData || null,
+            recipients: msg.recipients || null,
+            visibility: msg.visibility || 'public',
+            redacted: !!msg.redacted,
+            createdAt: msg.created
+        };
+
+        this.chat.messages = [...this.chat.messages, message];
+
+        queueMicrotask(() => {
+            document.dispatchEvent(new CustomEvent('chat:newMessage'));
+        });
+    },
+
+    // Private command output (e.g. /help): only this client sees it and it
+    // disappears on reload, so it gets a local id that never clashes with
+    // stored messages.
+    handleCommandReply(msg) {
+        const message = {
+            id: `local-${msg.eventID || Date.now()}`,
+            userId: this.currentUser.id,
+            userName: this.currentUser.name,
+            messageBody: msg.messageBody,
+            commandResult: msg.commandResult || null,
+            commandData: null,
+            private: true,
             createdAt: msg.created
         };
 
@@ -251,6 +285,10 @@ export const networkHandlers = {
             userName: m.username,
             messageBody: m.message.messageBody,
             commandResult: m.message.commandResult || null,
+            commandData: m.message.commandData || null,
+            recipients: m.message.recipients || null,
+            visibility: m.message.visibility || 'public',
+            redacted: !!m.message.redacted,
             createdAt: m.message.createdAt
         }));
 
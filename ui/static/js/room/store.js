@@ -26,6 +26,11 @@ export function createRoomStore() {
             hasMore: false,
             loadedCount: 0
         },
+        initiative: {
+            round: 0,
+            current: '',
+            entries: []
+        },
         confirmModal: {
             message: '',
             resolveCallback: null
@@ -163,6 +168,11 @@ export function createRoomStore() {
                 this.roomId = parseInt(roomIdEl.dataset.value, 10);
             }
 
+            const initiativeEl = document.getElementById('ssr-initiative');
+            if (initiativeEl?.dataset?.tracker) {
+                this.initiative = JSON.parse(initiativeEl.dataset.tracker);
+            }
+
             const messageEls = document.querySelectorAll('.ssr-message');
             this.chat.messages = Array.from(messageEls).map(el => ({
                 id: parseInt(el.dataset.id, 10),
@@ -170,6 +180,10 @@ export function createRoomStore() {
                 userName: el.dataset.userName,
                 messageBody: el.dataset.message,
                 commandResult: el.dataset.commandResult || null,
+                commandData: el.dataset.commandData ? JSON.parse(el.dataset.commandData) : null,
+                recipients: el.dataset.recipients ? el.dataset.recipients.split(',').map(Number) : null,
+                visibility: el.dataset.visibility || 'public',
+                redacted: el.dataset.redacted === 'true',
                 createdAt: el.dataset.created
             }));
 
@@ -1,5 +1,6 @@
 import {
     getRoot,
+    getSheetVersion,
     getLeafFromPath,
     findElementByPath,
     getDataPath,
@@ -455,6 +456,7 @@ export function initDeleteItemSender(container, { socket }) {
             type: 'deleteItem',
             eventID: crypto.randomUUID(),
             sheetID: document.getElementById('charactersheet')?.dataset.sheetId || null,
+            version: getSheetVersion(),
             path: path + "." + itemId,
         };
 
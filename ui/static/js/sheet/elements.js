@@ -224,61 +224,24 @@ function getRollValue(baseSelectValue) {
 }
 
 /**
- * Used in _handleRollClick for roll events.
- * Reads the select element and returns both the base value and bonus successes.
- * @param {Element} rollContainer
- * @returns {{baseValue: number, bonusSuccesses: number}}
+ * Asks the server to roll for the weapon or power in container.
+ * The server reads the roll dialog settings from the saved sheet,
+ * so the target and whatever follows from the roll cannot be tampered with.
+ * @param {string} type - attackRoll or psychicTest
+ * @param {Element} container
  */
-function getRollFull(rollContainer) {
-    const sel = rollContainer.querySelector('select[data-id="baseSelect"]');
-    if (!sel) return { baseValue: 0, bonusSuccesses: 0 };
+function requestSheetRoll(type, container) {
+    const sheetID = document.getElementById('charactersheet')?.dataset?.sheetId;
+    if (!sheetID) return;
 
-    const selectedOption = sel.options[sel.selectedIndex];
-    const type = selectedOption?.dataset?.type;
-    const key = sel.value;
-
-    if (type === 'characteristic') {
-        const char = characterState.characteristics?.[key];
-        const value = char?.calculatedValue?.value ?? 0;
-        const unnatural = char?.calculatedUnnatural?.value ?? 0;
-        return {
-            baseValue: value,
-            bonusSuccesses: calculateBonusSuccesses(unnatural)
-        };
-    }
-
-    if (type === 'skill') {
-        const baseValue = getRollValue(key);
-
-        // Bonus successes from the governing characteristic
-        const overrideMatch = key.match(/^(.+?)\s*\(([A-Za-z]+)\)$/);
-        let charKey = overrideMatch ? overrideMatch[2] : null;
-
-        if (!charKey) {
-            const normalized = key.toLowerCase().replace(/\s+/g, '-');
-            const allSkills = {
-                ...characterState.skillsLeft,
-                ...characterState.skillsRight,
-                ...Object.fromEntries(
-                    Object.values(characterState.customSkills?.items ?? {})
-                        .map(s => [s.name?.value?.toLowerCase(), s])
-                )
-            };
-            const skill = allSkills[normalized];
-            charKey = skill?.characteristic?.value ?? null;
-        }
-
-        const unnatural = charKey
-            ? (characterState.characteristics?.[charKey]?.calculatedUnnatural?.value ?? 0)
-            : 0;
-
-        return {
-            baseValue,
-            bonusSuccesses: calculateBonusSuccesses(unnatural)
-        };
-    }
-
-    return { baseValue: 0, bonusSuccesses: 0 };
+    document.dispatchEvent(new CustomEvent('room:sendMessage', {
+        detail: JSON.stringify({
+            type: type,
+            eventID: crypto.randomUUID(),
+            sheetID: sheetID,
+            path: getDataPath(container)
+        })
+    }));
 }
 
 export class NamedDescriptionItem {
@@ -478,86 +441,7 @@ export class RangedAttack {
 
 
     _handleRollClick() {
-        const rollContainer = this.container.querySelector('[data-id="roll"]');
-        const totalInput = rollContainer.querySelector('[data-id="total"]');
-        const target = parseInt(totalInput.value, 10) || 0;
-
-        // Get bonus successes
-        const { bonusSuccesses } = getRollFull(rollContainer, this.characteristicBlocks);
-
-        // Build label
-        const label = this._buildRollLabel(rollContainer);
-
-        // Emit roll event
-        document.dispatchEvent(new CustomEvent('sheet:rollVersus', {
-            bubbles: true,
-            detail: {
-                target: target,
-                bonusSuccesses: bonusSuccesses,
-                label: label
-            }
-        }));
-    }
-
-    _buildRollLabel(rollContainer) {
-        const weaponName = this.container.querySelector('[data-id="name"]')?.value || 'Unknown';
-        const modifiers = [];
-
-        // Helper to get friendly name
-        const getFriendlyName = (column, value) => {
-            const friendlyNames = {
-                aim: { half: 'half aim', full: 'full aim' },
-                target: {
-                    torso: 'torso', leg: 'leg', arm: 'arm',
-                    head: 'head', joint: 'joint', eyes: 'eyes'
-                },
-                range: {
-                    melee: 'melee', 'point-blank': 'point-blank',
-                    short: 'short', long: 'long', extreme: 'extreme'
-                },
-                rof: {
-                    single: 'single shot', short: 'short burst',
-                    long: 'long burst', suppression: 'suppression'
-                }
-            };
-            return friendlyNames[column]?.[value] || value;
-        };
-
-        // Default values to exclude
-        const defaults = {
-            aim: 'no',
-            target: 'no',
-            range: 'combat',
-            rof: 'single'
-        };
-
-        // Check each column
-        ['aim', 'target', 'range', 'rof'].forEach(columnId => {
-            const column = rollContainer.querySelector(`[data-id="${columnId}"]`);
-            if (!column) return;
-
-            const selectedRadio = column.querySelector('input[type="radio"]:checked');
-            if (!selectedRadio || selectedRadio.value === defaults[columnId]) return;
-
-            modifiers.push(getFriendlyName(columnId, selectedRadio.value));
-        });
-
-        // Add extra modifiers if enabled
-        ['extra1', 'extra2'].forEach(extraId => {
-            const extra = rollContainer.querySelector(`[data-id="${extraId}"]`);
-            if (!extra) return;
-
-            const checkbox = extra.querySelector('[data-id="enabled"]');
-            const nameInput = extra.querySelector('[data-id="name"]');
-
-            if (checkbox?.checked && nameInput?.value) {
-                modifiers.push(nameInput.value);
-            }
-        });
-
-        return modifiers.length > 0
-            ? `${weaponName}, ${modifiers.join(', ')}`
-            : weaponName;
+        requestSheetRoll('attackRoll', this.container);
     }
 
     // Populate field values from pasted string
@@ -981,81 +865,7 @@ export class MeleeAttack {
     }
 
     _handleRollClick() {
-        const rollContainer = this.container.querySelector('[data-id="roll"]');
-        const totalInput = rollContainer.querySelector('[data-id="total"]');
-        const target = parseInt(totalInput.value, 10) || 0;
-
-        const { bonusSuccesses } = getRollFull(rollContainer, this.characteristicBlocks);
-
-        const label = this._buildRollLabel(rollContainer);
-
-        document.dispatchEvent(new CustomEvent('sheet:rollVersus', {
-            bubbles: true,
-            detail: {
-                target: target,
-                bonusSuccesses: bonusSuccesses,
-                label: label
-            }
-        }));
-    }
-
-    _buildRollLabel(rollContainer) {
-        const weaponName = this.container.querySelector('[data-id="name"]')?.value || 'Unknown';
-        const modifiers = [];
-
-        const getFriendlyName = (column, value) => {
-            const friendlyNames = {
-                aim: { half: 'half aim', full: 'full aim' },
-                target: {
-                    torso: 'torso', leg: 'leg', arm: 'arm',
-                    head: 'head', joint: 'joint', eyes: 'eyes'
-                },
-                base: {
-                    charge: 'charge', full: 'full attack',
-                    careful: 'careful', mounted: 'mounted'
-                },
-                stance: { aggressive: 'aggressive', defensive: 'defensive' },
-                rof: {
-                    single: 'single attack', quick: 'quick attack',
-                    lightning: 'lightning attack'
-                }
-            };
-            return friendlyNames[column]?.[value] || value;
-        };
-
-        const defaults = {
-            aim: 'no',
-            target: 'no',
-            base: 'standard',
-            stance: 'standard',
-            rof: 'single'
-        };
-
-        ['aim', 'target', 'base', 'stance', 'rof'].forEach(columnId => {
-            const column = rollContainer.querySelector(`[data-id="${columnId}"]`);
-            if (!column) return;
-
-            const selectedRadio = column.querySelector('input[type="radio"]:checked');
-            if (!selectedRadio || selectedRadio.value === defaults[columnId]) return;
-
-            modifiers.push(getFriendlyName(columnId, selectedRadio.value));
-        });
-
-        ['extra1', 'extra2'].forEach(extraId => {
-            const extra = rollContainer.querySelector(`[data-id="${extraId}"]`);
-            if (!extra) return;
-
-            const checkbox = extra.querySelector('[data-id="enabled"]');
-            const nameInput = extra.querySelector('[data-id="name"]');
-
-            if (checkbox?.checked && nameInput?.value) {
-                modifiers.push(nameInput.value);
-            }
-        });
-
-        return modifiers.length > 0
-            ? `${weaponName}, ${modifiers.join(', ')}`
-            : weaponName;
+        requestSheetRoll('attackRoll', this.container);
     }
 
     /**
@@ -1697,55 +1507,7 @@ export class PsychicPower {
     }
 
     _handleRollClick() {
-        const rollContainer = this.container.querySelector('[data-id="roll"]');
-        const totalInput = rollContainer.querySelector('[data-id="total"]');
-        const target = parseInt(totalInput.value, 10) || 0;
-
-        const { bonusSuccesses } = getRollFull(rollContainer, this.characteristicBlocks);
-
-        const label = this._buildRollLabel(rollContainer);
-
-        document.dispatchEvent(new CustomEvent('sheet:rollVersus', {
-            bubbles: true,
-            detail: {
-                target: target,
-                bonusSuccesses: bonusSuccesses,
-                label: label
-            }
-        }));
-    }
-
-    _buildRollLabel(rollContainer) {
-        const powerName = this.container.querySelector('[data-id="name"]')?.value || 'Unknown Power';
-        const modifiers = [];
-
-        const effectivePRInput = rollContainer.querySelector('[data-id="effectivePR"]');
-        const effectivePR = parseInt(effectivePRInput?.value, 10) || 0;
-        if (effectivePR > 0) {
-            modifiers.push(`${effectivePR} ePR`);
-        }
-
-        const kickPRInput = rollContainer.querySelector('[data-id="kickPR"]');
-        const kickPR = parseInt(kickPRInput?.value, 10) || 0;
-        if (kickPR > 0) {
-            modifiers.push(`+${kickPR} kick`);
-        }
-
-        ['extra1', 'extra2'].forEach(extraId => {
-            const extra = rollContainer.querySelector(`[data-id="${extraId}"]`);
-            if (!extra) return;
-
-            const checkbox = extra.querySelector('[data-id="enabled"]');
-            const nameInput = extra.querySelector('[data-id="name"]');
-
-            if (checkbox?.checked && nameInput?.value) {
-                modifiers.push(nameInput.value);
-            }
-        });
-
-        return modifiers.length > 0
-            ? `${powerName}, ${modifiers.join(', ')}`
-            : powerName;
+        requestSheetRoll('psychicTest', this.container);
     }
 
     // Populate field values from pasted string
@@ -2003,42 +1765,7 @@ export class TechPower {
     }
 
     _handleRollClick() {
-        const rollContainer = this.container.querySelector('[data-id="roll"]');
-        const totalInput = rollContainer.querySelector('[data-id="total"]');
-        const target = parseInt(totalInput.value, 10) || 0;
-
-        const { bonusSuccesses } = getRollFull(rollContainer, this.characteristicBlocks);
-        const label = this._buildRollLabel(rollContainer);
-
-        document.dispatchEvent(new CustomEvent('sheet:rollVersus', {
-            bubbles: true,
-            detail: {
-                target: target,
-                bonusSuccesses: bonusSuccesses,
-                label: label
-            }
-        }));
-    }
-
-    _buildRollLabel(rollContainer) {
-        const powerName = this.container.querySelector('[data-id="name"]')?.value || 'Unknown Power';
-        const modifiers = [];
-
-        ['extra1', 'extra2'].forEach(extraId => {
-            const extra = rollContainer.querySelector(`[data-id="${extraId}"]`);
-            if (!extra) return;
-
-            const checkbox = extra.querySelector('[data-id="enabled"]');
-            const nameInput = extra.querySelector('[data-id="name"]');
-
-            if (checkbox?.checked && nameInput?.value) {
-                modifiers.push(nameInput.value);
-            }
-        });
-
-        return modifiers.length > 0
-            ? `${powerName}, ${modifiers.join(', ')}`
-            : powerName;
+        requestSheetRoll('techPower', this.container);
     }
 
     // Populate field values from pasted string
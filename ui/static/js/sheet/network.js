@@ -3,6 +3,8 @@
 import {
     mockSocket,
     getRoot,
+    getSheetVersion,
+    noteSheetVersion,
     getDataPath,
     getChangeValue,
     getGridFromPath,
@@ -77,23 +79,36 @@ connect();
 export { socket, connect };
 
 // — State & Versioning ——————————————————
-let globalVersion = 0;
 const timers = new Map();     // Map<fullFieldPath, timer>
 
 // — Sending ———————————————————————————
 function debounce(map, key, delay, fn) {
-    clearTimeout(map.get(key));
-    map.set(key, setTimeout(() => {
+    clearTimeout(map.get(key)?.timer);
+    map.set(key, {
+        fn,
+        timer: setTimeout(() => {
+            fn();
+            map.delete(key);
+        }, delay),
+    });
+}
+
+// Sends every edit still waiting out its debounce right away
+function flushPending(map) {
+    for (const { fn, timer } of map.values()) {
+        clearTimeout(timer);
         fn();
-        map.delete(key);
-    }, delay));
+    }
+    map.clear();
 }
 
+// The version is stamped when the message actually goes out, so an edit
+// waiting out the debounce is based on everything seen until then.
 function schedule(msg, path) {
     debounce(timers,
         path,
         200,
-        () => socket.send(msg)
+        () => socket.send(JSON.stringify({ ...msg, version: getSheetVersion() }))
     );
 }
 
@@ -120,13 +135,11 @@ function handleInputEvent(e) {
         type: 'change',
         eventID: crypto.randomUUID(),
         sheetID: document.getElementById('charactersheet').dataset.sheetId,
-        version: ++globalVersion,
         path: path,
         change: changeValue,
     }
 
-    const msgJSON = JSON.stringify(msg);
-    schedule(msgJSON, path);
+    schedule(msg, path);
 
     updateSignalAtPath(path, changeValue);
 
@@ -174,15 +187,13 @@ function handleChangeEvent(e) {
     // Compute fullPath & parent container
     const path = getDataPath(el);
 
-    const msgJSON = JSON.stringify({
+    schedule({
         type: 'change',
         eventID: crypto.randomUUID(),
         sheetID: document.getElementById('charactersheet').dataset.sheetId,
-        version: ++globalVersion,
         path: path,
         change: change,
-    });
-    schedule(msgJSON, path);
+    }, path);
 
     updateSignalAtPath(path, change);
 }
@@ -192,15 +203,13 @@ function handleBatchEvent(e) {
     const path = getDataPath(e.target);
     const changes = e.detail.changes;
 
-    const msgJSON = JSON.stringify({
+    schedule({
         type: 'batch',
         eventID: crypto.randomUUID(),
         sheetID: document.getElementById('charactersheet').dataset.sheetId,
-        version: ++globalVersion,
         path: path,
         changes: changes,
-    });
-    schedule(msgJSON, path);
+    }, path);
 
     updateSignalBatch(path, changes);
 }
@@ -209,15 +218,24 @@ function handlePositionsChangedEvent(e) {
     const path = getDataPath(e.target);
     const positions = e.detail.positions;
 
-    const msgJSON = JSON.stringify({
+    schedule({
         type: 'positionsChanged',
         eventID: crypto.randomUUID(),
         sheetID: document.getElementById('charactersheet').dataset.sheetId,
-        version: ++globalVersion,
         path: path,
         positions: positions
-    });
-    schedule(msgJSON, path);
+    }, path);
+}
+
+// Undo or redo this user's latest edit to the open sheet. The server sends
+// the result back as ordinary edits.
+function sendRevert(type) {
+    flushPending(timers);
+    socket.send(JSON.stringify({
+        type: type,
+        eventID: crypto.randomUUID(),
+        sheetID: currentSheetID(),
+    }));
 }
 
 function currentSheetID() {
@@ -241,21 +259,44 @@ const messageHandlers = {
     'kickPlayer': msg => document.dispatchEvent(new CustomEvent('ws:kickPlayer', { detail: msg })),
     'changePlayerRole': msg => document.dispatchEvent(new CustomEvent('ws:changePlayerRole', { detail: msg })),
     'chatMessage': msg => document.dispatchEvent(new CustomEvent('ws:chatMessage', { detail: msg })),
+    'commandReply': msg => document.dispatchEvent(new CustomEvent('ws:commandReply', { detail: msg })),
     'deleteMessage': msg => document.dispatchEvent(new CustomEvent('ws:deleteMessage', { detail: msg })),
     'chatHistory': msg => document.dispatchEvent(new CustomEvent('ws:chatHistory', { detail: msg })),
     'dicePresetUpdated': msg => document.dispatchEvent(new CustomEvent('ws:dicePresetUpdated', { detail: msg })),
+    'initiativeUpdated': msg => document.dispatchEvent(new CustomEvent('ws:initiativeUpdated', { detail: msg })),
+
+    // Someone else changed what our edit touched first: take their value
+    'conflict': msg => {
+        if (msg.sheetID !== currentSheetID()) return;
+        noteSheetVersion(msg.sheetID, msg.version);
+        if (msg.value === null || !findElementByPath(msg.path)) return;
+        if (typeof msg.value === 'object' && !Array.isArray(msg.value)) {
+            getRoot().dispatchEvent(new CustomEvent('batchRemote', { detail: { path: msg.path, changes: msg.value } }));
+        } else {
+            getRoot().dispatchEvent(new CustomEvent('changeRemote', { detail: { path: msg.path, change: msg.value } }));
+        }
+    },
+
+    'sheetRestored': msg => {
+        if (msg.sheetID === currentSheetID()) {
+            document.dispatchEvent(new CustomEvent('sheet:reload', { detail: msg }));
+        }
+    },
 
     'change': msg => {
+        noteSheetVersion(msg.sheetID, msg.version);
         if (msg.sheetID === currentSheetID()) {
             getRoot().dispatchEvent(new CustomEvent('changeRemote', { detail: msg }));
         }
     },
     'batch': msg => {
+        noteSheetVersion(msg.sheetID, msg.version);
         if (msg.sheetID === currentSheetID()) {
             getRoot().dispatchEvent(new CustomEvent('batchRemote', { detail: msg }));
         }
     },
     'createItem': msg => {
+        noteSheetVersion(msg.sheetID, msg.version);
         if (msg.sheetID === currentSheetID()) {
             findElementByPath(msg.path)
                 .dispatchEvent(new CustomEvent('createItemRemote', { detail: msg }));
@@ -263,6 +304,7 @@ const messageHandlers = {
     },
     'deleteItem': msg => {
         if (msg.sheetID !== currentSheetID()) return;
+        noteSheetVersion(msg.sheetID, msg.version);
         const parts = msg.path.split('.');
         parts.pop();
         const container = findElementByPath(parts.join('.'));
@@ -274,11 +316,13 @@ const messageHandlers = {
     },
     'positionsChanged': msg => {
         if (msg.sheetID !== currentSheetID()) return;
+        noteSheetVersion(msg.sheetID, msg.version);
         const container = getRoot().querySelector(`[data-id="${getGridFromPath(msg.path)}"]`);
         container.dispatchEvent(new CustomEvent('positionsChangedRemote', { detail: msg }));
     },
     'moveItemBetweenGrids': msg => {
         if (msg.sheetID !== currentSheetID()) return;
+        noteSheetVersion(msg.sheetID, msg.version);
         const fromGrid = findElementByPath(msg.fromPath);
         const tabsContainer = fromGrid?.closest('.tabs[data-id$=".items"]');
         if (tabsContainer) {
@@ -341,4 +385,6 @@ document.addEventListener("charactersheet_inserted", () => {
     root.addEventListener("change", handleChangeEvent, true);
     root.addEventListener("fieldsUpdated", handleBatchEvent, true);
     root.addEventListener('positionsChanged', handlePositionsChangedEvent, true);
+    root.querySelector('.undo-edit')?.addEventListener('click', () => sendRevert('undo'));
+    root.querySelector('.redo-edit')?.addEventListener('click', () => sendRevert('redo'));
 });
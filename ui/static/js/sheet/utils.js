@@ -3,6 +3,24 @@ export function getRoot() {
     return el ? el.shadowRoot : null;
 }
 
+/**
+ * The latest version of the open sheet this client has seen. Edits are sent
+ * based on it, so the server can tell when they are stale.
+ */
+export function getSheetVersion() {
+    return Number(document.getElementById('charactersheet')?.dataset.version) || 0;
+}
+
+/**
+ * Raises the known version of the open sheet; versions of other sheets and
+ * older ones arriving late are ignored.
+ */
+export function noteSheetVersion(sheetID, version) {
+    const el = document.getElementById('charactersheet');
+    if (!el || !version || String(sheetID) !== el.dataset.sheetId) return;
+    if (version > getSheetVersion()) el.dataset.version = String(version);
+}
+
 /**
  * A mock socket that just logs send calls.
  */